@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// credentialsVolumePrefix is the name shared by all credentials volumes.
+// Per-user volumes append "-<uid>" (or "-<username>" on Windows).
+const credentialsVolumePrefix = "cc-sandbox-credentials"
+
+// helperImage is a small image used for housekeeping on volumes.
+// It is fully qualified so podman does not prompt for a registry.
+const helperImage = "docker.io/library/alpine:latest"
+
+// defaultAccount is the account used when --account is not given.
+// Its credentials live in the volume without an account suffix.
+const defaultAccount = "default"
+
+// accountNamePattern restricts account names to characters that are valid in
+// volume names. Dots are excluded because they separate the owner from the account.
+var accountNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,62}$`)
+
+// credentialFiles are the files in a credentials volume that grant access
+// to a Claude account or a cloud provider, relative to the volume root.
+var credentialFiles = []string{
+	".oauth-token",
+	".claude/.credentials.json",
+	".cc-sandbox/api-key",
+	".cc-sandbox/aws/credentials",
+	".cc-sandbox/aws/config",
+	".cc-sandbox/gcloud/adc.json",
+}
+
+// credentialFileLabels names each credential file in auth status output.
+var credentialFileLabels = map[string]string{
+	".oauth-token":                "OAuth token",
+	".claude/.credentials.json":   "Credentials file",
+	".cc-sandbox/api-key":         "API key",
+	".cc-sandbox/aws/credentials": "AWS credentials",
+	".cc-sandbox/aws/config":      "AWS config",
+	".cc-sandbox/gcloud/adc.json": "Google ADC file",
+}
+
+// providerStateFiles record the selected provider and its settings.
+// They hold no secrets but are removed by auth logout with the credentials.
+var providerStateFiles = []string{".cc-sandbox/provider", ".cc-sandbox/bedrock.env", ".cc-sandbox/vertex.env"}
+
+// statCredentialsScript prints "volume|file|mtime|size" for each credential
+// file found in the volumes mounted under /v, and "volume|provider|name" for
+// the selected provider. It takes the volume names as arguments and the file
+// names from credentialFiles after a "--".
+const statCredentialsScript = `vols=""
+while [ "$#" -gt 0 ] && [ "$1" != "--" ]; do vols="$vols $1"; shift; done
+shift
+for v in $vols; do
+  for f; do
+    if [ -f "/v/$v/$f" ]; then stat -c "$v|$f|%Y|%s" "/v/$v/$f"; fi
+  done
+  if [ -s "/v/$v/.cc-sandbox/provider" ]; then echo "$v|provider|$(head -c 32 "/v/$v/.cc-sandbox/provider")"; fi
+done
+exit 0`
+
+// wipeCredentialsScript overwrites each file given as an argument with zeros
+// before deleting it, and prints the files it removed.
+const wipeCredentialsScript = `cd /mnt/claude-data || exit 1
+status=0
+for f; do
+  [ -f "$f" ] || continue
+  size=$(wc -c < "$f")
+  if dd if=/dev/zero of="$f" bs=1 count="$size" conv=notrunc 2>/dev/null && sync && rm -f "$f"; then
+    echo "$f"
+  else
+    status=1
+  fi
+done
+exit $status`
+
+// maxTokenInputSize caps how much is read from stdin by auth --token-stdin.
+const maxTokenInputSize = 4096
+
+// hostCredentialFile is a host Claude file that auth import copies into the volume.
+type hostCredentialFile struct {
+	HostPath      string
+	ContainerPath string
+}
+
+// authTarget identifies the credentials volume an auth command acts on.
+type authTarget struct {
+	UID     int    // Target UID, or -1 for the current user
+	Account string // Claude account, empty for the default account
+}
+
+// volume returns the credentials volume name for the target.
+func (t authTarget) volume() string {
+	return credentialsVolumeFor(t.UID, t.Account)
+}
+
+// uid returns the target UID, or the current user's UID if none was given.
+func (t authTarget) uid() int {
+	if t.UID < 0 {
+		return os.Getuid()
+	}
+	return t.UID
+}
+
+// credentialFile describes a credential file found in a credentials volume.
+type credentialFile struct {
+	Volume  string
+	Name    string
+	ModTime time.Time
+	Size    int64
+}
+
+// runContainerOutput runs a container command and returns its stdout.
+// This is a variable to allow mocking in tests.
+var runContainerOutput = func(containerRuntime string, args []string) ([]byte, error) {
+	cmd := exec.Command(containerRuntime, args...)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
+
+// newAuthStatusCmd creates the auth status subcommand.
+func newAuthStatusCmd(target *authTarget) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show the state of the credentials volume",
+		Long: `Report whether the credentials volume exists and which credential files it holds.
+
+Examples:
+  cc-sandbox auth status              # Current user's credentials
+  cc-sandbox auth status --uid 10000  # Credentials for a specific UID
+  cc-sandbox auth status --account work`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := resolveAuthTarget(cmd, target); err != nil {
+				return err
+			}
+			return runAuthStatus(*target)
+		},
+	}
+}
+
+// newAuthLogoutCmd creates the auth logout subcommand.
+func newAuthLogoutCmd(target *authTarget) *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "Wipe stored credentials from the credentials volume",
+		Long: `Overwrite and delete the OAuth token and .claude/.credentials.json in the credentials volume.
+Other Claude settings in the volume are kept.
+
+Examples:
+  cc-sandbox auth logout              # Current user's credentials
+  cc-sandbox auth logout --uid 10000  # Credentials for a specific UID
+  cc-sandbox auth logout --account work`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := resolveAuthTarget(cmd, target); err != nil {
+				return err
+			}
+			return runAuthLogout(*target)
+		},
+	}
+}
+
+// newAuthListCmd creates the auth list subcommand.
+func newAuthListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List all credentials volumes",
+		Long:  `List every cc-sandbox credentials volume with its UID and account, and when its token was written.`,
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runAuthList()
+		},
+	}
+}
+
+// newAuthImportCmd creates the auth import subcommand.
+func newAuthImportCmd(target *authTarget) *cobra.Command {
+	return &cobra.Command{
+		Use:   "import",
+		Short: "Copy host Claude credentials into the credentials volume",
+		Long: `Copy ~/.claude/.credentials.json and ~/.claude.json from the host into the credentials volume,
+so sandboxes reuse an existing Claude login without running setup-token.
+
+On macOS Claude stores credentials in the Keychain rather than in ~/.claude/.credentials.json;
+use 'cc-sandbox auth --token-stdin' there instead.
+
+Examples:
+  cc-sandbox auth import              # Import for the current user
+  cc-sandbox auth import --uid 10000  # Import into a specific UID's volume
+  cc-sandbox auth import --account work`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := resolveAuthTarget(cmd, target); err != nil {
+				return err
+			}
+			return runAuthImport(*target)
+		},
+	}
+}
+
+// resolveAuthTarget fills in the account for an auth command. Without
+// --account it uses the configured default (env, profile or config files).
+func resolveAuthTarget(cmd *cobra.Command, target *authTarget) error {
+	if !cmd.Flags().Changed("account") {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+		cfg := &Config{Workdir: cwd}
+		if err := resolveConfig(cfg, func(string) bool { return false }); err != nil {
+			return err
+		}
+		target.Account = cfg.Account
+	}
+	return validateAccountName(target.Account)
+}
+
+// validateAccountName checks that an account name can be used in a volume name.
+// An empty name selects the default account.
+func validateAccountName(account string) error {
+	if account == "" || accountNamePattern.MatchString(account) {
+		return nil
+	}
+	return fmt.Errorf("invalid account name %q: use letters, digits, '-' and '_'", account)
+}
+
+// credentialsVolumeFor returns the credentials volume for targetUID and account.
+// A negative targetUID selects the current user. The default account keeps
+// the original per-user volume; other accounts get a ".<account>" suffix.
+func credentialsVolumeFor(targetUID int, account string) string {
+	if account == "" || account == defaultAccount {
+		if targetUID < 0 {
+			return getCredentialsVolumeName()
+		}
+		return credentialsVolumePrefix + "-" + strconv.Itoa(targetUID)
+	}
+
+	owner := currentCredentialsOwner()
+	if targetUID >= 0 {
+		owner = strconv.Itoa(targetUID)
+	}
+	name := credentialsVolumePrefix
+	if owner != "" {
+		name += "-" + owner
+	}
+	return name + "." + account
+}
+
+// parseCredentialsVolume returns the UID (or Windows username) and account
+// encoded in a credentials volume name. The legacy unsuffixed volume is
+// reported with owner "shared".
+func parseCredentialsVolume(volumeName string) (owner, account string) {
+	rest := strings.TrimPrefix(volumeName, credentialsVolumePrefix)
+	owner, account, _ = strings.Cut(rest, ".")
+	owner = strings.TrimPrefix(owner, "-")
+	if owner == "" {
+		owner = "shared"
+	}
+	if account == "" {
+		account = defaultAccount
+	}
+	return owner, account
+}
+
+// runtimeVolumeExists checks if a volume exists in the given runtime.
+func runtimeVolumeExists(containerRuntime, name string) bool {
+	return exec.Command(containerRuntime, "volume", "inspect", name).Run() == nil
+}
+
+// listCredentialsVolumes returns the names of all credentials volumes, sorted.
+func listCredentialsVolumes(containerRuntime string) ([]string, error) {
+	output, err := runContainerOutput(containerRuntime, []string{
+		"volume", "ls", "--filter", "name=" + credentialsVolumePrefix, "--format", "{{.Name}}",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	var volumes []string
+	for _, name := range strings.Fields(string(output)) {
+		// The name filter matches substrings
+		if name == credentialsVolumePrefix || strings.HasPrefix(name, credentialsVolumePrefix+"-") {
+			volumes = append(volumes, name)
+		}
+	}
+	sort.Strings(volumes)
+	return volumes, nil
+}
+
+// statCredentialFiles reports the credential files present in each volume and
+// the provider selected in it, using a single helper container with all
+// volumes mounted read-only.
+func statCredentialFiles(containerRuntime string, volumes []string) ([]credentialFile, map[string]string, error) {
+	if len(volumes) == 0 {
+		return nil, nil, nil
+	}
+
+	args := []string{"run", "--rm", "--network=none"}
+	for _, v := range volumes {
+		args = append(args, "-v", v+":/v/"+v+":ro")
+	}
+	args = append(args, helperImage, "sh", "-c", statCredentialsScript, "sh")
+	args = append(args, volumes...)
+	args = append(args, "--")
+	args = append(args, credentialFiles...)
+
+	output, err := runContainerOutput(containerRuntime, args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to inspect credentials volumes: %w", err)
+	}
+	files, providers := parseCredentialFiles(string(output))
+	return files, providers, nil
+}
+
+// parseCredentialFiles parses the output of statCredentialsScript into the
+// files found and the provider selected in each volume.
+// Malformed lines and unknown providers are skipped.
+func parseCredentialFiles(output string) ([]credentialFile, map[string]string) {
+	var files []credentialFile
+	providers := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.Split(strings.TrimSpace(line), "|")
+		if len(parts) == 3 && parts[1] == "provider" {
+			if parts[2] != "" && validateProvider(parts[2]) == nil {
+				providers[parts[0]] = parts[2]
+			}
+			continue
+		}
+		if len(parts) != 4 {
+			continue
+		}
+		mtime, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		size, err := strconv.ParseInt(parts[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, credentialFile{
+			Volume:  parts[0],
+			Name:    parts[1],
+			ModTime: time.Unix(mtime, 0),
+			Size:    size,
+		})
+	}
+	return files, providers
+}
+
+// findCredentialFile returns the named file in volume, or nil if absent.
+func findCredentialFile(files []credentialFile, volume, name string) *credentialFile {
+	for i := range files {
+		if files[i].Volume == volume && files[i].Name == name {
+			return &files[i]
+		}
+	}
+	return nil
+}
+
+// formatCredentialFile describes a credential file for status output.
+func formatCredentialFile(f *credentialFile) string {
+	if f == nil {
+		return "missing"
+	}
+	if f.Size == 0 {
+		return "empty, written " + f.ModTime.Format(time.RFC3339)
+	}
+	return "present, written " + f.ModTime.Format(time.RFC3339)
+}
+
+// runAuthStatus prints the state of the target credentials volume.
+func runAuthStatus(target authTarget) error {
+	containerRuntime := detectRuntime(&Config{Runtime: "auto"})
+	volumeName := target.volume()
+
+	_, account := parseCredentialsVolume(volumeName)
+	fmt.Printf("Account:            %s\n", account)
+	fmt.Printf("Credentials volume: %s\n", volumeName)
+	if !runtimeVolumeExists(containerRuntime, volumeName) {
+		fmt.Printf("Status:             not found (run 'cc-sandbox auth' to authenticate)\n")
+		return nil
+	}
+	fmt.Printf("Status:             exists\n")
+
+	files, providers, err := statCredentialFiles(containerRuntime, []string{volumeName})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Provider:           %s\n", formatProvider(providers[volumeName]))
+	for _, name := range credentialFiles {
+		f := findCredentialFile(files, volumeName, name)
+		// Provider files are only shown when present
+		if f == nil && strings.HasPrefix(name, ".cc-sandbox/") {
+			continue
+		}
+		fmt.Printf("%-20s%s\n", credentialFileLabels[name]+":", formatCredentialFile(f))
+	}
+	return nil
+}
+
+// runAuthLogout wipes the credential files from the target credentials volume.
+func runAuthLogout(target authTarget) error {
+	containerRuntime := detectRuntime(&Config{Runtime: "auto"})
+	volumeName := target.volume()
+
+	if !runtimeVolumeExists(containerRuntime, volumeName) {
+		fmt.Printf("Credentials volume %s does not exist, nothing to do.\n", volumeName)
+		return nil
+	}
+
+	removed, err := wipeCredentialFiles(containerRuntime, volumeName)
+	if err != nil {
+		return err
+	}
+
+	if len(removed) == 0 {
+		fmt.Printf("No credentials found in volume: %s\n", volumeName)
+		return nil
+	}
+	for _, name := range removed {
+		fmt.Printf("Removed %s\n", name)
+	}
+	fmt.Printf("\nLogged out. Credentials wiped from volume: %s\n", volumeName)
+	return nil
+}
+
+// wipeCredentialFiles overwrites and deletes the credential files in a volume
+// and returns the files it removed.
+func wipeCredentialFiles(containerRuntime, volumeName string) ([]string, error) {
+	args := []string{
+		"run", "--rm", "--network=none",
+		"-v", volumeName + ":/mnt/claude-data",
+		helperImage,
+		"sh", "-c", wipeCredentialsScript, "sh",
+	}
+	args = append(args, credentialFiles...)
+	args = append(args, providerStateFiles...)
+
+	output, err := runContainerOutput(containerRuntime, args)
+	removed := strings.Fields(string(output))
+	if err != nil {
+		return removed, fmt.Errorf("failed to wipe credentials in %s: %w", volumeName, err)
+	}
+	return removed, nil
+}
+
+// runAuthList prints all credentials volumes with their owner and token state.
+func runAuthList() error {
+	containerRuntime := detectRuntime(&Config{Runtime: "auto"})
+
+	volumes, err := listCredentialsVolumes(containerRuntime)
+	if err != nil {
+		return err
+	}
+	if len(volumes) == 0 {
+		fmt.Println("No credentials volumes found.")
+		return nil
+	}
+
+	files, providers, statErr := statCredentialFiles(containerRuntime, volumes)
+	if statErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", statErr)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "VOLUME\tUID\tACCOUNT\tPROVIDER\tTOKEN\tCREDENTIALS")
+	for _, v := range volumes {
+		provider, token, creds := "unknown", "unknown", "unknown"
+		if statErr == nil {
+			provider = formatProvider(providers[v])
+			token = formatListEntry(findCredentialFile(files, v, ".oauth-token"))
+			creds = formatListEntry(findCredentialFile(files, v, ".claude/.credentials.json"))
+		}
+		owner, account := parseCredentialsVolume(v)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", v, owner, account, provider, token, creds)
+	}
+	return w.Flush()
+}
+
+// formatProvider describes the provider recorded in a volume.
+// Volumes written before providers existed use OAuth.
+func formatProvider(provider string) string {
+	if provider == "" {
+		return ProviderOAuth
+	}
+	return provider
+}
+
+// formatListEntry describes a credential file for the list table.
+func formatListEntry(f *credentialFile) string {
+	if f == nil {
+		return "-"
+	}
+	return f.ModTime.Format("2006-01-02 15:04")
+}
+
+// readTokenInput reads an OAuth token from r, trimming surrounding whitespace.
+func readTokenInput(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxTokenInputSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read token from stdin: %w", err)
+	}
+	if len(data) > maxTokenInputSize {
+		return "", errors.New("invalid OAuth token: input too large")
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.New("no token provided on stdin")
+	}
+	return token, nil
+}
+
+// prepareAuthImage detects the runtime and makes sure the image for tag is available.
+func prepareAuthImage(tag string) (string, string, error) {
+	containerRuntime := detectRuntime(&Config{Runtime: "auto"})
+	imageName := resolveImageName(getEnv("CC_SANDBOX_REGISTRY", DefaultRegistry), tag, containerRuntime)
+
+	if isRegistryImage(imageName) && !imageExistsLocally(imageName, containerRuntime) {
+		fmt.Fprintf(os.Stderr, "Pulling image %s...\n", imageName)
+		if err := pullImage(imageName, containerRuntime); err != nil {
+			return "", "", fmt.Errorf("failed to pull image: %w", err)
+		}
+	}
+	return containerRuntime, imageName, nil
+}
+
+// runAuthTokenStdin validates a token read from input and stores it in the
+// credentials volume. It uses the base image rather than bun-full, since the
+// Claude CLI is not needed.
+func runAuthTokenStdin(target authTarget, input io.Reader) error {
+	token, err := readTokenInput(input)
+	if err != nil {
+		return err
+	}
+	if err := validateOAuthToken(token); err != nil {
+		return err
+	}
+
+	containerRuntime, imageName, err := prepareAuthImage("base")
+	if err != nil {
+		return err
+	}
+	volumeName := target.volume()
+
+	if err := storeOAuthToken(containerRuntime, volumeName, imageName, token, target.uid()); err != nil {
+		return fmt.Errorf("failed to store OAuth token: %w", err)
+	}
+	if err := selectOAuthProvider(containerRuntime, volumeName, imageName, target.uid()); err != nil {
+		return err
+	}
+
+	fmt.Printf("OAuth token stored in volume: %s\n", volumeName)
+	return nil
+}
+
+// hostCredentialFiles returns the host Claude files imported by auth import.
+func hostCredentialFiles(home string) []hostCredentialFile {
+	return []hostCredentialFile{
+		{filepath.Join(home, ".claude", ".credentials.json"), "/mnt/claude-data/.claude/.credentials.json"},
+		{filepath.Join(home, ".claude.json"), "/mnt/claude-data/.claude.json"},
+	}
+}
+
+// runAuthImport copies the host's Claude credential files into the credentials volume.
+func runAuthImport(target authTarget) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	// Read and check everything before touching the volume
+	files := hostCredentialFiles(home)
+	contents := make([][]byte, len(files))
+	found := 0
+	for i, f := range files {
+		data, err := os.ReadFile(f.HostPath)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Skipping %s: not found\n", f.HostPath)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", f.HostPath, err)
+		}
+		if !json.Valid(data) {
+			return fmt.Errorf("failed to import %s: not valid JSON", f.HostPath)
+		}
+		contents[i] = data
+		found++
+	}
+	if found == 0 {
+		return fmt.Errorf("no Claude credentials found in %s (on macOS, use 'cc-sandbox auth --token-stdin')", home)
+	}
+
+	containerRuntime, imageName, err := prepareAuthImage("base")
+	if err != nil {
+		return err
+	}
+	volumeName := target.volume()
+	uid := target.uid()
+
+	for i, f := range files {
+		if contents[i] == nil {
+			continue
+		}
+		if err := storeVolumeFile(containerRuntime, volumeName, imageName, f.ContainerPath, bytes.NewReader(contents[i]), uid); err != nil {
+			return fmt.Errorf("failed to import %s: %w", f.HostPath, err)
+		}
+		fmt.Printf("Imported %s\n", f.HostPath)
+	}
+	if err := selectOAuthProvider(containerRuntime, volumeName, imageName, uid); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nCredentials imported into volume: %s\n", volumeName)
+	return nil
+}
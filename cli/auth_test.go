@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCredentialsVolume(t *testing.T) {
+	tests := []struct {
+		volume      string
+		wantOwner   string
+		wantAccount string
+	}{
+		{"cc-sandbox-credentials-1000", "1000", "default"},
+		{"cc-sandbox-credentials-1000.work", "1000", "work"},
+		{"cc-sandbox-credentials-jdoe", "jdoe", "default"},
+		{"cc-sandbox-credentials-j-doe.oss_2", "j-doe", "oss_2"},
+		{"cc-sandbox-credentials", "shared", "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.volume, func(t *testing.T) {
+			owner, account := parseCredentialsVolume(tt.volume)
+			if owner != tt.wantOwner || account != tt.wantAccount {
+				t.Errorf("parseCredentialsVolume(%q) = (%q, %q), want (%q, %q)",
+					tt.volume, owner, account, tt.wantOwner, tt.wantAccount)
+			}
+		})
+	}
+}
+
+func TestCredentialsVolumeFor(t *testing.T) {
+	tests := []struct {
+		uid     int
+		account string
+		want    string
+	}{
+		{1000, "", "cc-sandbox-credentials-1000"},
+		{1000, "default", "cc-sandbox-credentials-1000"},
+		{1000, "work", "cc-sandbox-credentials-1000.work"},
+	}
+
+	for _, tt := range tests {
+		if got := credentialsVolumeFor(tt.uid, tt.account); got != tt.want {
+			t.Errorf("credentialsVolumeFor(%d, %q) = %q, want %q", tt.uid, tt.account, got, tt.want)
+		}
+		owner, _ := parseCredentialsVolume(credentialsVolumeFor(tt.uid, tt.account))
+		if owner != "1000" {
+			t.Errorf("parseCredentialsVolume(credentialsVolumeFor(%d, %q)) owner = %q, want 1000", tt.uid, tt.account, owner)
+		}
+	}
+}
+
+func TestValidateAccountName(t *testing.T) {
+	for _, name := range []string{"", "default", "work", "oss-2", "Team_A"} {
+		if err := validateAccountName(name); err != nil {
+			t.Errorf("validateAccountName(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range []string{"-work", "a.b", "a/b", "a b", strings.Repeat("a", 64)} {
+		if err := validateAccountName(name); err == nil {
+			t.Errorf("validateAccountName(%q) expected error", name)
+		}
+	}
+}
+
+func TestParseCredentialFiles(t *testing.T) {
+	output := "cc-sandbox-credentials-1000|.oauth-token|1700000000|108\n" +
+		"cc-sandbox-credentials-1000|.claude/.credentials.json|1700000100|450\n" +
+		"stat: can't stat 'x'\n" +
+		"cc-sandbox-credentials-10000|.oauth-token|bad|1\n" +
+		"cc-sandbox-credentials-1000.work|provider|bedrock\n" +
+		"cc-sandbox-credentials-2000|provider|bogus\n"
+
+	files, providers := parseCredentialFiles(output)
+	if len(files) != 2 {
+		t.Fatalf("parseCredentialFiles() returned %d files, want 2: %+v", len(files), files)
+	}
+
+	token := findCredentialFile(files, "cc-sandbox-credentials-1000", ".oauth-token")
+	if token == nil {
+		t.Fatal("findCredentialFile() did not find .oauth-token")
+	}
+	if !token.ModTime.Equal(time.Unix(1700000000, 0)) || token.Size != 108 {
+		t.Errorf("token = %+v, want mtime 1700000000 and size 108", token)
+	}
+	if findCredentialFile(files, "cc-sandbox-credentials-10000", ".oauth-token") != nil {
+		t.Error("findCredentialFile() returned a file from a malformed line")
+	}
+
+	if len(providers) != 1 || providers["cc-sandbox-credentials-1000.work"] != ProviderBedrock {
+		t.Errorf("parseCredentialFiles() providers = %v, want only bedrock for the work volume", providers)
+	}
+}
+
+func TestListCredentialsVolumes(t *testing.T) {
+	original := runContainerOutput
+	defer func() { runContainerOutput = original }()
+
+	var gotArgs []string
+	runContainerOutput = func(_ string, args []string) ([]byte, error) {
+		gotArgs = args
+		return []byte("cc-sandbox-credentials-2000\nmy-cc-sandbox-credentials-x\ncc-sandbox-credentials\ncc-sandbox-credentials-1000\n"), nil
+	}
+
+	volumes, err := listCredentialsVolumes("docker")
+	if err != nil {
+		t.Fatalf("listCredentialsVolumes() error = %v", err)
+	}
+	want := []string{"cc-sandbox-credentials", "cc-sandbox-credentials-1000", "cc-sandbox-credentials-2000"}
+	if joinArgs(volumes) != joinArgs(want) {
+		t.Errorf("listCredentialsVolumes() = %v, want %v", volumes, want)
+	}
+	if !contains(joinArgs(gotArgs), "name=cc-sandbox-credentials") {
+		t.Errorf("volume ls args = %v, want name filter", gotArgs)
+	}
+}
+
+func TestWipeCredentialFiles(t *testing.T) {
+	original := runContainerOutput
+	defer func() { runContainerOutput = original }()
+
+	var gotArgs []string
+	runContainerOutput = func(_ string, args []string) ([]byte, error) {
+		gotArgs = args
+		return []byte(".oauth-token\n"), nil
+	}
+
+	removed, err := wipeCredentialFiles("docker", "cc-sandbox-credentials-1000")
+	if err != nil {
+		t.Fatalf("wipeCredentialFiles() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0] != ".oauth-token" {
+		t.Errorf("wipeCredentialFiles() removed = %v, want [.oauth-token]", removed)
+	}
+
+	argsStr := joinArgs(gotArgs)
+	for _, want := range []string{"cc-sandbox-credentials-1000:/mnt/claude-data", helperImage, ".oauth-token", ".claude/.credentials.json"} {
+		if !contains(argsStr, want) {
+			t.Errorf("wipe args missing %q: %s", want, argsStr)
+		}
+	}
+
+	runContainerOutput = func(_ string, _ []string) ([]byte, error) {
+		return nil, errors.New("exit status 1")
+	}
+	if _, err := wipeCredentialFiles("docker", "cc-sandbox-credentials-1000"); err == nil {
+		t.Error("wipeCredentialFiles() expected error when the helper fails")
+	}
+}
+
+func TestReadTokenInput(t *testing.T) {
+	token := "sk-ant-oat01-" + strings.Repeat("a", 40)
+
+	got, err := readTokenInput(strings.NewReader("  " + token + "\n"))
+	if err != nil {
+		t.Fatalf("readTokenInput() error = %v", err)
+	}
+	if got != token {
+		t.Errorf("readTokenInput() = %q, want %q", got, token)
+	}
+
+	if _, err := readTokenInput(strings.NewReader("\n")); err == nil {
+		t.Error("readTokenInput() expected error for empty input")
+	}
+	if _, err := readTokenInput(strings.NewReader(strings.Repeat("a", maxTokenInputSize+1))); err == nil {
+		t.Error("readTokenInput() expected error for oversized input")
+	}
+}
+
+func TestRunAuthTokenStdinRejectsInvalidToken(t *testing.T) {
+	original := runContainerWithInput
+	defer func() { runContainerWithInput = original }()
+
+	called := false
+	runContainerWithInput = func(_ string, _ []string, _ io.Reader) error {
+		called = true
+		return nil
+	}
+
+	if err := runAuthTokenStdin(authTarget{UID: 1000}, strings.NewReader("not-a-token\n")); err == nil {
+		t.Error("runAuthTokenStdin() expected error for invalid token")
+	}
+	if called {
+		t.Error("runAuthTokenStdin() started a container for an invalid token")
+	}
+}
+
+func TestHostCredentialFiles(t *testing.T) {
+	files := hostCredentialFiles("/home/jdoe")
+
+	want := map[string]string{
+		"/home/jdoe/.claude/.credentials.json": "/mnt/claude-data/.claude/.credentials.json",
+		"/home/jdoe/.claude.json":              "/mnt/claude-data/.claude.json",
+	}
+	if len(files) != len(want) {
+		t.Fatalf("hostCredentialFiles() = %+v, want %d files", files, len(want))
+	}
+	for _, f := range files {
+		if want[f.HostPath] != f.ContainerPath {
+			t.Errorf("hostCredentialFiles() maps %s to %s, want %s", f.HostPath, f.ContainerPath, want[f.HostPath])
+		}
+	}
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultBatchConcurrency is how many tasks run at once when neither the
+// batch file nor -j says otherwise.
+const defaultBatchConcurrency = 4
+
+// Task statuses in the batch report.
+const (
+	batchStatusOK       = "ok"
+	batchStatusFailed   = "failed"   // The session exited non-zero
+	batchStatusTimeout  = "timeout"  // Stopped after the task's timeout
+	batchStatusCanceled = "canceled" // Interrupted, or never started
+	batchStatusError    = "error"    // The sandbox could not be launched, or the push failed
+)
+
+// batchFile is the YAML file read by `cc-sandbox batch`. Top-level image, env
+// and timeout apply to every task unless the task sets its own.
+type batchFile struct {
+	Concurrency int           `yaml:"concurrency"`
+	Timeout     time.Duration `yaml:"timeout"`
+	Image       string        `yaml:"image"`
+	Env         []string      `yaml:"env"`
+	Tasks       []batchTask   `yaml:"tasks"`
+}
+
+// batchTask is one headless session: a prompt run in a workdir or a clone of repo.
+type batchTask struct {
+	Name       string        `yaml:"name"`
+	Workdir    string        `yaml:"workdir"`
+	Repo       string        `yaml:"repo"`
+	Branch     string        `yaml:"branch"`
+	PushBranch string        `yaml:"push_branch"`
+	Prompt     string        `yaml:"prompt"`
+	Image      string        `yaml:"image"`
+	Env        []string      `yaml:"env"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+// batchResult is the outcome of one task, as printed and written to the report.
+type batchResult struct {
+	Name     string  `json:"name"`
+	Workdir  string  `json:"workdir,omitempty"`
+	Repo     string  `json:"repo,omitempty"`
+	Status   string  `json:"status"`
+	ExitCode int     `json:"exit_code"` // -1 if the session never exited on its own
+	Duration float64 `json:"duration_seconds"`
+	Log      string  `json:"log"`
+	Session  string  `json:"session,omitempty"`     // Isolated session to review with diff and apply
+	Network  string  `json:"network_log,omitempty"` // Allowlist proxy log, for --network-policy allowlist
+	Error    string  `json:"error,omitempty"`
+}
+
+// batchReport is the JSON report written when a batch finishes.
+type batchReport struct {
+	File     string        `json:"file"`
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	Tasks    []batchResult `json:"tasks"`
+}
+
+// loadBatchFile reads and validates a batch file. Relative workdirs are
+// resolved against the file's directory, and unnamed tasks are named after
+// their workdir or repository.
+func loadBatchFile(path string) (*batchFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bf := &batchFile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(bf); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	baseDir := filepath.Dir(absPath)
+	for i := range bf.Tasks {
+		task := &bf.Tasks[i]
+		if task.Workdir != "" {
+			task.Workdir = resolveHostPath(task.Workdir, baseDir)
+		}
+		if task.Name == "" {
+			task.Name = defaultBatchTaskName(*task)
+		}
+	}
+
+	if err := bf.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return bf, nil
+}
+
+// defaultBatchTaskName names a task after the last element of its workdir or
+// repository URL, e.g. "api" for git@github.com:org/api.git.
+func defaultBatchTaskName(task batchTask) string {
+	if task.Workdir != "" {
+		return filepath.Base(task.Workdir)
+	}
+	name := path.Base(strings.TrimSuffix(task.Repo, "/"))
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, ".git")
+}
+
+func (bf *batchFile) validate() error {
+	if len(bf.Tasks) == 0 {
+		return errors.New("no tasks")
+	}
+	if bf.Concurrency < 0 || bf.Timeout < 0 {
+		return errors.New("concurrency and timeout must not be negative")
+	}
+	seen := make(map[string]bool)
+	for i, task := range bf.Tasks {
+		if !sandboxNamePattern.MatchString(task.Name) {
+			return fmt.Errorf("task %d: invalid name %q: use letters, digits, '-', '_' and '.'", i+1, task.Name)
+		}
+		if seen[task.Name] {
+			return fmt.Errorf("task %d: duplicate name %q; give the tasks distinct names", i+1, task.Name)
+		}
+		seen[task.Name] = true
+
+		switch {
+		case strings.TrimSpace(task.Prompt) == "":
+			return fmt.Errorf("task %s: prompt is required", task.Name)
+		case (task.Workdir == "") == (task.Repo == ""):
+			return fmt.Errorf("task %s: set exactly one of workdir and repo", task.Name)
+		case task.Workdir != "" && !dirExists(task.Workdir):
+			return fmt.Errorf("task %s: workdir %s does not exist", task.Name, task.Workdir)
+		case task.Repo == "" && (task.Branch != "" || task.PushBranch != ""):
+			return fmt.Errorf("task %s: branch and push_branch require repo", task.Name)
+		case task.Timeout < 0:
+			return fmt.Errorf("task %s: timeout must not be negative", task.Name)
+		}
+	}
+	return nil
+}
+
+// taskConfig returns the sandbox config of task: the batch command's flags,
+// overridden by the file's top-level settings and then by the task's own.
+// The returned flagChanged reports the task's settings as set by flag, so
+// config files don't override them.
+func taskConfig(base *Config, bf *batchFile, task batchTask, flagChanged func(string) bool) (*Config, func(string) bool) {
+	cfg := *base
+	cfg.sources = nil
+	cfg.Mounts = append([]string(nil), base.Mounts...)
+	cfg.EnvVars = append(append(append([]string(nil), base.EnvVars...), bf.Env...), task.Env...)
+	cfg.Interactive = false
+
+	cfg.Workdir = task.Workdir
+	cfg.Repo, cfg.RepoBranch, cfg.PushBranch = task.Repo, task.Branch, task.PushBranch
+
+	set := make(map[string]bool)
+	for _, image := range []string{bf.Image, task.Image} {
+		if image != "" {
+			cfg.Image = image
+			set["image"] = true
+		}
+	}
+
+	return &cfg, func(name string) bool { return set[name] || flagChanged(name) }
+}
+
+// taskTimeout returns the timeout of task; zero means none.
+func taskTimeout(bf *batchFile, task batchTask, defaultTimeout time.Duration) time.Duration {
+	if task.Timeout > 0 {
+		return task.Timeout
+	}
+	if bf.Timeout > 0 {
+		return bf.Timeout
+	}
+	return defaultTimeout
+}
+
+// runBatch calls run for each task, at most concurrency at a time, and returns
+// the results in task order. Tasks not yet started when ctx is canceled are
+// reported as canceled.
+func runBatch(ctx context.Context, tasks []batchTask, concurrency int, run func(context.Context, batchTask) batchResult) []batchResult {
+	results := make([]batchResult, len(tasks))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, task := range tasks {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			results[i] = batchResult{Name: task.Name, Workdir: task.Workdir, Repo: task.Repo, Status: batchStatusCanceled, ExitCode: -1}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, task batchTask) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = run(ctx, task)
+		}(i, task)
+	}
+	wg.Wait()
+	return results
+}
+
+// batchRunner runs the tasks of one batch in sandboxes.
+type batchRunner struct {
+	base        *Config
+	file        *batchFile
+	flagChanged func(string) bool
+	outputDir   string
+
+	// Serializes config resolution and image pulls, so tasks sharing an
+	// image pull it once
+	launchMu sync.Mutex
+}
+
+// runTask runs task as a headless `claude -p` session, with its output in
+// <outputDir>/<name>.log. The session is stopped when the task times out or
+// ctx is canceled.
+func (r *batchRunner) runTask(ctx context.Context, task batchTask) (result batchResult) {
+	result = batchResult{
+		Name:     task.Name,
+		Workdir:  task.Workdir,
+		Repo:     task.Repo,
+		ExitCode: -1,
+		Log:      filepath.Join(r.outputDir, task.Name+".log"),
+	}
+	started := time.Now()
+	defer func() {
+		result.Duration = time.Since(started).Round(time.Millisecond).Seconds()
+		fmt.Fprintf(os.Stderr, "[%s] %s\n", task.Name, describeBatchResult(result))
+	}()
+	fail := func(err error) batchResult {
+		result.Status, result.Error = batchStatusError, err.Error()
+		return result
+	}
+
+	logFile, err := os.Create(result.Log)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create log: %w", err))
+	}
+	defer func() { _ = logFile.Close() }()
+
+	cfg, flagChanged := taskConfig(r.base, r.file, task, r.flagChanged)
+	r.launchMu.Lock()
+	runtime, imageName, err := prepareLaunch(cfg, flagChanged, newPhaseTimer(false))
+	r.launchMu.Unlock()
+	if err != nil {
+		return fail(err)
+	}
+	result.Session = cfg.Session
+	sessionRan := false
+	if cfg.RepoVolume != "" {
+		// Once the session has run, finishRepoSession removes or keeps the clone
+		defer func() {
+			if !sessionRan {
+				removeRepoVolume(runtime, cfg.RepoVolume)
+			}
+		}()
+	}
+	if ctx.Err() != nil {
+		result.Status = batchStatusCanceled
+		return result
+	}
+
+	lock, err := lockWorkspace(cfg, runtime)
+	if err != nil {
+		return fail(err)
+	}
+	defer lock.release()
+
+	proxy, err := startDockerProxy(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	defer proxy.close()
+
+	netProxy, err := startNetworkProxy(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	defer netProxy.close()
+	result.Network = cfg.NetworkLog
+
+	if secrets := collectSecretEnv(cfg); len(secrets) > 0 {
+		dir, cleanup, err := writeSecretsDir(secrets)
+		if err != nil {
+			return fail(err)
+		}
+		defer cleanup()
+		cfg.SecretsDir = dir
+	}
+
+	cidDir, err := os.MkdirTemp("", "cc-sandbox-cid-")
+	if err != nil {
+		return fail(fmt.Errorf("failed to create container ID directory: %w", err))
+	}
+	defer func() { _ = os.RemoveAll(cidDir) }()
+	cfg.CIDFile = filepath.Join(cidDir, "cid")
+
+	containerArgs := buildContainerArgs(cfg, runtime, imageName, []string{"claude", "-p", task.Prompt})
+	containerCmd := exec.Command(runtime, containerArgs...)
+	containerCmd.Stdout = logFile
+	containerCmd.Stderr = logFile
+	// Ctrl-C reaches the sessions through the batch, which stops them
+	detachFromTerminalSignals(containerCmd)
+	if err := containerCmd.Start(); err != nil {
+		return fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "[%s] started\n", task.Name)
+
+	taskCtx, cancel := ctx, context.CancelFunc(func() {})
+	// --timeout and the timeout config key apply to tasks that set none
+	defaultTimeout, _ := parseSessionTimeout(cfg.Timeout)
+	if timeout := taskTimeout(r.file, task, defaultTimeout); timeout > 0 {
+		taskCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	var sessionErr error
+	exited := make(chan struct{})
+	go func() {
+		sessionErr = containerCmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-taskCtx.Done():
+		// Killing the runtime CLI before the container exists would leave
+		// the container running, so wait for it to be created
+		if !waitForCIDFile(cfg.CIDFile, exited) {
+			break
+		}
+		stopContainerFromCIDFile(runtime, cfg.CIDFile, interruptGracePeriod)
+		select {
+		case <-exited:
+		case <-time.After(interruptGracePeriod):
+			removeContainerFromCIDFile(runtime, cfg.CIDFile)
+			_ = containerCmd.Process.Kill()
+			<-exited
+		}
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		result.Status = batchStatusCanceled
+	case taskCtx.Err() != nil:
+		result.Status = batchStatusTimeout
+	case sessionErr == nil:
+		result.Status = batchStatusOK
+		result.ExitCode = 0
+	default:
+		result.Status = batchStatusFailed
+		result.Error = sessionErr.Error()
+		result.ExitCode = exitCodeOf(commandExitError(sessionErr))
+	}
+	if result.Status != batchStatusOK && sessionErr == nil {
+		sessionErr = errors.New(result.Status)
+	}
+
+	sessionRan = true
+	if cfg.RepoVolume != "" {
+		if err := finishRepoSession(cfg, runtime, imageName, sessionErr, logFile); err != nil && result.Status == batchStatusOK {
+			result.Status, result.Error = batchStatusError, err.Error()
+		}
+	}
+	return result
+}
+
+// describeBatchResult returns the progress line for a finished task.
+func describeBatchResult(r batchResult) string {
+	duration := time.Duration(r.Duration * float64(time.Second)).Round(time.Second)
+	switch r.Status {
+	case batchStatusOK:
+		return fmt.Sprintf("ok in %s", duration)
+	case batchStatusFailed:
+		return fmt.Sprintf("failed with exit code %d after %s, see %s", r.ExitCode, duration, r.Log)
+	case batchStatusTimeout:
+		return fmt.Sprintf("timed out after %s, see %s", duration, r.Log)
+	case batchStatusCanceled:
+		return "canceled"
+	default:
+		return "error: " + r.Error
+	}
+}
+
+func printBatchSummary(w io.Writer, results []batchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TASK\tSTATUS\tEXIT\tDURATION\tLOG")
+	for _, r := range results {
+		exitCode := "-"
+		if r.ExitCode >= 0 {
+			exitCode = fmt.Sprint(r.ExitCode)
+		}
+		duration := time.Duration(r.Duration * float64(time.Second)).Round(time.Second)
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.Status, exitCode, duration, r.Log)
+	}
+	return tw.Flush()
+}
+
+func writeBatchReport(path string, report batchReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// newBatchCmd creates the batch subcommand.
+func newBatchCmd() *cobra.Command {
+	cfg := &Config{}
+	var rootFlag, outputDir string
+	var concurrency int
+
+	cmd := &cobra.Command{
+		Use:   "batch <file>",
+		Short: "Run the headless tasks of a batch file in parallel sandboxes",
+		Long: `Run each task of a YAML batch file as a headless "claude -p" session in its
+own sandbox, a few at a time. Each task runs its prompt in a workdir or in a
+clone of a repository. The flags set defaults for every task; image, env and
+timeout in the file override them.
+
+Each task's output goes to <output-dir>/<task>.log. When all tasks are done,
+a summary table is printed and a JSON report written to <output-dir>/report.json.
+The command fails if any task did not succeed.
+
+Example batch file:
+  concurrency: 4
+  timeout: 30m
+  env: [CI=1]
+  tasks:
+    - workdir: ../services/api
+      prompt: Upgrade the logging library to v2 and fix the call sites
+    - name: web
+      repo: git@github.com:org/web.git
+      push_branch: claude/logging-v2
+      prompt: Upgrade the logging library to v2 and fix the call sites
+      image: bun
+
+Examples:
+  cc-sandbox batch tasks.yaml
+  cc-sandbox batch -j 8 --timeout 1h tasks.yaml`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg.Root = parseRootFlag(rootFlag)
+			bf, err := loadBatchFile(args[0])
+			if err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("concurrency") {
+				concurrency = bf.Concurrency
+			}
+			if concurrency <= 0 {
+				concurrency = defaultBatchConcurrency
+			}
+
+			started := time.Now()
+			if outputDir == "" {
+				outputDir = "cc-sandbox-batch-" + started.Format("20060102-150405")
+			}
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), interruptSignals...)
+			defer stop()
+
+			runner := &batchRunner{
+				base:        cfg,
+				file:        bf,
+				flagChanged: cmd.Flags().Changed,
+				outputDir:   outputDir,
+			}
+			fmt.Fprintf(os.Stderr, "Running %d task(s), %d at a time, output in %s\n", len(bf.Tasks), concurrency, outputDir)
+			results := runBatch(ctx, bf.Tasks, concurrency, runner.runTask)
+
+			report := batchReport{File: args[0], Started: started, Finished: time.Now(), Tasks: results}
+			reportPath := filepath.Join(outputDir, "report.json")
+			if err := writeBatchReport(reportPath, report); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
+			}
+			if err := printBatchSummary(os.Stdout, results); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Report written to %s\n", reportPath)
+
+			var failed int
+			for _, r := range results {
+				if r.Status != batchStatusOK {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d task(s) did not succeed", failed, len(results))
+			}
+			return nil
+		},
+	}
+
+	addSandboxFlags(cmd, cfg, &rootFlag)
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "j", 0, "Tasks to run at once (default: the file's concurrency, or 4)")
+	cmd.Flags().StringVar(&outputDir, "output-dir", "", "Directory for task logs and the report (default: cc-sandbox-batch-<timestamp>)")
+
+	return cmd
+}
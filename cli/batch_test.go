@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeBatchFile(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "tasks.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadBatchFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "services", "api"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := writeBatchFile(t, dir, `concurrency: 2
+timeout: 30m
+image: bun
+env: [CI=1]
+tasks:
+  - workdir: ./services/api
+    prompt: upgrade the logger
+  - repo: git@github.com:org/web.git
+    push_branch: claude/logger
+    prompt: upgrade the logger
+    timeout: 1h
+    env: [NODE_ENV=test]
+`)
+
+	bf, err := loadBatchFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bf.Concurrency != 2 || bf.Timeout != 30*time.Minute || bf.Image != "bun" || len(bf.Tasks) != 2 {
+		t.Fatalf("loadBatchFile() = %+v", bf)
+	}
+	api, web := bf.Tasks[0], bf.Tasks[1]
+	if api.Name != "api" || api.Workdir != filepath.Join(dir, "services", "api") {
+		t.Errorf("workdir task = %+v, want name api and the workdir resolved against the file", api)
+	}
+	if web.Name != "web" || web.Timeout != time.Hour || web.PushBranch != "claude/logger" {
+		t.Errorf("repo task = %+v, want name web and its own timeout", web)
+	}
+}
+
+func TestLoadBatchFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"no tasks", "concurrency: 2\n"},
+		{"unknown key", "tasks:\n  - repo: r\n    prompt: p\n    promt: p\n"},
+		{"no prompt", "tasks:\n  - repo: git@github.com:org/api.git\n"},
+		{"neither workdir nor repo", "tasks:\n  - name: x\n    prompt: p\n"},
+		{"both workdir and repo", "tasks:\n  - workdir: .\n    repo: r\n    prompt: p\n"},
+		{"missing workdir", "tasks:\n  - workdir: ./nope\n    prompt: p\n"},
+		{"duplicate names", "tasks:\n  - repo: a/api.git\n    prompt: p\n  - repo: b/api.git\n    prompt: p\n"},
+		{"invalid name", "tasks:\n  - name: a b\n    repo: r\n    prompt: p\n"},
+		{"branch without repo", "tasks:\n  - workdir: .\n    branch: dev\n    prompt: p\n"},
+		{"bad timeout", "tasks:\n  - repo: r\n    prompt: p\n    timeout: soon\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeBatchFile(t, t.TempDir(), tt.content)
+			if _, err := loadBatchFile(path); err == nil {
+				t.Error("loadBatchFile() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestDefaultBatchTaskName(t *testing.T) {
+	tests := []struct {
+		task batchTask
+		want string
+	}{
+		{batchTask{Workdir: "/src/services/api"}, "api"},
+		{batchTask{Repo: "git@github.com:org/web.git"}, "web"},
+		{batchTask{Repo: "git@github.com:web.git"}, "web"},
+		{batchTask{Repo: "https://github.com/org/billing/"}, "billing"},
+	}
+	for _, tt := range tests {
+		if got := defaultBatchTaskName(tt.task); got != tt.want {
+			t.Errorf("defaultBatchTaskName(%+v) = %q, want %q", tt.task, got, tt.want)
+		}
+	}
+}
+
+func TestTaskConfig(t *testing.T) {
+	base := &Config{Image: "base", EnvVars: []string{"FROM_FLAG=1"}, Mounts: []string{"/data:/data"}, Interactive: true}
+	bf := &batchFile{Image: "docker", Env: []string{"FROM_FILE=1"}}
+	noFlags := func(string) bool { return false }
+
+	cfg, flagChanged := taskConfig(base, bf, batchTask{Workdir: "/src/api", Env: []string{"FROM_TASK=1"}}, noFlags)
+	if cfg.Workdir != "/src/api" || cfg.Image != "docker" || cfg.Interactive {
+		t.Errorf("taskConfig() = %+v, want the task's workdir, the file's image and no TTY", cfg)
+	}
+	if got := joinArgs(cfg.EnvVars); got != "FROM_FLAG=1 FROM_FILE=1 FROM_TASK=1 " {
+		t.Errorf("taskConfig() env = %q, want flag, file and task env in that order", got)
+	}
+	if !flagChanged("image") || flagChanged("mount") {
+		t.Error("taskConfig() flagChanged must report the image as set and leave other flags alone")
+	}
+
+	cfg, _ = taskConfig(base, bf, batchTask{Repo: "git@github.com:org/web.git", Branch: "dev", Image: "bun"}, noFlags)
+	if cfg.Repo != "git@github.com:org/web.git" || cfg.RepoBranch != "dev" || cfg.Workdir != "" || cfg.Image != "bun" {
+		t.Errorf("taskConfig() = %+v, want the task's repo and image", cfg)
+	}
+
+	// Tasks must not share the base config's slices
+	cfg.EnvVars[0] = "CHANGED=1"
+	cfg.Mounts[0] = "/changed:/changed"
+	if base.EnvVars[0] != "FROM_FLAG=1" || base.Mounts[0] != "/data:/data" {
+		t.Error("taskConfig() shares slices with the base config")
+	}
+}
+
+func TestTaskTimeout(t *testing.T) {
+	bf := &batchFile{Timeout: time.Hour}
+	if got := taskTimeout(bf, batchTask{Timeout: time.Minute}, time.Second); got != time.Minute {
+		t.Errorf("task timeout = %v, want the task's own", got)
+	}
+	if got := taskTimeout(bf, batchTask{}, time.Second); got != time.Hour {
+		t.Errorf("task timeout = %v, want the file's", got)
+	}
+	if got := taskTimeout(&batchFile{}, batchTask{}, time.Second); got != time.Second {
+		t.Errorf("task timeout = %v, want the flag's", got)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	tasks := []batchTask{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}}
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	results := runBatch(context.Background(), tasks, 2, func(_ context.Context, task batchTask) batchResult {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return batchResult{Name: task.Name, Status: batchStatusOK}
+	})
+
+	if maxRunning != 2 {
+		t.Errorf("%d tasks ran at once, want 2", maxRunning)
+	}
+	for i, r := range results {
+		if r.Name != tasks[i].Name || r.Status != batchStatusOK {
+			t.Errorf("results[%d] = %+v, want task %s ok", i, r, tasks[i].Name)
+		}
+	}
+}
+
+func TestRunBatchCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tasks := []batchTask{{Name: "first"}, {Name: "second"}, {Name: "third"}}
+
+	results := runBatch(ctx, tasks, 1, func(ctx context.Context, task batchTask) batchResult {
+		cancel()
+		<-ctx.Done()
+		return batchResult{Name: task.Name, Status: batchStatusCanceled}
+	})
+
+	for i, r := range results {
+		if r.Name != tasks[i].Name || r.Status != batchStatusCanceled {
+			t.Errorf("results[%d] = %+v, want task %s canceled", i, r, tasks[i].Name)
+		}
+	}
+	if results[2].ExitCode != -1 {
+		t.Errorf("task that never started has exit code %d, want -1", results[2].ExitCode)
+	}
+}
+
+func TestPrintBatchSummary(t *testing.T) {
+	var buf bytes.Buffer
+	err := printBatchSummary(&buf, []batchResult{
+		{Name: "api", Status: batchStatusOK, Duration: 192.4, Log: "out/api.log"},
+		{Name: "web", Status: batchStatusTimeout, ExitCode: -1, Duration: 1800, Log: "out/web.log"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"TASK", "api", "3m12s", "out/api.log", "timeout", "30m0s"} {
+		if !contains(out, want) {
+			t.Errorf("summary missing %q:\n%s", want, out)
+		}
+	}
+}
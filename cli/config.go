@@ -0,0 +1,551 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Setting sources reported by `cc-sandbox config show`.
+const (
+	SourceDefault = "default"
+	SourceAuto    = "auto-detected"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// valueSource records where a resolved setting came from.
+type valueSource struct {
+	Kind   string `json:"source"`
+	Origin string `json:"origin,omitempty"` // File path, env var or flag name
+}
+
+// configKey describes a setting that can be set in config files.
+type configKey struct {
+	Key   string // Key in config files
+	Field string // Field name in both Config and FileConfig
+	Flag  string // Root command flag, if any
+	Env   string // CC_SANDBOX_* environment variable, if any
+}
+
+// configKeys lists every config file key, in display order.
+var configKeys = []configKey{
+	{"image", "Image", "image", "CC_SANDBOX_DEFAULT_IMAGE"},
+	{"registry", "Registry", "", "CC_SANDBOX_REGISTRY"},
+	{"docker_socket", "DockerSocket", "", "CC_SANDBOX_DOCKER_SOCKET"},
+	{"docker_proxy", "DockerProxy", "docker-proxy", ""},
+	{"docker_allow", "DockerAllow", "docker-allow", ""},
+	{"mounts", "Mounts", "mount", ""},
+	{"env", "EnvVars", "env", ""},
+	{"docker", "MountDocker", "docker", ""},
+	{"git", "MountGit", "git", ""},
+	{"gh", "MountGH", "gh", ""},
+	{"ssh", "MountSSH", "ssh", ""},
+	{"root", "Root", "root", "CC_SANDBOX_ROOT"},
+	{"runtime", "Runtime", "runtime", "CC_SANDBOX_RUNTIME"},
+	{"git_user_name", "GitUserName", "git-user-name", "CC_SANDBOX_GIT_USER_NAME"},
+	{"git_user_email", "GitUserEmail", "git-user-email", "CC_SANDBOX_GIT_USER_EMAIL"},
+	{"host_network", "HostNetwork", "host-network", ""},
+	{"network_policy", "NetworkPolicy", "network-policy", "CC_SANDBOX_NETWORK_POLICY"},
+	{"network_allow", "NetworkAllow", "network-allow", ""},
+	{"memory", "Memory", "memory", ""},
+	{"cpus", "CPUs", "cpus", ""},
+	{"pids_limit", "PidsLimit", "pids-limit", ""},
+	{"disk", "Disk", "disk", ""},
+	{"timeout", "Timeout", "timeout", ""},
+	{"hardened", "Hardened", "hardened", ""},
+	{"claude_config", "ClaudeConfigPath", "claude-config", "CC_SANDBOX_CLAUDE_CONFIG"},
+	{"claude_config_repo", "ClaudeConfigRepo", "claude-config-repo", "CC_SANDBOX_CLAUDE_CONFIG_REPO"},
+	{"claude_config_sync", "ClaudeConfigSync", "claude-config-sync", ""},
+	{"account", "Account", "account", "CC_SANDBOX_ACCOUNT"},
+	{"provider", "Provider", "provider", "CC_SANDBOX_PROVIDER"},
+}
+
+// lookupConfigKey returns the config key with the given name.
+func lookupConfigKey(name string) (configKey, bool) {
+	for _, k := range configKeys {
+		if k.Key == name {
+			return k, true
+		}
+	}
+	return configKey{}, false
+}
+
+// setByFlag reports whether the key's flag was set on the command line.
+func (k configKey) setByFlag(flagChanged func(string) bool) bool {
+	return k.Flag != "" && flagChanged(k.Flag)
+}
+
+// kind returns the value kind stored in FileConfig: reflect.String, reflect.Bool or reflect.Slice.
+func (k configKey) kind() reflect.Kind {
+	field, _ := reflect.TypeOf(FileConfig{}).FieldByName(k.Field)
+	if field.Type.Kind() == reflect.Ptr {
+		return field.Type.Elem().Kind()
+	}
+	return field.Type.Kind()
+}
+
+func (k configKey) isList() bool {
+	return k.kind() == reflect.Slice
+}
+
+// setSource records the source of a scalar setting, replacing earlier ones.
+func (cfg *Config) setSource(key string, src valueSource) {
+	if cfg.sources == nil {
+		cfg.sources = make(map[string][]valueSource)
+	}
+	cfg.sources[key] = []valueSource{src}
+}
+
+// addSource records the source of one more list entry.
+func (cfg *Config) addSource(key string, src valueSource) {
+	if cfg.sources == nil {
+		cfg.sources = make(map[string][]valueSource)
+	}
+	cfg.sources[key] = append(cfg.sources[key], src)
+}
+
+// sourceOf returns where a scalar setting came from.
+func (cfg *Config) sourceOf(key string) valueSource {
+	if srcs := cfg.sources[key]; len(srcs) > 0 {
+		return srcs[len(srcs)-1]
+	}
+	return valueSource{Kind: SourceDefault}
+}
+
+// projectConfigNames lists the per-project config file names, in lookup order.
+var projectConfigNames = []string{".cc-sandbox.yaml", ".cc-sandbox.yml", ".cc-sandbox.toml"}
+
+// userConfigFile is the user-level config file name inside the config directory.
+const userConfigFile = "config.yaml"
+
+// UserConfig is the user-level config file (~/.config/cc-sandbox/config.yaml).
+// Default applies to every run; a profile is layered on top when selected.
+type UserConfig struct {
+	Profile  string                 `yaml:"profile"`
+	Default  FileConfig             `yaml:"default"`
+	Profiles map[string]*FileConfig `yaml:"profiles"`
+	Images   map[string]*FileConfig `yaml:"images"` // Defaults per image (see applyImageDefaults)
+	Tasks    map[string]*taskRecipe `yaml:"tasks"`  // Recipes for `cc-sandbox task` (see task.go)
+}
+
+// projectConfig is a project config file: sandbox settings and task recipes.
+type projectConfig struct {
+	FileConfig `yaml:",inline"`
+	Tasks      map[string]*taskRecipe `yaml:"tasks" toml:"tasks"`
+
+	trusted bool // Content trusted with `cc-sandbox config trust`
+}
+
+// FileConfig holds settings loaded from a config file.
+// Pointer fields distinguish "not set" from zero values.
+type FileConfig struct {
+	Image            *string  `yaml:"image" toml:"image"`
+	Registry         *string  `yaml:"registry" toml:"registry"`
+	DockerSocket     *string  `yaml:"docker_socket" toml:"docker_socket"`
+	DockerProxy      *bool    `yaml:"docker_proxy" toml:"docker_proxy"`
+	DockerAllow      []string `yaml:"docker_allow" toml:"docker_allow"`
+	Mounts           []string `yaml:"mounts" toml:"mounts"`
+	EnvVars          []string `yaml:"env" toml:"env"`
+	MountDocker      *bool    `yaml:"docker" toml:"docker"`
+	MountGit         *bool    `yaml:"git" toml:"git"`
+	MountGH          *bool    `yaml:"gh" toml:"gh"`
+	MountSSH         *bool    `yaml:"ssh" toml:"ssh"`
+	Root             *string  `yaml:"root" toml:"root"`
+	Runtime          *string  `yaml:"runtime" toml:"runtime"`
+	GitUserName      *string  `yaml:"git_user_name" toml:"git_user_name"`
+	GitUserEmail     *string  `yaml:"git_user_email" toml:"git_user_email"`
+	HostNetwork      *bool    `yaml:"host_network" toml:"host_network"`
+	NetworkPolicy    *string  `yaml:"network_policy" toml:"network_policy"`
+	NetworkAllow     []string `yaml:"network_allow" toml:"network_allow"`
+	Memory           *string  `yaml:"memory" toml:"memory"`
+	CPUs             *string  `yaml:"cpus" toml:"cpus"`
+	PidsLimit        *string  `yaml:"pids_limit" toml:"pids_limit"`
+	Disk             *string  `yaml:"disk" toml:"disk"`
+	Timeout          *string  `yaml:"timeout" toml:"timeout"`
+	Hardened         *bool    `yaml:"hardened" toml:"hardened"`
+	ClaudeConfigPath *string  `yaml:"claude_config" toml:"claude_config"`
+	ClaudeConfigRepo *string  `yaml:"claude_config_repo" toml:"claude_config_repo"`
+	ClaudeConfigSync *bool    `yaml:"claude_config_sync" toml:"claude_config_sync"`
+	Account          *string  `yaml:"account" toml:"account"`
+	Provider         *string  `yaml:"provider" toml:"provider"`
+}
+
+// findProjectConfig walks up from dir looking for a project config file.
+// Returns an empty string if none is found.
+func findProjectConfig(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	for {
+		for _, name := range projectConfigNames {
+			path := filepath.Join(dir, name)
+			if fileExists(path) {
+				return path
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadFileConfig reads the sandbox settings of a YAML or TOML config file.
+func loadFileConfig(path string) (*FileConfig, error) {
+	pc, err := loadProjectConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return &pc.FileConfig, nil
+}
+
+// loadProjectConfig reads a YAML or TOML config file, chosen by extension.
+// Unknown keys are rejected so typos don't silently get ignored.
+func loadProjectConfig(path string) (*projectConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fc := &projectConfig{}
+	if strings.HasSuffix(path, ".toml") {
+		md, err := toml.Decode(string(data), fc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("failed to parse %s: unknown key %q", path, undecoded[0].String())
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(fc); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	fc.resolvePaths(filepath.Dir(path))
+	resolveRecipePaths(fc.Tasks, filepath.Dir(path))
+	fc.trusted = isProjectConfigTrusted(path, data)
+	return fc, nil
+}
+
+// getUserConfigPath returns the path of the user-level config file.
+// CC_SANDBOX_CONFIG_FILE overrides the default XDG location.
+func getUserConfigPath() string {
+	if path := os.Getenv("CC_SANDBOX_CONFIG_FILE"); path != "" {
+		return expandPath(path)
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "cc-sandbox", userConfigFile)
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "cc-sandbox", userConfigFile)
+}
+
+// loadUserConfig reads the user-level config file.
+// Returns nil without error if the file does not exist.
+func loadUserConfig(path string) (*UserConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	uc := &UserConfig{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(uc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	baseDir := filepath.Dir(path)
+	uc.Default.resolvePaths(baseDir)
+	for name, profile := range uc.Profiles {
+		if profile == nil {
+			uc.Profiles[name] = &FileConfig{}
+			continue
+		}
+		profile.resolvePaths(baseDir)
+	}
+	for _, image := range uc.Images {
+		if image != nil {
+			image.resolvePaths(baseDir)
+		}
+	}
+	resolveRecipePaths(uc.Tasks, baseDir)
+	return uc, nil
+}
+
+// selectProfile picks the profile to apply.
+// Priority: --profile flag > CC_SANDBOX_PROFILE > "profile" key in the user config.
+func selectProfile(cfg *Config, uc *UserConfig) (*FileConfig, error) {
+	switch {
+	case cfg.Profile != "":
+		cfg.setSource("profile", valueSource{Kind: SourceFlag, Origin: "--profile"})
+	case os.Getenv("CC_SANDBOX_PROFILE") != "":
+		cfg.Profile = os.Getenv("CC_SANDBOX_PROFILE")
+		cfg.setSource("profile", valueSource{Kind: SourceEnv, Origin: "CC_SANDBOX_PROFILE"})
+	case uc != nil && uc.Profile != "":
+		cfg.Profile = uc.Profile
+		cfg.setSource("profile", valueSource{Kind: SourceFile, Origin: getUserConfigPath()})
+	default:
+		return nil, nil
+	}
+
+	if uc != nil {
+		if profile, ok := uc.Profiles[cfg.Profile]; ok {
+			return profile, nil
+		}
+	}
+	return nil, fmt.Errorf("profile %q not found in %s", cfg.Profile, getUserConfigPath())
+}
+
+// resolvePaths makes relative host paths in the file relative to baseDir,
+// so a project file works the same from any subdirectory.
+func (fc *FileConfig) resolvePaths(baseDir string) {
+	for i, mount := range fc.Mounts {
+		fc.Mounts[i] = resolveHostPath(mount, baseDir)
+	}
+	if fc.ClaudeConfigPath != nil {
+		path := resolveHostPath(*fc.ClaudeConfigPath, baseDir)
+		fc.ClaudeConfigPath = &path
+	}
+}
+
+// resolveHostPath expands ~ and anchors ./ and ../ paths at baseDir.
+// For mount specs (host:container[:opts]) only the host part is changed.
+func resolveHostPath(spec, baseDir string) string {
+	host, rest, hasRest := strings.Cut(spec, ":")
+	host = expandPath(host)
+	if host == "." || host == ".." || strings.HasPrefix(host, "./") || strings.HasPrefix(host, "../") {
+		host = filepath.Join(baseDir, host)
+	}
+	if hasRest {
+		return host + ":" + rest
+	}
+	return host
+}
+
+// networkPolicyStrictness ranks the network policies from open to closed.
+var networkPolicyStrictness = map[string]int{
+	"":                     0,
+	networkPolicyOpen:      0,
+	networkPolicyAllowlist: 1,
+	networkPolicyNone:      2,
+}
+
+// dropUntrustedSettings removes the settings of an untrusted project file
+// that would weaken the sandbox or reach host files and credentials, and
+// returns their keys. The file comes with the repository, which anyone who
+// can push to it controls, including an agent in an earlier session. Those
+// settings only apply once the user trusts the file's content (see trust.go);
+// until then they are only read from the user config, profiles, env vars and
+// flags. Settings that tighten the sandbox are kept.
+func (fc *FileConfig) dropUntrustedSettings(cfg *Config) []string {
+	var dropped []string
+	drop := func(key string, untrusted bool, clear func()) {
+		if untrusted {
+			clear()
+			dropped = append(dropped, key)
+		}
+	}
+	isTrue := func(b *bool) bool { return b != nil && *b }
+	isFalse := func(b *bool) bool { return b != nil && !*b }
+
+	drop("registry", fc.Registry != nil, func() { fc.Registry = nil })
+	drop("image", fc.Image != nil && strings.Contains(*fc.Image, "/"), func() { fc.Image = nil })
+	drop("docker_socket", fc.DockerSocket != nil, func() { fc.DockerSocket = nil })
+	drop("docker_proxy", isFalse(fc.DockerProxy), func() { fc.DockerProxy = nil })
+	drop("docker_allow", len(fc.DockerAllow) > 0, func() { fc.DockerAllow = nil })
+	drop("mounts", len(fc.Mounts) > 0, func() { fc.Mounts = nil })
+	drop("env", len(fc.EnvVars) > 0, func() { fc.EnvVars = nil })
+	drop("gh", isTrue(fc.MountGH), func() { fc.MountGH = nil })
+	drop("ssh", isTrue(fc.MountSSH), func() { fc.MountSSH = nil })
+	drop("host_network", isTrue(fc.HostNetwork), func() { fc.HostNetwork = nil })
+	// An unknown policy is kept, so validation reports it
+	if fc.NetworkPolicy != nil {
+		strictness, ok := networkPolicyStrictness[*fc.NetworkPolicy]
+		drop("network_policy", ok && (strictness == 0 || strictness < networkPolicyStrictness[cfg.NetworkPolicy]), func() { fc.NetworkPolicy = nil })
+	}
+	drop("network_allow", len(fc.NetworkAllow) > 0, func() { fc.NetworkAllow = nil })
+	drop("hardened", isFalse(fc.Hardened), func() { fc.Hardened = nil })
+	drop("claude_config", fc.ClaudeConfigPath != nil, func() { fc.ClaudeConfigPath = nil })
+	drop("claude_config_repo", fc.ClaudeConfigRepo != nil, func() { fc.ClaudeConfigRepo = nil })
+	drop("account", fc.Account != nil, func() { fc.Account = nil })
+	drop("provider", fc.Provider != nil, func() { fc.Provider = nil })
+	return dropped
+}
+
+// warnUntrustedSettings reports the settings dropped from the untrusted
+// project file at path.
+func warnUntrustedSettings(settings []string, path string) {
+	fmt.Fprintf(os.Stderr, "Warning: ignoring %s in %s: the file isn't trusted; review it and run 'cc-sandbox config trust' to apply them\n",
+		strings.Join(settings, ", "), path)
+}
+
+// applyTo copies the settings present in the file onto cfg.
+// Fields whose flag was set on the command line are left untouched.
+// Mounts and env vars are appended rather than replaced.
+func (fc *FileConfig) applyTo(cfg *Config, flagChanged func(string) bool, src valueSource) {
+	cfgValue := reflect.ValueOf(cfg).Elem()
+	fileValue := reflect.ValueOf(fc).Elem()
+
+	for _, k := range configKeys {
+		value := fileValue.FieldByName(k.Field)
+		dst := cfgValue.FieldByName(k.Field)
+
+		switch {
+		case value.Kind() == reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				dst.Set(reflect.Append(dst, value.Index(i)))
+				cfg.addSource(k.Key, src)
+			}
+		case value.IsNil() || k.setByFlag(flagChanged):
+			continue
+		case k.Field == "Root":
+			cfg.Root = parseRootFlag(value.Elem().String())
+			cfg.setSource(k.Key, src)
+		default:
+			dst.Set(value.Elem())
+			cfg.setSource(k.Key, src)
+		}
+	}
+}
+
+// applyImageDefaults applies the user config's defaults for the sandbox's
+// image, e.g. a higher memory limit for bun-full. They replace only built-in
+// defaults and the user config's default section: a project file, profile,
+// env var or flag still wins. Lists are added as from any other layer, and an
+// image key in the section is ignored.
+func applyImageDefaults(cfg *Config, fc *FileConfig, flagChanged func(string) bool, userConfigPath string) {
+	defaults := *fc
+	defaults.Image = nil
+	value := reflect.ValueOf(&defaults).Elem()
+	for _, k := range configKeys {
+		field := value.FieldByName(k.Field)
+		if field.Kind() != reflect.Ptr {
+			continue
+		}
+		src := cfg.sourceOf(k.Key)
+		if src.Kind != SourceDefault && (src.Kind != SourceFile || src.Origin != userConfigPath) {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+	origin := fmt.Sprintf("%s, image %s", userConfigPath, cfg.Image)
+	defaults.applyTo(cfg, flagChanged, valueSource{Kind: SourceFile, Origin: origin})
+}
+
+// applyEnvConfig applies CC_SANDBOX_* environment variables onto cfg.
+// Fields whose flag was set on the command line are left untouched.
+func applyEnvConfig(cfg *Config, flagChanged func(string) bool) {
+	cfgValue := reflect.ValueOf(cfg).Elem()
+
+	for _, k := range configKeys {
+		value := os.Getenv(k.Env)
+		if k.Env == "" || value == "" || k.setByFlag(flagChanged) {
+			continue
+		}
+		if k.Field == "Root" {
+			cfg.Root = parseRootFlag(value)
+		} else {
+			cfgValue.FieldByName(k.Field).SetString(value)
+		}
+		cfg.setSource(k.Key, valueSource{Kind: SourceEnv, Origin: k.Env})
+	}
+}
+
+// resolveConfig merges all configuration sources into cfg.
+// Precedence (highest first): flags, CC_SANDBOX_* env vars, selected profile,
+// project file, user config defaults, built-in defaults.
+// A profile is picked per invocation, so it overrides the repository's file.
+// cfg must already hold the parsed flag values and a Workdir.
+func resolveConfig(cfg *Config, flagChanged func(string) bool) error {
+	if cfg.Runtime == "" {
+		cfg.Runtime = "auto"
+	}
+	cfg.Registry = DefaultRegistry
+
+	// Keep flag-provided lists last so they win over file entries
+	flagMounts, flagEnvVars := cfg.Mounts, cfg.EnvVars
+	cfg.Mounts, cfg.EnvVars = nil, nil
+
+	userConfigPath := getUserConfigPath()
+	userCfg, err := loadUserConfig(userConfigPath)
+	if err != nil {
+		return err
+	}
+	if userCfg != nil {
+		userCfg.Default.applyTo(cfg, flagChanged, valueSource{Kind: SourceFile, Origin: userConfigPath})
+	}
+
+	if path := findProjectConfig(cfg.Workdir); path != "" {
+		debugLog("Using project config: %s", path)
+		pc, err := loadProjectConfig(path)
+		if err != nil {
+			return err
+		}
+		if !pc.trusted {
+			if dropped := pc.dropUntrustedSettings(cfg); len(dropped) > 0 {
+				warnUntrustedSettings(dropped, path)
+			}
+		}
+		pc.applyTo(cfg, flagChanged, valueSource{Kind: SourceFile, Origin: path})
+	}
+
+	profile, err := selectProfile(cfg, userCfg)
+	if err != nil {
+		return err
+	}
+	if profile != nil {
+		debugLog("Using profile: %s", cfg.Profile)
+		origin := fmt.Sprintf("%s, profile %s", userConfigPath, cfg.Profile)
+		profile.applyTo(cfg, flagChanged, valueSource{Kind: SourceFile, Origin: origin})
+	}
+
+	applyEnvConfig(cfg, flagChanged)
+
+	if cfg.Image == "" {
+		cfg.Image = "base"
+	}
+	if userCfg != nil && userCfg.Images[cfg.Image] != nil {
+		applyImageDefaults(cfg, userCfg.Images[cfg.Image], flagChanged, userConfigPath)
+	}
+
+	cfg.Mounts = append(cfg.Mounts, flagMounts...)
+	cfg.EnvVars = append(cfg.EnvVars, flagEnvVars...)
+	for range flagMounts {
+		cfg.addSource("mounts", valueSource{Kind: SourceFlag, Origin: "--mount"})
+	}
+	for range flagEnvVars {
+		cfg.addSource("env", valueSource{Kind: SourceFlag, Origin: "--env"})
+	}
+	for _, k := range configKeys {
+		if k.setByFlag(flagChanged) && !k.isList() {
+			cfg.setSource(k.Key, valueSource{Kind: SourceFlag, Origin: "--" + k.Flag})
+		}
+	}
+
+	if cfg.DockerSocket == "" {
+		cfg.DockerSocket = getDefaultDockerSocket()
+		cfg.setSource("docker_socket", valueSource{Kind: SourceAuto})
+	}
+
+	return nil
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindProjectConfig(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := findProjectConfig(nested); got != "" {
+		t.Errorf("findProjectConfig() without file = %q, want empty", got)
+	}
+
+	tomlPath := filepath.Join(root, ".cc-sandbox.toml")
+	if err := os.WriteFile(tomlPath, []byte("image = \"docker\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := findProjectConfig(nested); got != tomlPath {
+		t.Errorf("findProjectConfig() = %q, want %q", got, tomlPath)
+	}
+
+	// Closer file wins over a parent one
+	yamlPath := filepath.Join(root, "a", ".cc-sandbox.yaml")
+	if err := os.WriteFile(yamlPath, []byte("image: base\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := findProjectConfig(nested); got != yamlPath {
+		t.Errorf("findProjectConfig() = %q, want %q", got, yamlPath)
+	}
+}
+
+func TestLoadFileConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		wantErr  bool
+		validate func(t *testing.T, fc *FileConfig)
+	}{
+		{
+			name: "yaml all kinds",
+			file: ".cc-sandbox.yaml",
+			content: `image: docker
+mounts:
+  - ./data:/data:ro
+  - cache:/cache
+env:
+  - DEBUG=1
+ssh: true
+git: false
+root: true
+claude_config: ./claude
+`,
+			validate: func(t *testing.T, fc *FileConfig) {
+				if fc.Image == nil || *fc.Image != "docker" {
+					t.Errorf("Image = %v, want docker", fc.Image)
+				}
+				wantMounts := []string{filepath.Join(tmpDir, "data") + ":/data:ro", "cache:/cache"}
+				if len(fc.Mounts) != 2 || fc.Mounts[0] != wantMounts[0] || fc.Mounts[1] != wantMounts[1] {
+					t.Errorf("Mounts = %v, want %v", fc.Mounts, wantMounts)
+				}
+				if fc.MountSSH == nil || !*fc.MountSSH {
+					t.Errorf("MountSSH = %v, want true", fc.MountSSH)
+				}
+				if fc.MountGit == nil || *fc.MountGit {
+					t.Errorf("MountGit = %v, want false", fc.MountGit)
+				}
+				if fc.Root == nil || *fc.Root != "true" {
+					t.Errorf("Root = %v, want \"true\"", fc.Root)
+				}
+				if fc.ClaudeConfigPath == nil || *fc.ClaudeConfigPath != filepath.Join(tmpDir, "claude") {
+					t.Errorf("ClaudeConfigPath = %v, want %s", fc.ClaudeConfigPath, filepath.Join(tmpDir, "claude"))
+				}
+			},
+		},
+		{
+			name:    "toml",
+			file:    ".cc-sandbox.toml",
+			content: "image = \"bun-full\"\nenv = [\"A=1\", \"B=2\"]\nhost_network = true\n",
+			validate: func(t *testing.T, fc *FileConfig) {
+				if fc.Image == nil || *fc.Image != "bun-full" {
+					t.Errorf("Image = %v, want bun-full", fc.Image)
+				}
+				if len(fc.EnvVars) != 2 {
+					t.Errorf("EnvVars = %v, want 2 entries", fc.EnvVars)
+				}
+				if fc.HostNetwork == nil || !*fc.HostNetwork {
+					t.Errorf("HostNetwork = %v, want true", fc.HostNetwork)
+				}
+			},
+		},
+		{
+			name:    "empty yaml",
+			file:    ".cc-sandbox.yaml",
+			content: "",
+			validate: func(t *testing.T, fc *FileConfig) {
+				if fc.Image != nil {
+					t.Errorf("Image = %v, want nil", *fc.Image)
+				}
+			},
+		},
+		{"unknown yaml key", ".cc-sandbox.yaml", "imgae: docker\n", true, nil},
+		{"unknown toml key", ".cc-sandbox.toml", "imgae = \"docker\"\n", true, nil},
+		{"wrong type", ".cc-sandbox.yaml", "ssh: [1]\n", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = os.Remove(path) }()
+
+			fc, err := loadFileConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadFileConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.validate != nil {
+				tt.validate(t, fc)
+			}
+		})
+	}
+}
+
+func TestResolveConfigPrecedence(t *testing.T) {
+	workdir := t.TempDir()
+	content := `image: docker
+runtime: podman
+git_user_name: File Name
+mounts:
+  - /file:/file
+env:
+  - FROM_FILE=1
+gh: false
+`
+	if err := os.WriteFile(filepath.Join(workdir, ".cc-sandbox.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	trustProjectConfig(t, workdir)
+
+	for _, key := range []string{"CC_SANDBOX_DEFAULT_IMAGE", "CC_SANDBOX_RUNTIME", "CC_SANDBOX_GIT_USER_NAME", "CC_SANDBOX_ROOT", "CC_SANDBOX_PROFILE"} {
+		_ = os.Unsetenv(key)
+	}
+	_ = os.Setenv("CC_SANDBOX_CONFIG_FILE", filepath.Join(workdir, "missing.yaml"))
+	defer func() { _ = os.Unsetenv("CC_SANDBOX_CONFIG_FILE") }()
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		flags       map[string]bool
+		cfg         Config
+		wantImage   string
+		wantRuntime string
+		wantGitName string
+		wantMountGH bool
+		wantMounts  []string
+	}{
+		{
+			name:        "file over defaults",
+			cfg:         Config{Runtime: "auto", MountGH: true},
+			wantImage:   "docker",
+			wantRuntime: "podman",
+			wantGitName: "File Name",
+			wantMountGH: false,
+			wantMounts:  []string{"/file:/file"},
+		},
+		{
+			name:        "env over file",
+			env:         map[string]string{"CC_SANDBOX_DEFAULT_IMAGE": "bun-full", "CC_SANDBOX_GIT_USER_NAME": "Env Name"},
+			cfg:         Config{Runtime: "auto", MountGH: true},
+			wantImage:   "bun-full",
+			wantRuntime: "podman",
+			wantGitName: "Env Name",
+			wantMountGH: false,
+			wantMounts:  []string{"/file:/file"},
+		},
+		{
+			name:        "flags over env and file",
+			env:         map[string]string{"CC_SANDBOX_DEFAULT_IMAGE": "bun-full", "CC_SANDBOX_RUNTIME": "podman"},
+			flags:       map[string]bool{"image": true, "runtime": true, "gh": true, "mount": true},
+			cfg:         Config{Image: "base", Runtime: "docker", MountGH: true, Mounts: []string{"/flag:/flag"}},
+			wantImage:   "base",
+			wantRuntime: "docker",
+			wantGitName: "File Name",
+			wantMountGH: true,
+			wantMounts:  []string{"/file:/file", "/flag:/flag"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				_ = os.Setenv(k, v)
+			}
+			defer func() {
+				for k := range tt.env {
+					_ = os.Unsetenv(k)
+				}
+			}()
+
+			cfg := tt.cfg
+			cfg.Workdir = workdir
+			if err := resolveConfig(&cfg, func(name string) bool { return tt.flags[name] }); err != nil {
+				t.Fatalf("resolveConfig() error = %v", err)
+			}
+
+			if cfg.Image != tt.wantImage {
+				t.Errorf("Image = %q, want %q", cfg.Image, tt.wantImage)
+			}
+			if cfg.Runtime != tt.wantRuntime {
+				t.Errorf("Runtime = %q, want %q", cfg.Runtime, tt.wantRuntime)
+			}
+			if cfg.GitUserName != tt.wantGitName {
+				t.Errorf("GitUserName = %q, want %q", cfg.GitUserName, tt.wantGitName)
+			}
+			if cfg.MountGH != tt.wantMountGH {
+				t.Errorf("MountGH = %v, want %v", cfg.MountGH, tt.wantMountGH)
+			}
+			if joinArgs(cfg.Mounts) != joinArgs(tt.wantMounts) {
+				t.Errorf("Mounts = %v, want %v", cfg.Mounts, tt.wantMounts)
+			}
+			if len(cfg.EnvVars) != 1 || cfg.EnvVars[0] != "FROM_FILE=1" {
+				t.Errorf("EnvVars = %v, want [FROM_FILE=1]", cfg.EnvVars)
+			}
+		})
+	}
+}
+
+func TestDropUntrustedSettings(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantDropped []string
+	}{
+		{"nothing to drop", "image: docker\ndocker_proxy: true\ngh: false\nmemory: 4g\n", nil},
+		{"registry", "registry: evil.example.com\n", []string{"registry"}},
+		{"image from elsewhere", "image: evil.example.com/claude\n", []string{"image"}},
+		{"docker socket", "docker_socket: /run/other.sock\n", []string{"docker_socket"}},
+		{"docker proxy off", "docker_proxy: false\n", []string{"docker_proxy"}},
+		{"docker allow", "docker_allow:\n  - privileged\n", []string{"docker_allow"}},
+		{"host network", "host_network: true\n", []string{"host_network"}},
+		{"stricter network policy", "network_policy: none\n", nil},
+		{"looser network policy", "network_policy: open\n", []string{"network_policy"}},
+		{"network allow", "network_policy: allowlist\nnetwork_allow:\n  - example.com\n", []string{"network_allow"}},
+		{"mounts", "mounts:\n  - ../../..:/host\n", []string{"mounts"}},
+		{"env", "env:\n  - ANTHROPIC_BASE_URL=https://evil.example.com\n", []string{"env"}},
+		{"gh", "gh: true\n", []string{"gh"}},
+		{"ssh", "ssh: true\n", []string{"ssh"}},
+		{"hardened off", "hardened: false\n", []string{"hardened"}},
+		{"hardened on", "hardened: true\n", nil},
+		{"claude config", "claude_config: ~/.claude\n", []string{"claude_config"}},
+		{"claude config repo", "claude_config_repo: https://evil.example.com/config.git\n", []string{"claude_config_repo"}},
+		{"account and provider", "account: work\nprovider: bedrock\n", []string{"account", "provider"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".cc-sandbox.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fc, err := loadFileConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The user config asked for an allowlist
+			cfg := Config{DockerProxy: true, NetworkPolicy: networkPolicyAllowlist}
+			if got := fc.dropUntrustedSettings(&cfg); joinArgs(got) != joinArgs(tt.wantDropped) {
+				t.Errorf("dropUntrustedSettings() = %v, want %v", got, tt.wantDropped)
+			}
+
+			fc.applyTo(&cfg, func(string) bool { return false }, valueSource{Kind: SourceFile, Origin: path})
+			if !cfg.DockerProxy || len(cfg.DockerAllow) > 0 || cfg.HostNetwork || len(cfg.NetworkAllow) > 0 ||
+				len(cfg.Mounts) > 0 || len(cfg.EnvVars) > 0 || cfg.MountGH || cfg.MountSSH ||
+				networkPolicyStrictness[cfg.NetworkPolicy] < networkPolicyStrictness[networkPolicyAllowlist] {
+				t.Errorf("project file weakened the sandbox: %+v", cfg)
+			}
+			for _, key := range tt.wantDropped {
+				if len(cfg.sources[key]) > 0 {
+					t.Errorf("%s was applied from the project file", key)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveConfigProfiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	userConfig := filepath.Join(tmpDir, "config.yaml")
+	content := `profile: work
+default:
+  ssh: true
+  registry: registry.example.com/team
+profiles:
+  work:
+    image: docker
+  untrusted:
+    ssh: false
+    gh: false
+    mounts:
+      - ./scratch:/scratch
+`
+	if err := os.WriteFile(userConfig, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Setenv("CC_SANDBOX_CONFIG_FILE", userConfig)
+	defer func() { _ = os.Unsetenv("CC_SANDBOX_CONFIG_FILE") }()
+	for _, key := range []string{"CC_SANDBOX_DEFAULT_IMAGE", "CC_SANDBOX_REGISTRY", "CC_SANDBOX_PROFILE"} {
+		_ = os.Unsetenv(key)
+	}
+
+	workdir := filepath.Join(tmpDir, "project")
+	if err := os.MkdirAll(workdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workdir, ".cc-sandbox.yaml"), []byte("image: bun-full\nssh: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		profile     string
+		envProfile  string
+		wantErr     bool
+		wantProfile string
+		wantImage   string
+		wantSSH     bool
+		wantGH      bool
+		wantMounts  int
+	}{
+		{"default profile from file", "", "", false, "work", "docker", true, true, 0},
+		{"flag selects profile", "untrusted", "", false, "untrusted", "bun-full", false, false, 1},
+		{"env selects profile", "", "untrusted", false, "untrusted", "bun-full", false, false, 1},
+		{"flag beats env", "work", "untrusted", false, "work", "docker", true, true, 0},
+		{"unknown profile", "missing", "", true, "", "", false, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.envProfile != "" {
+				_ = os.Setenv("CC_SANDBOX_PROFILE", tt.envProfile)
+				defer func() { _ = os.Unsetenv("CC_SANDBOX_PROFILE") }()
+			}
+
+			cfg := &Config{Workdir: workdir, Profile: tt.profile, MountGH: true}
+			err := resolveConfig(cfg, func(string) bool { return false })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if cfg.Profile != tt.wantProfile {
+				t.Errorf("Profile = %q, want %q", cfg.Profile, tt.wantProfile)
+			}
+			if cfg.Image != tt.wantImage {
+				t.Errorf("Image = %q, want %q", cfg.Image, tt.wantImage)
+			}
+			if cfg.MountSSH != tt.wantSSH {
+				t.Errorf("MountSSH = %v, want %v", cfg.MountSSH, tt.wantSSH)
+			}
+			if cfg.MountGH != tt.wantGH {
+				t.Errorf("MountGH = %v, want %v", cfg.MountGH, tt.wantGH)
+			}
+			if cfg.Registry != "registry.example.com/team" {
+				t.Errorf("Registry = %q, want user default", cfg.Registry)
+			}
+			if len(cfg.Mounts) != tt.wantMounts {
+				t.Errorf("Mounts = %v, want %d entries", cfg.Mounts, tt.wantMounts)
+			}
+			if tt.wantMounts > 0 && cfg.Mounts[0] != filepath.Join(tmpDir, "scratch")+":/scratch" {
+				t.Errorf("Mounts[0] = %q, want path relative to user config", cfg.Mounts[0])
+			}
+		})
+	}
+}
+
+func TestResolveHostPath(t *testing.T) {
+	home, _ := os.UserHomeDir()
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"./data:/data", "/project/data:/data"},
+		{"../shared:/shared:ro", "/shared:/shared:ro"},
+		{"~/cache:/cache", home + "/cache:/cache"},
+		{"/abs:/abs", "/abs:/abs"},
+		{"named-volume:/data", "named-volume:/data"},
+		{"./claude", "/project/claude"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got := resolveHostPath(tt.spec, "/project")
+			if got != tt.want {
+				t.Errorf("resolveHostPath(%q) = %q, want %q", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// configEntry is one row of `cc-sandbox config show` output.
+type configEntry struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+	Origin string      `json:"origin,omitempty"`
+}
+
+// newConfigCmd creates the config subcommand for inspecting and editing settings.
+func newConfigCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show and edit cc-sandbox configuration",
+		Long: `Show the effective configuration or edit the user config file.
+
+Examples:
+  cc-sandbox config show                     # Effective settings and their sources
+  cc-sandbox config show --json -i docker    # Same, as JSON, with flags applied
+  cc-sandbox config set image docker         # Set a default in the user config
+  cc-sandbox config set --profile work ssh true
+  cc-sandbox config get image
+  cc-sandbox config unset --profile work ssh
+  cc-sandbox config trust                    # Apply all of the project file`,
+	}
+
+	configCmd.AddCommand(newConfigShowCmd())
+	configCmd.AddCommand(newConfigGetCmd())
+	configCmd.AddCommand(newConfigSetCmd())
+	configCmd.AddCommand(newConfigUnsetCmd())
+	configCmd.AddCommand(newConfigTrustCmd())
+	configCmd.AddCommand(newConfigUntrustCmd())
+
+	return configCmd
+}
+
+func newConfigShowCmd() *cobra.Command {
+	cfg := &Config{}
+	var rootFlag string
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "show [flags]",
+		Short: "Print the effective configuration and where each value came from",
+		Long: `Print the fully resolved configuration, including auto-detected runtime,
+root mode, Docker socket and image name. Accepts the same flags as a sandbox run,
+so you can check what a given command line would do.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg.Root = parseRootFlag(rootFlag)
+			if err := prepareConfig(cfg, cmd.Flags().Changed); err != nil {
+				return err
+			}
+
+			workdirSource := valueSource{Kind: SourceDefault, Origin: "current directory"}
+			if cmd.Flags().Changed("workdir") {
+				workdirSource = valueSource{Kind: SourceFlag, Origin: "--workdir"}
+			}
+			cfg.setSource("workdir", workdirSource)
+
+			entries := collectConfigEntries(cfg)
+			if jsonOutput {
+				return printConfigJSON(os.Stdout, entries)
+			}
+			return printConfigTable(os.Stdout, entries)
+		},
+	}
+
+	addSandboxFlags(cmd, cfg, &rootFlag)
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+
+	return cmd
+}
+
+// collectConfigEntries lists every setting of a resolved Config with its source,
+// followed by the values cc-sandbox detects at run time.
+func collectConfigEntries(cfg *Config) []configEntry {
+	var entries []configEntry
+	add := func(key string, value interface{}, src valueSource) {
+		entries = append(entries, configEntry{Key: key, Value: value, Source: src.Kind, Origin: src.Origin})
+	}
+
+	add("profile", cfg.Profile, cfg.sourceOf("profile"))
+	add("workdir", cfg.Workdir, cfg.sourceOf("workdir"))
+
+	cfgValue := reflect.ValueOf(cfg).Elem()
+	for _, k := range configKeys {
+		value := cfgValue.FieldByName(k.Field)
+		switch {
+		case k.isList():
+			items := value.Interface().([]string)
+			if len(items) == 0 {
+				add(k.Key, []string{}, valueSource{Kind: SourceDefault})
+			}
+			srcs := cfg.sources[k.Key]
+			for i, item := range items {
+				src := valueSource{Kind: SourceDefault}
+				if i < len(srcs) {
+					src = srcs[i]
+				}
+				if k.Key == "env" {
+					item = maskSecretEnvVar(item)
+				}
+				add(k.Key, item, src)
+			}
+		case k.Field == "Root":
+			add(k.Key, rootModeString(cfg.Root), cfg.sourceOf(k.Key))
+		default:
+			add(k.Key, value.Interface(), cfg.sourceOf(k.Key))
+		}
+	}
+
+	// Values decided at run time
+	containerRuntime := detectRuntime(cfg)
+	runtimeSource := cfg.sourceOf("runtime")
+	if cfg.Runtime == "" || cfg.Runtime == "auto" {
+		runtimeSource = valueSource{Kind: SourceAuto}
+	}
+	add("resolved.runtime", containerRuntime, runtimeSource)
+
+	rootSource := cfg.sourceOf("root")
+	if cfg.Root == nil {
+		rootSource = valueSource{Kind: SourceAuto}
+	}
+	add("resolved.root", shouldUseRootMode(cfg, containerRuntime), rootSource)
+
+	add("resolved.image", resolveImageName(cfg.Registry, cfg.Image, containerRuntime),
+		valueSource{Kind: SourceAuto, Origin: "local image preferred over registry"})
+
+	return entries
+}
+
+// maskSecretEnvVar hides the value of an env entry that looks like a secret,
+// so `config show` doesn't print credentials to the terminal.
+func maskSecretEnvVar(env string) string {
+	key, _, hasValue := strings.Cut(env, "=")
+	if !hasValue || !isSecretEnvVar(env) {
+		return env
+	}
+	return key + "=********"
+}
+
+// rootModeString formats a root mode setting as accepted by --root.
+func rootModeString(root *bool) string {
+	if root == nil {
+		return "auto"
+	}
+	return strconv.FormatBool(*root)
+}
+
+func printConfigJSON(w io.Writer, entries []configEntry) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+func printConfigTable(w io.Writer, entries []configEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, e := range entries {
+		value := fmt.Sprint(e.Value)
+		if list, ok := e.Value.([]string); ok && len(list) == 0 {
+			value = "(none)"
+		} else if value == "" {
+			value = "(empty)"
+		}
+		source := e.Source
+		if e.Origin != "" {
+			source += " (" + e.Origin + ")"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Key, value, source)
+	}
+	return tw.Flush()
+}
+
+func newConfigGetCmd() *cobra.Command {
+	var profile string
+
+	cmd := &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print a value from the user config file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			path := getUserConfigPath()
+			doc, err := loadUserConfigNode(path)
+			if err != nil {
+				return err
+			}
+
+			section, err := userConfigSection(doc, args[0], profile, false)
+			if err != nil {
+				return err
+			}
+			value := mappingValue(section, args[0])
+			if value == nil {
+				return fmt.Errorf("%s is not set in %s", args[0], path)
+			}
+
+			if value.Kind == yaml.SequenceNode {
+				for _, item := range value.Content {
+					fmt.Println(item.Value)
+				}
+				return nil
+			}
+			fmt.Println(value.Value)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&profile, "profile", "", "Read from a named profile instead of the default section")
+
+	return cmd
+}
+
+func newConfigSetCmd() *cobra.Command {
+	var profile string
+
+	cmd := &cobra.Command{
+		Use:   "set <key> <value> [value...]",
+		Short: "Set a value in the user config file",
+		Long: `Set a value in the user config file. List keys (mounts, env) take one or
+more values and replace the existing list. Relative paths are made absolute.
+
+Keys: profile, ` + strings.Join(configKeyNames(), ", "),
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return editUserConfig(args[0], profile, func(section *yaml.Node) error {
+				value, err := newConfigValueNode(args[0], args[1:])
+				if err != nil {
+					return err
+				}
+				setMappingValue(section, args[0], value)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&profile, "profile", "", "Write to a named profile instead of the default section")
+
+	return cmd
+}
+
+func newConfigUnsetCmd() *cobra.Command {
+	var profile string
+
+	cmd := &cobra.Command{
+		Use:   "unset <key>",
+		Short: "Remove a value from the user config file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return editUserConfig(args[0], profile, func(section *yaml.Node) error {
+				if !removeMappingValue(section, args[0]) {
+					return fmt.Errorf("%s is not set", args[0])
+				}
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&profile, "profile", "", "Remove from a named profile instead of the default section")
+
+	return cmd
+}
+
+// configKeyNames returns the names of all config file keys.
+func configKeyNames() []string {
+	names := make([]string, 0, len(configKeys))
+	for _, k := range configKeys {
+		names = append(names, k.Key)
+	}
+	return names
+}
+
+// editUserConfig applies edit to the section holding key and writes the file back.
+// The result is validated by parsing it the same way a sandbox run does.
+func editUserConfig(key, profile string, edit func(section *yaml.Node) error) error {
+	path := getUserConfigPath()
+	doc, err := loadUserConfigNode(path)
+	if err != nil {
+		return err
+	}
+
+	section, err := userConfigSection(doc, key, profile, true)
+	if err != nil {
+		return err
+	}
+	if err := edit(section); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	_ = enc.Close()
+
+	dec := yaml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.KnownFields(true)
+	if err := dec.Decode(&UserConfig{}); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	return writeFileAtomic(path, buf.Bytes(), 0644)
+}
+
+// loadUserConfigNode reads the user config file as a YAML node tree so that
+// edits keep comments and key order. A missing file yields an empty document.
+func loadUserConfigNode(path string) (*yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return doc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := &yaml.Node{}
+	if err := yaml.Unmarshal(data, parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(parsed.Content) == 0 {
+		return doc, nil
+	}
+	if parsed.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse %s: top level must be a mapping", path)
+	}
+	return parsed, nil
+}
+
+// userConfigSection returns the mapping node that holds key: the top level for
+// "profile", a named profile, or the default section.
+func userConfigSection(doc *yaml.Node, key, profile string, create bool) (*yaml.Node, error) {
+	root := doc.Content[0]
+
+	if key == "profile" {
+		if profile != "" {
+			return nil, errors.New("profile is a top-level key and can't be set inside a profile")
+		}
+		return root, nil
+	}
+	if _, ok := lookupConfigKey(key); !ok {
+		return nil, fmt.Errorf("unknown config key %q (valid keys: profile, %s)", key, strings.Join(configKeyNames(), ", "))
+	}
+
+	path := []string{"default"}
+	if profile != "" {
+		path = []string{"profiles", profile}
+	}
+
+	node := root
+	for _, name := range path {
+		next := mappingValue(node, name)
+		if next == nil || next.Kind != yaml.MappingNode {
+			if !create {
+				return &yaml.Node{Kind: yaml.MappingNode}, nil
+			}
+			next = &yaml.Node{Kind: yaml.MappingNode}
+			setMappingValue(node, name, next)
+		}
+		node = next
+	}
+	return node, nil
+}
+
+// newConfigValueNode builds a YAML node for key from command-line values.
+func newConfigValueNode(key string, values []string) (*yaml.Node, error) {
+	if key == "profile" {
+		if len(values) != 1 {
+			return nil, errors.New("profile takes a single value")
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: values[0]}, nil
+	}
+
+	k, _ := lookupConfigKey(key)
+	cwd, _ := os.Getwd()
+
+	if k.isList() {
+		seq := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, v := range values {
+			if key == "mounts" {
+				v = resolveHostPath(v, cwd)
+			}
+			seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v})
+		}
+		return seq, nil
+	}
+
+	if len(values) != 1 {
+		return nil, fmt.Errorf("%s takes a single value", key)
+	}
+	value := values[0]
+
+	switch {
+	case k.kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false, got %q", key, value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(b)}, nil
+	case key == "root":
+		if parseRootFlag(value) == nil && strings.ToLower(value) != "auto" {
+			return nil, fmt.Errorf("root must be auto, true or false, got %q", value)
+		}
+	case key == "runtime":
+		if value != "auto" && value != RuntimeDocker && value != RuntimePodman {
+			return nil, fmt.Errorf("runtime must be auto, docker or podman, got %q", value)
+		}
+	case key == "claude_config":
+		value = resolveHostPath(value, cwd)
+	case key == "account":
+		if err := validateAccountName(value); err != nil {
+			return nil, err
+		}
+	case key == "provider":
+		if err := validateProvider(value); err != nil {
+			return nil, err
+		}
+	case key == "memory" || key == "cpus" || key == "pids_limit" || key == "disk" || key == "timeout":
+		limits := &Config{}
+		reflect.ValueOf(limits).Elem().FieldByName(k.Field).SetString(value)
+		if err := validateResourceLimits(limits); err != nil {
+			return nil, err
+		}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+}
+
+// mappingValue returns the value node for key in a mapping node, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets key in a mapping node, keeping its position if present.
+func setMappingValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// removeMappingValue deletes key from a mapping node. Returns false if absent.
+func removeMappingValue(m *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// writeFileAtomic writes data to a temp file in the target directory and renames it into place.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestConfigKeysMatchFileConfig(t *testing.T) {
+	fileType := reflect.TypeOf(FileConfig{})
+	cfgType := reflect.TypeOf(Config{})
+
+	for _, k := range configKeys {
+		field, ok := fileType.FieldByName(k.Field)
+		if !ok {
+			t.Errorf("configKey %q: FileConfig has no field %s", k.Key, k.Field)
+			continue
+		}
+		if tag := field.Tag.Get("yaml"); tag != k.Key {
+			t.Errorf("configKey %q: FileConfig.%s yaml tag = %q", k.Key, k.Field, tag)
+		}
+		if _, ok := cfgType.FieldByName(k.Field); !ok {
+			t.Errorf("configKey %q: Config has no field %s", k.Key, k.Field)
+		}
+	}
+
+	if len(configKeys) != fileType.NumField() {
+		t.Errorf("configKeys has %d entries, FileConfig has %d fields", len(configKeys), fileType.NumField())
+	}
+}
+
+func TestResolveConfigSources(t *testing.T) {
+	workdir := t.TempDir()
+	projectFile := filepath.Join(workdir, ".cc-sandbox.yaml")
+	if err := os.WriteFile(projectFile, []byte("image: docker\nssh: true\nmounts:\n  - /a:/a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	trustProjectConfig(t, workdir)
+
+	_ = os.Setenv("CC_SANDBOX_CONFIG_FILE", filepath.Join(workdir, "missing.yaml"))
+	_ = os.Setenv("CC_SANDBOX_RUNTIME", "podman")
+	defer func() {
+		_ = os.Unsetenv("CC_SANDBOX_CONFIG_FILE")
+		_ = os.Unsetenv("CC_SANDBOX_RUNTIME")
+	}()
+	for _, key := range []string{"CC_SANDBOX_DEFAULT_IMAGE", "CC_SANDBOX_DOCKER_SOCKET", "CC_SANDBOX_PROFILE"} {
+		_ = os.Unsetenv(key)
+	}
+
+	cfg := &Config{Workdir: workdir, Runtime: "auto", MountSSH: false, Mounts: []string{"/b:/b"}}
+	flags := map[string]bool{"ssh": true, "mount": true}
+	if err := resolveConfig(cfg, func(name string) bool { return flags[name] }); err != nil {
+		t.Fatalf("resolveConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		key        string
+		wantKind   string
+		wantOrigin string
+	}{
+		{"image", SourceFile, projectFile},
+		{"runtime", SourceEnv, "CC_SANDBOX_RUNTIME"},
+		{"ssh", SourceFlag, "--ssh"},
+		{"docker_socket", SourceAuto, ""},
+		{"git_user_name", SourceDefault, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got := cfg.sourceOf(tt.key)
+			if got.Kind != tt.wantKind || got.Origin != tt.wantOrigin {
+				t.Errorf("sourceOf(%q) = %+v, want {%s %s}", tt.key, got, tt.wantKind, tt.wantOrigin)
+			}
+		})
+	}
+
+	mountSources := cfg.sources["mounts"]
+	if len(mountSources) != 2 || mountSources[0].Kind != SourceFile || mountSources[1].Kind != SourceFlag {
+		t.Errorf("mounts sources = %+v, want [file flag]", mountSources)
+	}
+}
+
+func TestCollectConfigEntriesMasksSecrets(t *testing.T) {
+	cfg := &Config{Workdir: t.TempDir(), EnvVars: []string{"NODE_ENV=development", "NPM_TOKEN=npm_abc", "OPENAI=sk-proj-123", "GH_TOKEN"}}
+	var env []string
+	for _, e := range collectConfigEntries(cfg) {
+		if e.Key == "env" {
+			env = append(env, e.Value.(string))
+		}
+	}
+	want := []string{"NODE_ENV=development", "NPM_TOKEN=********", "OPENAI=********", "GH_TOKEN"}
+	if joinArgs(env) != joinArgs(want) {
+		t.Errorf("env entries = %v, want %v", env, want)
+	}
+}
+
+func TestEditUserConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cc-sandbox", "config.yaml")
+	_ = os.Setenv("CC_SANDBOX_CONFIG_FILE", path)
+	defer func() { _ = os.Unsetenv("CC_SANDBOX_CONFIG_FILE") }()
+
+	set := func(key, profile string, values ...string) error {
+		return editUserConfig(key, profile, func(section *yaml.Node) error {
+			value, err := newConfigValueNode(key, values)
+			if err != nil {
+				return err
+			}
+			setMappingValue(section, key, value)
+			return nil
+		})
+	}
+
+	if err := set("image", "", "docker"); err != nil {
+		t.Fatalf("set image: %v", err)
+	}
+	if err := set("ssh", "work", "yes"); err == nil {
+		t.Error("set ssh=yes: expected error for non-bool value")
+	}
+	if err := set("ssh", "work", "true"); err != nil {
+		t.Fatalf("set ssh: %v", err)
+	}
+	if err := set("env", "work", "A=1", "B=2"); err != nil {
+		t.Fatalf("set env: %v", err)
+	}
+	if err := set("root", "", "true"); err != nil {
+		t.Fatalf("set root: %v", err)
+	}
+	if err := set("runtime", "", "lxc"); err == nil {
+		t.Error("set runtime=lxc: expected error")
+	}
+	if err := set("memory", "", "4 GB"); err == nil {
+		t.Error("set memory=4 GB: expected error")
+	}
+	if err := set("timeout", "work", "2h"); err != nil {
+		t.Fatalf("set timeout: %v", err)
+	}
+	if err := set("profile", "", "work"); err != nil {
+		t.Fatalf("set profile: %v", err)
+	}
+	if err := set("nope", "", "x"); err == nil {
+		t.Error("set nope: expected unknown key error")
+	}
+
+	uc, err := loadUserConfig(path)
+	if err != nil {
+		t.Fatalf("loadUserConfig() error = %v", err)
+	}
+	if uc.Profile != "work" {
+		t.Errorf("Profile = %q, want work", uc.Profile)
+	}
+	if uc.Default.Image == nil || *uc.Default.Image != "docker" {
+		t.Errorf("Default.Image = %v, want docker", uc.Default.Image)
+	}
+	if uc.Default.Root == nil || *uc.Default.Root != "true" {
+		t.Errorf("Default.Root = %v, want \"true\"", uc.Default.Root)
+	}
+	work := uc.Profiles["work"]
+	if work == nil || work.MountSSH == nil || !*work.MountSSH {
+		t.Fatalf("Profiles[work].MountSSH not set: %+v", work)
+	}
+	if strings.Join(work.EnvVars, ",") != "A=1,B=2" {
+		t.Errorf("Profiles[work].EnvVars = %v, want [A=1 B=2]", work.EnvVars)
+	}
+
+	// Unset keeps the rest of the file intact
+	err = editUserConfig("ssh", "work", func(section *yaml.Node) error {
+		if !removeMappingValue(section, "ssh") {
+			t.Error("removeMappingValue(ssh) = false, want true")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unset ssh: %v", err)
+	}
+	uc, err = loadUserConfig(path)
+	if err != nil {
+		t.Fatalf("loadUserConfig() error = %v", err)
+	}
+	if uc.Profiles["work"].MountSSH != nil {
+		t.Error("Profiles[work].MountSSH still set after unset")
+	}
+	if len(uc.Profiles["work"].EnvVars) != 2 {
+		t.Errorf("Profiles[work].EnvVars = %v, want kept", uc.Profiles["work"].EnvVars)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("config file mode = %o, want 644", info.Mode().Perm())
+	}
+}
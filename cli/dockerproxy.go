@@ -0,0 +1,980 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// The Docker socket proxy sits between the sandbox and the host's Docker
+// socket. Sibling containers could otherwise be started privileged or with
+// the host's / mounted, which undoes the sandbox. Each request is checked
+// against a dockerPolicy; denied requests get a 403 whose message the docker
+// CLI prints as "Error response from daemon: ...".
+
+// containerDockerDir is where the proxy socket's directory is mounted in the
+// sandbox. The directory is mounted rather than the socket, so a restarted
+// proxy is picked up by a running container.
+const containerDockerDir = "/run/cc-sandbox-docker"
+
+// dockerProxySocketName is the proxy socket's file name in its directory.
+const dockerProxySocketName = "docker.sock"
+
+// Values of docker_allow / --docker-allow that lift a default restriction.
+// Any other value must be a host path that sibling containers may bind-mount.
+const (
+	dockerAllowPrivileged     = "privileged"
+	dockerAllowHostNamespaces = "host-namespaces"
+	dockerAllowDevices        = "devices"
+	dockerAllowHostMounts     = "host-mounts"
+)
+
+// dockerInspectLimit caps the request bodies the proxy reads to check them.
+const dockerInspectLimit = 16 << 20
+
+// dockerAPIVersionPrefix matches the optional /v1.xx prefix of API paths.
+var dockerAPIVersionPrefix = regexp.MustCompile(`^/v[0-9][0-9.]*`)
+
+// dockerPolicy is what the proxy lets sibling containers do.
+type dockerPolicy struct {
+	Workspace         string   `json:"workspace,omitempty"`       // Host workdir; bind mounts inside it are allowed
+	WorkspaceMount    string   `json:"workspace_mount,omitempty"` // Host directory mounted at /workspace, if any
+	WorkspaceReadOnly bool     `json:"workspace_read_only,omitempty"`
+	Paths             []string `json:"paths,omitempty"` // Other host paths that may be bind-mounted
+	Privileged        bool     `json:"privileged,omitempty"`
+	HostNamespaces    bool     `json:"host_namespaces,omitempty"`
+	Devices           bool     `json:"devices,omitempty"`
+	HostMounts        bool     `json:"host_mounts,omitempty"` // Any host path may be bind-mounted
+	Volumes           []string `json:"volumes,omitempty"`     // The sandbox's own cc-sandbox volumes, which may be mounted
+	NoEgress          bool     `json:"no_egress,omitempty"`   // The sandbox has a network policy, so siblings get no network
+}
+
+// dockerProxyConfig is everything a proxy process needs to serve a sandbox.
+type dockerProxyConfig struct {
+	Dir      string       `json:"dir"`      // Host directory of the proxy socket
+	Upstream string       `json:"upstream"` // The real Docker socket
+	Policy   dockerPolicy `json:"policy"`
+}
+
+// dockerDeniedError is a request refused by the policy.
+type dockerDeniedError struct {
+	what  string // What was refused, e.g. "privileged containers"
+	allow string // docker_allow value that permits it; empty if nothing does
+}
+
+func (e *dockerDeniedError) Error() string {
+	if e.allow == "" {
+		return fmt.Sprintf("cc-sandbox: %s are not allowed in this sandbox", e.what)
+	}
+	return fmt.Sprintf("cc-sandbox: %s are not allowed in this sandbox (allow with --docker-allow %s or docker_allow in the config)", e.what, e.allow)
+}
+
+// dockerReservedLabelPrefix is the prefix of the labels cc-sandbox keeps its
+// own state in. Sibling containers may not set them or take the names of
+// sandbox containers, or they could pass for a sandbox in `cc-sandbox ps`,
+// attach and rm.
+const dockerReservedLabelPrefix = "cc-sandbox."
+
+// labelDockerParent marks the containers created through a proxy with the
+// proxy's directory. Only those may be exec'd into or copied from and to.
+const labelDockerParent = "cc-sandbox.parent"
+
+// dockerVolumePrefix starts the names of the volumes cc-sandbox creates:
+// credentials, Claude config and the workspaces of isolated and --repo
+// sessions.
+const dockerVolumePrefix = "cc-sandbox-"
+
+// validateDockerAllow checks the docker_allow entries.
+func validateDockerAllow(entries []string) error {
+	for _, entry := range entries {
+		switch entry {
+		case dockerAllowPrivileged, dockerAllowHostNamespaces, dockerAllowDevices, dockerAllowHostMounts:
+			continue
+		}
+		if !filepath.IsAbs(expandPath(entry)) {
+			return fmt.Errorf("invalid docker_allow entry %q: use privileged, host-namespaces, devices, host-mounts or an absolute host path", entry)
+		}
+	}
+	return nil
+}
+
+// dockerPolicyFor returns the proxy policy of a sandbox. Sibling containers
+// may bind-mount the workdir (read-only if the sandbox's workspace is), but
+// not the host workdir of an isolated or --repo session. Those may mount the
+// session's workspace volume instead. While the sandbox has a network
+// policy, sibling containers get no network, or they would bypass it. /workspace paths are
+// translated only where /workspace is the host workdir.
+func dockerPolicyFor(cfg *Config) dockerPolicy {
+	policy := dockerPolicy{}
+	switch {
+	case cfg.Repo != "":
+		policy.Volumes = []string{cfg.RepoVolume}
+	case cfg.Isolated:
+		work, _ := isolatedVolumes(cfg.Session)
+		policy.Workspace, policy.WorkspaceReadOnly = cfg.Workdir, true
+		policy.Volumes = []string{work}
+	default:
+		policy.Workspace, policy.WorkspaceReadOnly = cfg.Workdir, cfg.ReadOnlyWorkspace
+		policy.WorkspaceMount = cfg.Workdir
+	}
+	policy.NoEgress = cfg.NetworkPolicy == networkPolicyNone || cfg.NetworkPolicy == networkPolicyAllowlist
+	for _, entry := range cfg.DockerAllow {
+		switch entry {
+		case dockerAllowPrivileged:
+			policy.Privileged = true
+		case dockerAllowHostNamespaces:
+			policy.HostNamespaces = true
+		case dockerAllowDevices:
+			policy.Devices = true
+		case dockerAllowHostMounts:
+			policy.HostMounts = true
+		default:
+			policy.Paths = append(policy.Paths, expandPath(entry))
+		}
+	}
+	return policy
+}
+
+// useDockerProxy reports whether the sandbox gets the proxy instead of the
+// raw Docker socket.
+func useDockerProxy(cfg *Config) bool {
+	return cfg.MountDocker && cfg.DockerProxy && fileExists(cfg.DockerSocket)
+}
+
+// isDockerDesktopSocket reports whether socket belongs to Docker Desktop for
+// macOS, whose VM can't bind-mount a Unix socket created on the host.
+// This is a variable to allow mocking in tests.
+var isDockerDesktopSocket = func(socket string) bool {
+	if runtime.GOOS != "darwin" {
+		return false
+	}
+	if resolved, err := filepath.EvalSymlinks(socket); err == nil {
+		socket = resolved
+	}
+	return strings.Contains(socket, "/.docker/run/") || strings.Contains(socket, "/com.docker.docker/")
+}
+
+// applyDockerProxySupport turns the proxy off where its socket can't be
+// mounted into the sandbox, which would leave docker commands failing with
+// connection errors. The raw socket is mounted instead, with a warning. A
+// proxy asked for explicitly is an error instead.
+func applyDockerProxySupport(cfg *Config) error {
+	if !cfg.MountDocker || !cfg.DockerProxy || !isDockerDesktopSocket(cfg.DockerSocket) {
+		return nil
+	}
+	if src := cfg.sourceOf("docker_proxy"); src.Kind != SourceDefault {
+		return fmt.Errorf("docker_proxy is enabled by %s, but Docker Desktop for macOS can't mount the proxy socket into the sandbox; use --docker-proxy=false to mount the raw Docker socket", src.Origin)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: Docker Desktop for macOS can't mount the Docker socket proxy; mounting the raw Docker socket, which gives the sandbox full control of Docker (set docker_proxy: false to silence this warning)\n")
+	cfg.DockerProxy = false
+	cfg.setSource("docker_proxy", valueSource{Kind: SourceAuto, Origin: "Docker Desktop for macOS"})
+	return nil
+}
+
+// dockerProxyConfigFor returns the proxy config of a sandbox whose proxy
+// directory has been created.
+func dockerProxyConfigFor(cfg *Config) dockerProxyConfig {
+	return dockerProxyConfig{Dir: cfg.DockerProxyDir, Upstream: cfg.DockerSocket, Policy: dockerPolicyFor(cfg)}
+}
+
+// dockerProxyArgs mounts the proxy socket's directory and points the docker
+// CLI at it. The entrypoint links /var/run/docker.sock to it for tools that
+// don't read DOCKER_HOST.
+func dockerProxyArgs(cfg *Config) []string {
+	return []string{
+		"-v", cfg.DockerProxyDir + ":" + containerDockerDir,
+		"-e", "DOCKER_HOST=unix://" + containerDockerDir + "/" + dockerProxySocketName,
+	}
+}
+
+// checkDockerRequest returns a *dockerDeniedError if policy forbids the API
+// request. body is the request body for the endpoints that are inspected.
+func checkDockerRequest(policy dockerPolicy, method, path string, query url.Values, body []byte) error {
+	if method != http.MethodPost {
+		return nil
+	}
+	path = dockerAPIVersionPrefix.ReplaceAllString(path, "")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case path == "/containers/create":
+		if err := checkContainerName(query.Get("name")); err != nil {
+			return err
+		}
+		return checkContainerCreate(policy, body)
+	case len(parts) == 3 && parts[0] == "containers" && parts[2] == "rename":
+		return checkContainerName(query.Get("name"))
+	case len(parts) == 3 && parts[0] == "containers" && parts[2] == "exec":
+		var exec struct{ Privileged bool }
+		if err := json.Unmarshal(body, &exec); err != nil {
+			return fmt.Errorf("cc-sandbox: cannot check exec request: %w", err)
+		}
+		if exec.Privileged && !policy.Privileged {
+			return &dockerDeniedError{"privileged exec sessions", dockerAllowPrivileged}
+		}
+	case len(parts) == 3 && parts[0] == "containers" && parts[2] == "update":
+		var update struct {
+			Devices           []json.RawMessage
+			DeviceRequests    []json.RawMessage
+			DeviceCgroupRules []string
+		}
+		if err := json.Unmarshal(body, &update); err != nil {
+			return fmt.Errorf("cc-sandbox: cannot check update request: %w", err)
+		}
+		if !policy.Devices && len(update.Devices)+len(update.DeviceRequests)+len(update.DeviceCgroupRules) > 0 {
+			return &dockerDeniedError{"host devices", dockerAllowDevices}
+		}
+	case path == "/volumes/create":
+		var volume struct {
+			Name       string
+			Labels     map[string]string
+			DriverOpts map[string]string
+		}
+		if err := json.Unmarshal(body, &volume); err != nil {
+			return fmt.Errorf("cc-sandbox: cannot check volume request: %w", err)
+		}
+		if strings.HasPrefix(volume.Name, dockerVolumePrefix) {
+			return &dockerDeniedError{"volume names starting with " + dockerVolumePrefix, ""}
+		}
+		if err := checkReservedLabels(volume.Labels); err != nil {
+			return err
+		}
+		return checkVolumeOptions(policy, volume.DriverOpts)
+	case path == "/build":
+		if query.Get("networkmode") == "host" && !policy.HostNamespaces {
+			return &dockerDeniedError{"builds on the host network", dockerAllowHostNamespaces}
+		}
+		if mode := query.Get("networkmode"); policy.NoEgress && !isDefaultNetwork(mode) {
+			return &dockerDeniedError{"builds on the " + mode + " network while a network policy is active", ""}
+		}
+	case (path == "/grpc" || path == "/session") && policy.NoEgress:
+		// BuildKit sessions pick the build's network inside the stream,
+		// where the proxy can't force it off
+		return &dockerDeniedError{"BuildKit builds while a network policy is active (build with DOCKER_BUILDKIT=0)", ""}
+	case len(parts) == 3 && parts[0] == "networks" && parts[2] == "connect" && policy.NoEgress:
+		return &dockerDeniedError{"network connections while a network policy is active", ""}
+	case parts[0] == "plugins" || parts[0] == "services" || parts[0] == "swarm":
+		// Plugins run with host privileges; services and swarm bypass the
+		// container checks
+		if !policy.Privileged {
+			return &dockerDeniedError{parts[0] + " changes", dockerAllowPrivileged}
+		}
+	}
+	return nil
+}
+
+// translateDockerRequest rewrites the bind sources of a container create
+// request that point into /workspace to the host directory mounted there. The
+// daemon resolves bind sources on the host, where /workspace doesn't exist,
+// so `docker run -v /workspace/data:/data` and compose's relative volumes
+// would otherwise mount empty directories. The body is returned unchanged if
+// nothing needs translating.
+func translateDockerRequest(policy dockerPolicy, method, path string, body []byte) ([]byte, error) {
+	if policy.WorkspaceMount == "" || method != http.MethodPost || dockerAPIVersionPrefix.ReplaceAllString(path, "") != "/containers/create" {
+		return body, nil
+	}
+	var create map[string]json.RawMessage
+	if err := json.Unmarshal(body, &create); err != nil {
+		return nil, fmt.Errorf("cc-sandbox: cannot check container request: %w", err)
+	}
+	var hostConfig map[string]json.RawMessage
+	if raw, ok := create["HostConfig"]; !ok || json.Unmarshal(raw, &hostConfig) != nil || hostConfig == nil {
+		return body, nil
+	}
+
+	changed := false
+	var binds []string
+	if raw, ok := hostConfig["Binds"]; ok && json.Unmarshal(raw, &binds) == nil {
+		for i, bind := range binds {
+			source, rest, found := strings.Cut(bind, ":")
+			if host, ok := translateWorkspacePath(policy, source); ok && found {
+				binds[i] = host + ":" + rest
+				changed = true
+			}
+		}
+		hostConfig["Binds"], _ = json.Marshal(binds)
+	}
+	var mounts []map[string]json.RawMessage
+	if raw, ok := hostConfig["Mounts"]; ok && json.Unmarshal(raw, &mounts) == nil {
+		for _, m := range mounts {
+			var mountType, source string
+			_ = json.Unmarshal(m["Type"], &mountType)
+			_ = json.Unmarshal(m["Source"], &source)
+			if host, ok := translateWorkspacePath(policy, source); ok && mountType == "bind" {
+				m["Source"], _ = json.Marshal(host)
+				changed = true
+			}
+		}
+		hostConfig["Mounts"], _ = json.Marshal(mounts)
+	}
+	if !changed {
+		return body, nil
+	}
+
+	create["HostConfig"], _ = json.Marshal(hostConfig)
+	return json.Marshal(create)
+}
+
+// finishDockerRequest makes the last changes to a checked request: a
+// container created through the proxy gets labelDockerParent, so the proxy
+// later lets exec and copies reach it, and while the sandbox has a network
+// policy, new containers and builds get no network.
+func finishDockerRequest(cfg dockerProxyConfig, req *http.Request, body []byte) error {
+	if req.Method != http.MethodPost {
+		return nil
+	}
+	switch dockerAPIVersionPrefix.ReplaceAllString(req.URL.Path, "") {
+	case "/build":
+		if cfg.Policy.NoEgress {
+			query := req.URL.Query()
+			query.Set("networkmode", "none")
+			req.URL.RawQuery = query.Encode()
+		}
+	case "/containers/create":
+		return finishContainerCreate(cfg, req, body)
+	}
+	return nil
+}
+
+// finishContainerCreate labels a container create request and, while the
+// sandbox has a network policy, takes the container off the network.
+func finishContainerCreate(cfg dockerProxyConfig, req *http.Request, body []byte) error {
+	var create map[string]json.RawMessage
+	if err := json.Unmarshal(body, &create); err != nil {
+		return fmt.Errorf("cc-sandbox: cannot check container request: %w", err)
+	}
+	var labels map[string]string
+	if raw, ok := create["Labels"]; ok {
+		_ = json.Unmarshal(raw, &labels)
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[labelDockerParent] = cfg.Dir
+	create["Labels"], _ = json.Marshal(labels)
+
+	if cfg.Policy.NoEgress {
+		var hostConfig map[string]json.RawMessage
+		if raw, ok := create["HostConfig"]; ok {
+			_ = json.Unmarshal(raw, &hostConfig)
+		}
+		if hostConfig == nil {
+			hostConfig = map[string]json.RawMessage{}
+		}
+		hostConfig["NetworkMode"], _ = json.Marshal("none")
+		create["HostConfig"], _ = json.Marshal(hostConfig)
+		delete(create, "NetworkingConfig")
+	}
+
+	body, err := json.Marshal(create)
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.TransferEncoding = nil
+	return nil
+}
+
+// translateWorkspacePath maps a path inside the sandbox's /workspace to the
+// host directory mounted there.
+func translateWorkspacePath(policy dockerPolicy, source string) (string, bool) {
+	if !strings.HasPrefix(source, "/") {
+		return "", false
+	}
+	rel, err := filepath.Rel("/workspace", filepath.Clean(source))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return filepath.Join(policy.WorkspaceMount, rel), true
+}
+
+// composeProjectName returns the Compose project name of workdir, as docker
+// compose derives it on the host. Inside the sandbox every project would
+// otherwise be named after /workspace and share one set of containers.
+func composeProjectName(workdir string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(filepath.Base(workdir)) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || (r == '-' || r == '_') && b.Len() > 0 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// needsDockerRequestBody reports whether checkDockerRequest reads the body
+// of a request.
+func needsDockerRequestBody(method, path string) bool {
+	if method != http.MethodPost {
+		return false
+	}
+	path = dockerAPIVersionPrefix.ReplaceAllString(path, "")
+	return path == "/containers/create" || path == "/volumes/create" ||
+		strings.HasPrefix(path, "/containers/") && (strings.HasSuffix(path, "/exec") || strings.HasSuffix(path, "/update"))
+}
+
+// dangerousCapabilities are capabilities that amount to a privileged container.
+var dangerousCapabilities = map[string]bool{
+	"ALL": true, "SYS_ADMIN": true, "SYS_MODULE": true, "SYS_RAWIO": true,
+	"SYS_PTRACE": true, "DAC_READ_SEARCH": true, "SYS_BOOT": true, "MAC_ADMIN": true,
+}
+
+// dockerHostConfig is the part of a container's HostConfig the proxy checks.
+type dockerHostConfig struct {
+	Privileged bool
+	Binds      []string
+	Mounts     []struct {
+		Type          string
+		Source        string
+		ReadOnly      bool
+		VolumeOptions *struct {
+			DriverConfig *struct{ Options map[string]string }
+		}
+	}
+	VolumesFrom                                                      []string
+	PidMode, NetworkMode, IpcMode, UTSMode, UsernsMode, CgroupnsMode string
+	Devices                                                          []json.RawMessage
+	DeviceRequests                                                   []json.RawMessage
+	DeviceCgroupRules                                                []string
+	CapAdd                                                           []string
+	SecurityOpt                                                      []string
+}
+
+// checkContainerName refuses the names of sandbox containers.
+func checkContainerName(name string) error {
+	if strings.HasPrefix(strings.TrimPrefix(name, "/"), sandboxContainerPrefix) {
+		return &dockerDeniedError{"container names starting with " + sandboxContainerPrefix, ""}
+	}
+	return nil
+}
+
+// checkReservedLabels refuses the labels cc-sandbox keeps its state in.
+func checkReservedLabels(labels map[string]string) error {
+	for label := range labels {
+		if strings.HasPrefix(label, dockerReservedLabelPrefix) {
+			return &dockerDeniedError{dockerReservedLabelPrefix + "* labels", ""}
+		}
+	}
+	return nil
+}
+
+// checkContainerCreate checks the labels and HostConfig of a container
+// create request.
+func checkContainerCreate(policy dockerPolicy, body []byte) error {
+	var create struct {
+		Labels           map[string]string
+		HostConfig       dockerHostConfig
+		NetworkingConfig struct{ EndpointsConfig map[string]json.RawMessage }
+	}
+	if err := json.Unmarshal(body, &create); err != nil {
+		return fmt.Errorf("cc-sandbox: cannot check container request: %w", err)
+	}
+	if err := checkReservedLabels(create.Labels); err != nil {
+		return err
+	}
+	hc := create.HostConfig
+
+	if !policy.Privileged {
+		if hc.Privileged {
+			return &dockerDeniedError{"privileged containers", dockerAllowPrivileged}
+		}
+		for _, capability := range hc.CapAdd {
+			if dangerousCapabilities[strings.TrimPrefix(strings.ToUpper(capability), "CAP_")] {
+				return &dockerDeniedError{"containers with " + capability, dockerAllowPrivileged}
+			}
+		}
+		for _, opt := range hc.SecurityOpt {
+			if strings.Contains(opt, "unconfined") || opt == "label=disable" || opt == "label:disable" {
+				return &dockerDeniedError{"containers with --security-opt " + opt, dockerAllowPrivileged}
+			}
+		}
+	}
+
+	if !policy.HostNamespaces {
+		for name, mode := range map[string]string{
+			"pid": hc.PidMode, "network": hc.NetworkMode, "ipc": hc.IpcMode,
+			"uts": hc.UTSMode, "userns": hc.UsernsMode, "cgroupns": hc.CgroupnsMode,
+		} {
+			if mode == "host" {
+				return &dockerDeniedError{"containers in the host " + name + " namespace", dockerAllowHostNamespaces}
+			}
+		}
+	}
+
+	if !policy.Devices && len(hc.Devices)+len(hc.DeviceRequests)+len(hc.DeviceCgroupRules) > 0 {
+		return &dockerDeniedError{"host devices", dockerAllowDevices}
+	}
+
+	if policy.NoEgress {
+		if !isDefaultNetwork(hc.NetworkMode) {
+			return &dockerDeniedError{"containers on the " + hc.NetworkMode + " network while a network policy is active", ""}
+		}
+		for network := range create.NetworkingConfig.EndpointsConfig {
+			if !isDefaultNetwork(network) {
+				return &dockerDeniedError{"containers on the " + network + " network while a network policy is active", ""}
+			}
+		}
+	}
+
+	return checkContainerMounts(policy, hc)
+}
+
+// isDefaultNetwork reports whether a container or build network mode is the
+// default network or none. While the sandbox has a network policy, those are
+// replaced with none (see finishDockerRequest); any other network is refused.
+func isDefaultNetwork(mode string) bool {
+	return mode == "" || mode == "default" || mode == "bridge" || mode == "none"
+}
+
+// checkContainerMounts checks the bind and volume mounts of a container.
+// Mounts shared from other containers with --volumes-from are refused: their
+// sources were never checked against this sandbox's policy.
+func checkContainerMounts(policy dockerPolicy, hc dockerHostConfig) error {
+	if len(hc.VolumesFrom) > 0 && !policy.HostMounts {
+		return &dockerDeniedError{"volumes from other containers", dockerAllowHostMounts}
+	}
+	for _, bind := range hc.Binds {
+		source, rest, _ := strings.Cut(bind, ":")
+		if !strings.HasPrefix(source, "/") {
+			if err := checkVolumeMount(policy, source); err != nil {
+				return err
+			}
+			continue
+		}
+		_, opts, _ := strings.Cut(rest, ":")
+		if err := checkHostMount(policy, source, containsString(strings.Split(opts, ","), "ro")); err != nil {
+			return err
+		}
+	}
+	for _, m := range hc.Mounts {
+		switch {
+		case m.Type == "bind":
+			if err := checkHostMount(policy, m.Source, m.ReadOnly); err != nil {
+				return err
+			}
+		case m.Type == "volume" || m.Type == "":
+			if err := checkVolumeMount(policy, m.Source); err != nil {
+				return err
+			}
+			if m.VolumeOptions != nil && m.VolumeOptions.DriverConfig != nil {
+				if err := checkVolumeOptions(policy, m.VolumeOptions.DriverConfig.Options); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkVolumeMount refuses the volumes of other sandboxes, such as the
+// credentials of another account or another session's workspace.
+func checkVolumeMount(policy dockerPolicy, name string) error {
+	if !strings.HasPrefix(name, dockerVolumePrefix) || policy.HostMounts || containsString(policy.Volumes, name) {
+		return nil
+	}
+	return &dockerDeniedError{"mounts of the cc-sandbox volume " + name, dockerAllowHostMounts}
+}
+
+// dockerStartedContainer returns the container that an API request starts.
+func dockerStartedContainer(method, path string) (string, bool) {
+	if method != http.MethodPost {
+		return "", false
+	}
+	parts := strings.Split(strings.Trim(dockerAPIVersionPrefix.ReplaceAllString(path, ""), "/"), "/")
+	if len(parts) == 3 && parts[0] == "containers" && (parts[2] == "start" || parts[2] == "restart") {
+		return parts[1], true
+	}
+	return "", false
+}
+
+// dockerEnteredContainer returns the container that an API request runs a
+// process in or copies files from or to.
+func dockerEnteredContainer(method, path string) (string, bool) {
+	parts := strings.Split(strings.Trim(dockerAPIVersionPrefix.ReplaceAllString(path, ""), "/"), "/")
+	if len(parts) != 3 || parts[0] != "containers" {
+		return "", false
+	}
+	if parts[2] == "archive" || parts[2] == "exec" && method == http.MethodPost {
+		return parts[1], true
+	}
+	return "", false
+}
+
+// dockerContainerInspect is the part of a container's inspect data the proxy
+// checks.
+type dockerContainerInspect struct {
+	Config     struct{ Labels map[string]string }
+	HostConfig dockerHostConfig
+}
+
+// inspectContainer fetches a container's inspect data from the daemon. It
+// returns nil for a missing container.
+func (p *dockerProxy) inspectContainer(id string) (*dockerContainerInspect, error) {
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", p.cfg.Upstream)
+		},
+		DisableKeepAlives: true,
+	}}
+	resp, err := client.Get("http://docker/containers/" + url.PathEscape(id) + "/json")
+	if err != nil {
+		return nil, fmt.Errorf("cc-sandbox: cannot check container %s: %w", id, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cc-sandbox: cannot check container %s: daemon returned %s", id, resp.Status)
+	}
+
+	var inspect dockerContainerInspect
+	if err := json.NewDecoder(io.LimitReader(resp.Body, dockerInspectLimit)).Decode(&inspect); err != nil {
+		return nil, fmt.Errorf("cc-sandbox: cannot check container %s: %w", id, err)
+	}
+	return &inspect, nil
+}
+
+// checkContainerStart checks the mounts of a container again before it
+// starts. The daemon resolves bind sources on every start, so a symlink in a
+// source could be swapped after the create request was checked, and
+// containers created without the proxy were never checked at all. While the
+// sandbox has a network policy, only containers without a network start. A
+// missing container is left to the daemon to report.
+func (p *dockerProxy) checkContainerStart(id string) error {
+	inspect, err := p.inspectContainer(id)
+	if err != nil || inspect == nil {
+		return err
+	}
+	if p.cfg.Policy.NoEgress && inspect.HostConfig.NetworkMode != "none" {
+		return &dockerDeniedError{"networked containers while a network policy is active", ""}
+	}
+	return checkContainerMounts(p.cfg.Policy, inspect.HostConfig)
+}
+
+// checkContainerRequest checks the requests that act on an existing
+// container against its inspect data.
+func (p *dockerProxy) checkContainerRequest(method, path string) error {
+	if id, ok := dockerStartedContainer(method, path); ok {
+		return p.checkContainerStart(id)
+	}
+	if id, ok := dockerEnteredContainer(method, path); ok {
+		return p.checkContainerEntry(id)
+	}
+	return nil
+}
+
+// checkContainerEntry refuses exec and file copies in containers that weren't
+// created through this proxy, like other sandboxes and their secrets. A
+// missing container is left to the daemon to report.
+func (p *dockerProxy) checkContainerEntry(id string) error {
+	inspect, err := p.inspectContainer(id)
+	if err != nil || inspect == nil {
+		return err
+	}
+	if inspect.Config.Labels[labelDockerParent] != p.cfg.Dir {
+		return &dockerDeniedError{"exec and copies in containers not started from this sandbox", ""}
+	}
+	return nil
+}
+
+// checkVolumeOptions refuses local volumes that bind a host directory, which
+// are bind mounts in disguise.
+func checkVolumeOptions(policy dockerPolicy, opts map[string]string) error {
+	device := opts["device"]
+	if device == "" || !strings.Contains(opts["o"], "bind") {
+		return nil
+	}
+	return checkHostMount(policy, device, false)
+}
+
+// checkHostMount checks a bind mount of a host path. Symlinks are resolved
+// on the host, where the daemon resolves them too.
+func checkHostMount(policy dockerPolicy, source string, readOnly bool) error {
+	if policy.HostMounts {
+		return nil
+	}
+	path := resolveExistingPath(filepath.Clean(source))
+	if policy.Workspace != "" && isPathWithin(path, resolveExistingPath(policy.Workspace)) {
+		if policy.WorkspaceReadOnly && !readOnly {
+			return &dockerDeniedError{"writable mounts of the read-only workspace " + source + " (mount it with :ro)", dockerAllowHostMounts}
+		}
+		return nil
+	}
+	for _, allowed := range policy.Paths {
+		if isPathWithin(path, resolveExistingPath(allowed)) {
+			return nil
+		}
+	}
+	return &dockerDeniedError{"bind mounts of " + source + " outside the workspace", dockerAllowHostMounts}
+}
+
+// resolveExistingPath resolves the symlinks in the longest existing prefix
+// of path. The daemon creates missing bind sources, so the rest can't be a
+// symlink yet.
+func resolveExistingPath(path string) string {
+	var rest []string
+	for {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, rest...)...)
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// dockerProxy serves the proxy socket of one sandbox.
+type dockerProxy struct {
+	cfg      dockerProxyConfig
+	listener net.Listener
+}
+
+// listenDockerProxy creates the proxy socket in cfg.Dir and serves it until close.
+func listenDockerProxy(cfg dockerProxyConfig) (*dockerProxy, error) {
+	socket := filepath.Join(cfg.Dir, dockerProxySocketName)
+	_ = os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker proxy socket: %w", err)
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to create Docker proxy socket: %w", err)
+	}
+
+	p := &dockerProxy{cfg: cfg, listener: listener}
+	go p.serve()
+	return p, nil
+}
+
+func (p *dockerProxy) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(conn)
+	}
+}
+
+// close stops serving and removes the proxy directory. It is safe to call on
+// a nil proxy.
+func (p *dockerProxy) close() {
+	if p == nil {
+		return
+	}
+	_ = p.listener.Close()
+	removeDockerProxyDir(p.cfg.Dir)
+}
+
+// handle proxies one connection. Every request is forwarded on its own
+// upstream connection with "Connection: close", so a client can't slip an
+// unchecked request onto a kept-alive connection. Upgraded connections
+// (attach, exec, BuildKit sessions) are spliced once the daemon switches
+// protocols, after which no HTTP requests follow.
+func (p *dockerProxy) handle(client net.Conn) {
+	defer func() { _ = client.Close() }()
+	clientReader := bufio.NewReader(client)
+
+	req, err := http.ReadRequest(clientReader)
+	if err != nil {
+		return
+	}
+	var body []byte
+	if needsDockerRequestBody(req.Method, req.URL.Path) {
+		body, err = io.ReadAll(io.LimitReader(req.Body, dockerInspectLimit+1))
+		if err == nil && len(body) > dockerInspectLimit {
+			err = errors.New("request body too large to check")
+		}
+		if err != nil {
+			writeDockerProxyError(client, http.StatusBadRequest, "cc-sandbox: "+err.Error())
+			return
+		}
+		if body, err = translateDockerRequest(p.cfg.Policy, req.Method, req.URL.Path, body); err != nil {
+			writeDockerProxyError(client, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if err := checkDockerRequest(p.cfg.Policy, req.Method, req.URL.Path, req.URL.Query(), body); err != nil {
+		debugLog("Docker proxy denied %s %s: %v", req.Method, req.URL.Path, err)
+		writeDockerProxyError(client, http.StatusForbidden, err.Error())
+		return
+	}
+	if err := p.checkContainerRequest(req.Method, req.URL.Path); err != nil {
+		debugLog("Docker proxy denied %s %s: %v", req.Method, req.URL.Path, err)
+		var denied *dockerDeniedError
+		status := http.StatusBadGateway
+		if errors.As(err, &denied) {
+			status = http.StatusForbidden
+		}
+		writeDockerProxyError(client, status, err.Error())
+		return
+	}
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.TransferEncoding = nil
+	}
+	if err := finishDockerRequest(p.cfg, req, body); err != nil {
+		writeDockerProxyError(client, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	upstream, err := net.Dial("unix", p.cfg.Upstream)
+	if err != nil {
+		writeDockerProxyError(client, http.StatusBadGateway, "cc-sandbox: cannot reach the Docker daemon: "+err.Error())
+		return
+	}
+	defer func() { _ = upstream.Close() }()
+
+	upgrade := req.Header.Get("Upgrade") != ""
+	if !upgrade {
+		req.Close = true
+	}
+	if err := req.Write(upstream); err != nil {
+		return
+	}
+	upstreamReader := bufio.NewReader(upstream)
+	resp, err := http.ReadResponse(upstreamReader, req)
+	if err != nil {
+		return
+	}
+
+	if upgrade && resp.StatusCode == http.StatusSwitchingProtocols {
+		if err := resp.Write(client); err != nil {
+			return
+		}
+		go func() {
+			_, _ = io.Copy(upstream, clientReader)
+			closeWrite(upstream)
+		}()
+		_, _ = io.Copy(client, upstreamReader)
+		return
+	}
+	resp.Close = true
+	_ = resp.Write(client)
+}
+
+// closeWrite half-closes conn, so the other side sees the end of its input.
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+	}
+}
+
+// writeDockerProxyError answers a request with an error in the Docker API's format.
+func writeDockerProxyError(w io.Writer, status int, message string) {
+	data, _ := json.Marshal(map[string]string{"message": message})
+	resp := &http.Response{
+		StatusCode:    status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Close:         true,
+	}
+	_ = resp.Write(w)
+}
+
+// createDockerProxyDir creates the directory for a sandbox's proxy socket
+// and sets cfg.DockerProxyDir.
+func createDockerProxyDir(cfg *Config) error {
+	dir, err := os.MkdirTemp(secretsBaseDir(), "cc-sandbox-docker-")
+	if err != nil {
+		return fmt.Errorf("failed to create Docker proxy directory: %w", err)
+	}
+	cfg.DockerProxyDir = dir
+	return nil
+}
+
+// removeDockerProxyDir deletes a proxy directory. The path may come from a
+// container label, so only directories created by createDockerProxyDir are removed.
+func removeDockerProxyDir(dir string) {
+	if dir == "" || !filepath.IsAbs(dir) || !strings.HasPrefix(filepath.Base(dir), "cc-sandbox-docker-") {
+		return
+	}
+	_ = os.RemoveAll(dir)
+}
+
+// startDockerProxy serves the filtering Docker socket for a sandbox run by
+// this process. Returns a nil proxy if the sandbox doesn't use it.
+func startDockerProxy(cfg *Config) (*dockerProxy, error) {
+	if !useDockerProxy(cfg) {
+		return nil, nil
+	}
+	if err := createDockerProxyDir(cfg); err != nil {
+		return nil, err
+	}
+	proxy, err := listenDockerProxy(dockerProxyConfigFor(cfg))
+	if err != nil {
+		removeDockerProxyDir(cfg.DockerProxyDir)
+		return nil, err
+	}
+	return proxy, nil
+}
+
+// startDetachedDockerProxy serves the filtering Docker socket for a named
+// sandbox from a background `cc-sandbox docker-proxy` process, which exits
+// when the sandbox stops. Does nothing if the sandbox doesn't use the proxy.
+func startDetachedDockerProxy(cfg *Config, containerRuntime string) error {
+	if !useDockerProxy(cfg) {
+		return nil
+	}
+	if err := createDockerProxyDir(cfg); err != nil {
+		return err
+	}
+	if err := spawnDockerProxy(containerRuntime, sandboxContainerName(cfg.Name), dockerProxyConfigFor(cfg)); err != nil {
+		removeDockerProxyDir(cfg.DockerProxyDir)
+		return err
+	}
+	return nil
+}
+
+// ensureDockerProxy restarts the proxy process of a named sandbox if it is
+// not running, e.g. before a stopped sandbox is started again.
+func ensureDockerProxy(containerRuntime, name string, cfg dockerProxyConfig) error {
+	return ensureProxyHelper("docker-proxy", containerRuntime, sandboxContainerName(name), filepath.Join(cfg.Dir, dockerProxySocketName), cfg)
+}
+
+// spawnDockerProxy starts a background proxy process for container and waits
+// for its socket.
+func spawnDockerProxy(containerRuntime, container string, cfg dockerProxyConfig) error {
+	return spawnProxyHelper("docker-proxy", containerRuntime, container, filepath.Join(cfg.Dir, dockerProxySocketName), cfg)
+}
+
+// newDockerProxyCmd creates the hidden command that serves the proxy of a
+// named sandbox in the background.
+func newDockerProxyCmd() *cobra.Command {
+	return newProxyHelperCmd("docker-proxy", "Serve the filtering Docker socket of a named sandbox", func(configJSON string) (string, func() (io.Closer, error), error) {
+		var cfg dockerProxyConfig
+		if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+			return "", nil, err
+		}
+		return cfg.Dir, func() (io.Closer, error) {
+			proxy, err := listenDockerProxy(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return proxy.listener, nil
+		}, nil
+	})
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestValidateDockerAllow(t *testing.T) {
+	if err := validateDockerAllow([]string{"privileged", "host-namespaces", "devices", "host-mounts", "/data", "~/cache"}); err != nil {
+		t.Errorf("validateDockerAllow() = %v, want nil", err)
+	}
+	for _, bad := range []string{"privilegd", "relative/path"} {
+		if err := validateDockerAllow([]string{bad}); err == nil {
+			t.Errorf("validateDockerAllow(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestDockerPolicyFor(t *testing.T) {
+	policy := dockerPolicyFor(&Config{Workdir: "/src/api", DockerAllow: []string{"devices", "/data"}})
+	if policy.Workspace != "/src/api" || policy.WorkspaceReadOnly || !policy.Devices || policy.Privileged || len(policy.Paths) != 1 {
+		t.Errorf("dockerPolicyFor() = %+v", policy)
+	}
+	if policy.WorkspaceMount != "/src/api" {
+		t.Errorf("dockerPolicyFor() = %+v, want /workspace translated to the workdir", policy)
+	}
+	if policy := dockerPolicyFor(&Config{Workdir: "/src/api", Isolated: true, Session: "1"}); !policy.WorkspaceReadOnly || policy.WorkspaceMount != "" || len(policy.Volumes) != 1 || policy.Volumes[0] != isolatedVolumePrefix+"1" {
+		t.Errorf("isolated session policy = %+v, want a read-only workspace, no translation and the work volume", policy)
+	}
+	if policy.NoEgress {
+		t.Errorf("dockerPolicyFor() = %+v, want egress without a network policy", policy)
+	}
+	for _, networkPolicy := range []string{networkPolicyNone, networkPolicyAllowlist} {
+		if policy := dockerPolicyFor(&Config{Workdir: "/src/api", NetworkPolicy: networkPolicy}); !policy.NoEgress {
+			t.Errorf("network policy %s: dockerPolicyFor() = %+v, want no egress", networkPolicy, policy)
+		}
+	}
+	if policy := dockerPolicyFor(&Config{Workdir: "/src/api", ReadOnlyWorkspace: true}); !policy.WorkspaceReadOnly || policy.WorkspaceMount != "/src/api" {
+		t.Errorf("read-only workspace policy = %+v", policy)
+	}
+	if policy := dockerPolicyFor(&Config{Workdir: "/src/api", Repo: "git@github.com:org/api.git", RepoVolume: "cc-sandbox-repo-1"}); policy.Workspace != "" || len(policy.Volumes) != 1 || policy.Volumes[0] != "cc-sandbox-repo-1" {
+		t.Errorf("--repo policy = %+v, want no host workspace and the repo volume", policy)
+	}
+}
+
+func TestApplyDockerProxySupport(t *testing.T) {
+	original := isDockerDesktopSocket
+	defer func() { isDockerDesktopSocket = original }()
+	desktop := "/Users/dev/.docker/run/docker.sock"
+	isDockerDesktopSocket = func(socket string) bool { return socket == desktop }
+
+	tests := []struct {
+		name      string
+		cfg       Config
+		source    *valueSource
+		wantProxy bool
+		wantErr   bool
+	}{
+		{"docker desktop", Config{MountDocker: true, DockerProxy: true, DockerSocket: desktop}, nil, false, false},
+		{"proxy asked for", Config{MountDocker: true, DockerProxy: true, DockerSocket: desktop}, &valueSource{Kind: SourceFlag, Origin: "--docker-proxy"}, true, true},
+		{"other socket", Config{MountDocker: true, DockerProxy: true, DockerSocket: "/var/run/docker.sock"}, nil, true, false},
+		{"no docker", Config{DockerProxy: true, DockerSocket: desktop}, nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if tt.source != nil {
+				cfg.setSource("docker_proxy", *tt.source)
+			}
+			err := applyDockerProxySupport(&cfg)
+			if (err != nil) != tt.wantErr || cfg.DockerProxy != tt.wantProxy {
+				t.Errorf("applyDockerProxySupport() = %v, DockerProxy %v, want error %v, DockerProxy %v", err, cfg.DockerProxy, tt.wantErr, tt.wantProxy)
+			}
+		})
+	}
+}
+
+func TestCheckDockerRequest(t *testing.T) {
+	workspace, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/", filepath.Join(workspace, "root")); err != nil {
+		t.Fatal(err)
+	}
+	policy := dockerPolicy{Workspace: workspace, Paths: []string{"/srv/shared"}}
+	create := func(hostConfig string) string { return `{"Image":"alpine","HostConfig":` + hostConfig + `}` }
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		query   string
+		body    string
+		policy  *dockerPolicy
+		allowed bool
+	}{
+		{"plain container", "POST", "/v1.45/containers/create", "", create(`{}`), nil, true},
+		{"list containers", "GET", "/containers/json", "", "", nil, true},
+		{"privileged", "POST", "/v1.45/containers/create", "", create(`{"Privileged":true}`), nil, false},
+		{"privileged allowed", "POST", "/containers/create", "", create(`{"Privileged":true}`), &dockerPolicy{Privileged: true}, true},
+		{"SYS_ADMIN", "POST", "/containers/create", "", create(`{"CapAdd":["CAP_SYS_ADMIN"]}`), nil, false},
+		{"NET_ADMIN", "POST", "/containers/create", "", create(`{"CapAdd":["NET_ADMIN"]}`), nil, true},
+		{"seccomp unconfined", "POST", "/containers/create", "", create(`{"SecurityOpt":["seccomp=unconfined"]}`), nil, false},
+		{"host pid", "POST", "/containers/create", "", create(`{"PidMode":"host"}`), nil, false},
+		{"host network", "POST", "/containers/create", "", create(`{"NetworkMode":"host"}`), nil, false},
+		{"bridge network", "POST", "/containers/create", "", create(`{"NetworkMode":"bridge"}`), nil, true},
+		{"device", "POST", "/containers/create", "", create(`{"Devices":[{"PathOnHost":"/dev/sda"}]}`), nil, false},
+		{"bind of /", "POST", "/containers/create", "", create(`{"Binds":["/:/host"]}`), nil, false},
+		{"bind in workspace", "POST", "/containers/create", "", create(`{"Binds":["` + workspace + `/data:/data:rw"]}`), nil, true},
+		{"bind escaping with ..", "POST", "/containers/create", "", create(`{"Binds":["` + workspace + `/../etc:/etc"]}`), nil, false},
+		{"bind through a symlink", "POST", "/containers/create", "", create(`{"Binds":["` + workspace + `/root/etc:/etc"]}`), nil, false},
+		{"bind of an allowed path", "POST", "/containers/create", "", create(`{"Binds":["/srv/shared/x:/x"]}`), nil, true},
+		{"volumes from", "POST", "/containers/create", "", create(`{"VolumesFrom":["other"]}`), nil, false},
+		{"volumes from allowed", "POST", "/containers/create", "", create(`{"VolumesFrom":["other"]}`), &dockerPolicy{HostMounts: true}, true},
+		{"named volume", "POST", "/containers/create", "", create(`{"Binds":["data:/data"]}`), nil, true},
+		{"sandbox volume", "POST", "/containers/create", "", create(`{"Binds":["cc-sandbox-credentials-1000-work:/c"]}`), nil, false},
+		{"own sandbox volume", "POST", "/containers/create", "", create(`{"Binds":["cc-sandbox-repo-1:/src"]}`), &dockerPolicy{Volumes: []string{"cc-sandbox-repo-1"}}, true},
+		{"sandbox volume mount", "POST", "/containers/create", "", create(`{"Mounts":[{"Type":"volume","Source":"cc-sandbox-isolated-1","Target":"/w"}]}`), nil, false},
+		{"volume mount", "POST", "/containers/create", "", create(`{"Mounts":[{"Type":"volume","Source":"data","Target":"/data"}]}`), nil, true},
+		{"bind mount", "POST", "/containers/create", "", create(`{"Mounts":[{"Type":"bind","Source":"/etc","Target":"/etc"}]}`), nil, false},
+		{"volume mount binding /", "POST", "/containers/create", "", create(`{"Mounts":[{"Type":"volume","Target":"/h","VolumeOptions":{"DriverConfig":{"Options":{"type":"none","o":"bind","device":"/"}}}}]}`), nil, false},
+		{"volume binding /", "POST", "/volumes/create", "", `{"Name":"h","DriverOpts":{"type":"none","o":"bind","device":"/"}}`, nil, false},
+		{"plain volume", "POST", "/volumes/create", "", `{"Name":"data"}`, nil, true},
+		{"sandbox volume name", "POST", "/volumes/create", "", `{"Name":"cc-sandbox-credentials-1000-work"}`, nil, false},
+		{"sandbox volume label", "POST", "/volumes/create", "", `{"Name":"data","Labels":{"cc-sandbox.session":"1"}}`, nil, false},
+		{"privileged exec", "POST", "/v1.45/containers/abc/exec", "", `{"Cmd":["sh"],"Privileged":true}`, nil, false},
+		{"exec", "POST", "/containers/abc/exec", "", `{"Cmd":["sh"]}`, nil, true},
+		{"update adding devices", "POST", "/containers/abc/update", "", `{"Devices":[{"PathOnHost":"/dev/mem"}]}`, nil, false},
+		{"build on host network", "POST", "/build", "networkmode=host", "", nil, false},
+		{"build", "POST", "/build", "t=app", "", nil, true},
+		{"plugin install", "POST", "/plugins/pull", "remote=x", "", nil, false},
+		{"malformed create", "POST", "/containers/create", "", "{", nil, false},
+		{"named container", "POST", "/containers/create", "name=web", create(`{}`), nil, true},
+		{"sandbox container name", "POST", "/containers/create", "name=cc-sandbox-api", create(`{}`), nil, false},
+		{"sandbox label", "POST", "/containers/create", "", `{"Image":"alpine","Labels":{"cc-sandbox.name":"api"}}`, nil, false},
+		{"other label", "POST", "/containers/create", "", `{"Image":"alpine","Labels":{"app":"web"}}`, nil, true},
+		{"rename to a sandbox name", "POST", "/containers/abc/rename", "name=/cc-sandbox-api", "", nil, false},
+		{"rename", "POST", "/containers/abc/rename", "name=web", "", nil, true},
+		{"default network without egress", "POST", "/containers/create", "", `{"HostConfig":{"NetworkMode":"default"},"NetworkingConfig":{"EndpointsConfig":{"default":{}}}}`, &dockerPolicy{NoEgress: true}, true},
+		{"named network without egress", "POST", "/containers/create", "", create(`{"NetworkMode":"app_default"}`), &dockerPolicy{NoEgress: true}, false},
+		{"endpoint without egress", "POST", "/containers/create", "", `{"HostConfig":{},"NetworkingConfig":{"EndpointsConfig":{"app_default":{}}}}`, &dockerPolicy{NoEgress: true}, false},
+		{"shared network without egress", "POST", "/containers/create", "", create(`{"NetworkMode":"container:abc"}`), &dockerPolicy{NoEgress: true}, false},
+		{"network connect without egress", "POST", "/networks/app_default/connect", "", `{"Container":"abc"}`, &dockerPolicy{NoEgress: true}, false},
+		{"network connect", "POST", "/networks/app_default/connect", "", `{"Container":"abc"}`, nil, true},
+		{"build without egress", "POST", "/build", "t=app", "", &dockerPolicy{NoEgress: true}, true},
+		{"build on a network without egress", "POST", "/build", "networkmode=app_default", "", &dockerPolicy{NoEgress: true}, false},
+		{"BuildKit session without egress", "POST", "/session", "", "", &dockerPolicy{NoEgress: true}, false},
+		{"BuildKit session", "POST", "/session", "", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := policy
+			if tt.policy != nil {
+				p = *tt.policy
+			}
+			query, _ := url.ParseQuery(tt.query)
+			var body []byte
+			if needsDockerRequestBody(tt.method, tt.path) {
+				body = []byte(tt.body)
+			}
+			err := checkDockerRequest(p, tt.method, tt.path, query, body)
+			if (err == nil) != tt.allowed {
+				t.Errorf("checkDockerRequest() = %v, want allowed %v", err, tt.allowed)
+			}
+		})
+	}
+
+	// A read-only workspace may only be mounted read-only
+	readOnly := dockerPolicy{Workspace: workspace, WorkspaceReadOnly: true}
+	if err := checkHostMount(readOnly, workspace, false); err == nil {
+		t.Error("writable mount of a read-only workspace was allowed")
+	}
+	if err := checkHostMount(readOnly, workspace, true); err != nil {
+		t.Errorf("read-only mount of a read-only workspace: %v", err)
+	}
+}
+
+// startFakeDaemon serves a Docker-like API on a Unix socket: create returns
+// 201 with the request it received, inspect returns the last created
+// container, start returns 204, exec and archive succeed, and attach
+// switches protocols and echoes its input. Container "other" exists but
+// wasn't created through a proxy.
+func startFakeDaemon(t *testing.T) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets not available: %v", err)
+	}
+	mux := http.NewServeMux()
+	var mu sync.Mutex
+	created := []byte(`{}`)
+	mux.HandleFunc("/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var create struct {
+			Labels     map[string]string
+			HostConfig json.RawMessage
+		}
+		_ = json.Unmarshal(body, &create)
+		inspect := map[string]any{"Config": map[string]any{"Labels": create.Labels}, "HostConfig": create.HostConfig}
+		mu.Lock()
+		created, _ = json.Marshal(inspect)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"Id":"abc","Request":`+string(body)+`}`)
+	})
+	mux.HandleFunc("/containers/abc/json", func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = w.Write(created)
+	})
+	mux.HandleFunc("/containers/abc/start", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/containers/other/json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"Config":{"Labels":{}},"HostConfig":{}}`)
+	})
+	for _, id := range []string{"abc", "other"} {
+		mux.HandleFunc("/containers/"+id+"/exec", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, `{"Id":"e1"}`)
+		})
+		mux.HandleFunc("/containers/"+id+"/archive", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+	mux.HandleFunc("/containers/abc/attach", func(w http.ResponseWriter, _ *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = io.WriteString(conn, "HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		line, _ := buf.ReadString('\n')
+		_, _ = io.WriteString(conn, "echo: "+line)
+	})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = dockerAPIVersionPrefix.ReplaceAllString(r.URL.Path, "")
+		mux.ServeHTTP(w, r)
+	})}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return socket
+}
+
+func TestDockerProxy(t *testing.T) {
+	upstream := startFakeDaemon(t)
+	dir := t.TempDir()
+	proxy, err := listenDockerProxy(dockerProxyConfig{Dir: dir, Upstream: upstream, Policy: dockerPolicy{Workspace: dir, WorkspaceMount: dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = proxy.listener.Close() }()
+	socket := filepath.Join(dir, dockerProxySocketName)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	post := func(body string) (int, string) {
+		resp, err := client.Post("http://docker/v1.45/containers/create", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if status, body := post(`{"HostConfig":{}}`); status != http.StatusCreated || !strings.Contains(body, "abc") {
+		t.Errorf("allowed create = %d %s, want 201 from the daemon", status, body)
+	}
+	// Two requests in a row must both be checked
+	if status, _ := post(`{"HostConfig":{}}`); status != http.StatusCreated {
+		t.Errorf("second create = %d, want 201", status)
+	}
+	// /workspace binds reach the daemon as host paths
+	if status, body := post(`{"HostConfig":{"Binds":["/workspace/data:/data"]}}`); status != http.StatusCreated || !strings.Contains(body, dir+"/data:/data") {
+		t.Errorf("create with a /workspace bind = %d %s, want the host path", status, body)
+	}
+	status, body := post(`{"HostConfig":{"Privileged":true}}`)
+	var apiErr struct{ Message string }
+	_ = json.Unmarshal([]byte(body), &apiErr)
+	if status != http.StatusForbidden || !strings.Contains(apiErr.Message, "privileged containers are not allowed") {
+		t.Errorf("privileged create = %d %s, want 403 with an explanation", status, body)
+	}
+
+	// Attach upgrades the connection, after which the stream is spliced
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_, _ = io.WriteString(conn, "POST /containers/abc/attach?stream=1 HTTP/1.1\r\nHost: docker\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("attach = %v, %v, want 101", resp, err)
+	}
+	_, _ = io.WriteString(conn, "hello\n")
+	if line, err := reader.ReadString('\n'); err != nil || line != "echo: hello\n" {
+		t.Errorf("attach stream = %q, %v, want the echo", line, err)
+	}
+}
+
+func TestDockerProxyStart(t *testing.T) {
+	upstream := startFakeDaemon(t)
+	workspace, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(workspace, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(workspace, "link")
+	if err := os.Symlink(filepath.Join(workspace, "data"), link); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	proxy, err := listenDockerProxy(dockerProxyConfig{Dir: dir, Upstream: upstream, Policy: dockerPolicy{Workspace: workspace}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = proxy.listener.Close() }()
+	socket := filepath.Join(dir, dockerProxySocketName)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	post := func(path, body string) int {
+		resp, err := client.Post("http://docker/v1.45"+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := post("/containers/create", `{"HostConfig":{"Binds":["`+link+`:/data"]}}`); status != http.StatusCreated {
+		t.Fatalf("create with a bind in the workspace = %d, want 201", status)
+	}
+	if status := post("/containers/abc/start", ""); status != http.StatusNoContent {
+		t.Errorf("start = %d, want 204", status)
+	}
+
+	// The symlink now points out of the workspace, which the daemon would
+	// follow when it starts the container
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/", link); err != nil {
+		t.Fatal(err)
+	}
+	if status := post("/containers/abc/start", ""); status != http.StatusForbidden {
+		t.Errorf("start after the symlink was swapped = %d, want 403", status)
+	}
+	if status := post("/containers/abc/restart", ""); status != http.StatusForbidden {
+		t.Errorf("restart after the symlink was swapped = %d, want 403", status)
+	}
+
+	// With a network policy, containers created elsewhere with a network
+	// can't be started
+	proxy.cfg.Policy.NoEgress = true
+	if status := post("/containers/other/start", ""); status != http.StatusForbidden {
+		t.Errorf("start of a networked container without egress = %d, want 403", status)
+	}
+}
+
+func TestDockerProxyEntry(t *testing.T) {
+	upstream := startFakeDaemon(t)
+	dir := t.TempDir()
+	proxy, err := listenDockerProxy(dockerProxyConfig{Dir: dir, Upstream: upstream})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = proxy.listener.Close() }()
+	socket := filepath.Join(dir, dockerProxySocketName)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	request := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, "http://docker/v1.45"+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	// Containers created through the proxy are marked as its own
+	status, body := request("POST", "/containers/create", `{"Labels":{"app":"web"},"HostConfig":{}}`)
+	if status != http.StatusCreated || !strings.Contains(body, `"`+labelDockerParent+`":"`+dir+`"`) || !strings.Contains(body, `"app":"web"`) {
+		t.Fatalf("create = %d %s, want the parent label added", status, body)
+	}
+	if status, _ := request("POST", "/containers/abc/exec", `{"Cmd":["sh"]}`); status != http.StatusCreated {
+		t.Errorf("exec in an own container = %d, want 201", status)
+	}
+	if status, _ := request("PUT", "/containers/abc/archive?path=/tmp", ""); status != http.StatusOK {
+		t.Errorf("copy into an own container = %d, want 200", status)
+	}
+
+	for _, tt := range []struct{ method, path, body string }{
+		{"POST", "/containers/other/exec", `{"Cmd":["sh"]}`},
+		{"PUT", "/containers/other/archive?path=/tmp", ""},
+		{"GET", "/containers/other/archive?path=/run/secrets", ""},
+	} {
+		if status, _ := request(tt.method, tt.path, tt.body); status != http.StatusForbidden {
+			t.Errorf("%s %s = %d, want 403", tt.method, tt.path, status)
+		}
+	}
+}
+
+func TestFinishDockerRequest(t *testing.T) {
+	cfg := dockerProxyConfig{Dir: "/tmp/cc-sandbox-docker-1", Policy: dockerPolicy{NoEgress: true}}
+
+	req, _ := http.NewRequest("POST", "http://docker/v1.45/containers/create", nil)
+	body := `{"Image":"alpine","Labels":{"app":"web"},"HostConfig":{"NetworkMode":"default"},"NetworkingConfig":{"EndpointsConfig":{"default":{}}}}`
+	if err := finishDockerRequest(cfg, req, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(req.Body)
+	var create struct {
+		Labels           map[string]string
+		HostConfig       struct{ NetworkMode string }
+		NetworkingConfig *json.RawMessage
+	}
+	if err := json.Unmarshal(data, &create); err != nil {
+		t.Fatal(err)
+	}
+	if create.Labels[labelDockerParent] != cfg.Dir || create.Labels["app"] != "web" {
+		t.Errorf("labels = %v, want app and the parent label", create.Labels)
+	}
+	if create.HostConfig.NetworkMode != "none" || create.NetworkingConfig != nil {
+		t.Errorf("create = %s, want no network", data)
+	}
+	if req.ContentLength != int64(len(data)) {
+		t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(data))
+	}
+
+	req, _ = http.NewRequest("POST", "http://docker/v1.45/build?t=app", nil)
+	if err := finishDockerRequest(cfg, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.URL.Query().Get("networkmode"); got != "none" || req.URL.Query().Get("t") != "app" {
+		t.Errorf("build query = %q, want networkmode=none", req.URL.RawQuery)
+	}
+}
+
+func TestTranslateDockerRequest(t *testing.T) {
+	policy := dockerPolicy{Workspace: "/src/api", WorkspaceMount: "/src/api"}
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want string // Expected HostConfig; empty if the body must be unchanged
+	}{
+		{"bind", "/v1.45/containers/create", `{"Image":"alpine","HostConfig":{"Binds":["/workspace/data:/data:ro","cache:/cache"]}}`, `{"Binds":["/src/api/data:/data:ro","cache:/cache"]}`},
+		{"workspace itself", "/containers/create", `{"HostConfig":{"Binds":["/workspace:/app"]}}`, `{"Binds":["/src/api:/app"]}`},
+		{"bind mount", "/containers/create", `{"HostConfig":{"Mounts":[{"Type":"bind","Source":"/workspace/db","Target":"/db"}]}}`, `{"Mounts":[{"Source":"/src/api/db","Target":"/db","Type":"bind"}]}`},
+		{"volume mount", "/containers/create", `{"HostConfig":{"Mounts":[{"Type":"volume","Source":"/workspace/db","Target":"/db"}]}}`, ""},
+		{"other host path", "/containers/create", `{"HostConfig":{"Binds":["/workspaces/x:/x","/etc:/etc"]}}`, ""},
+		{"escape with ..", "/containers/create", `{"HostConfig":{"Binds":["/workspace/../etc:/etc"]}}`, ""},
+		{"no host config", "/containers/create", `{"Image":"alpine"}`, ""},
+		{"not a create", "/volumes/create", `{"Name":"/workspace"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := translateDockerRequest(policy, "POST", tt.path, []byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if string(got) != tt.body {
+					t.Errorf("translateDockerRequest() = %s, want the body unchanged", got)
+				}
+				return
+			}
+			var create struct{ HostConfig json.RawMessage }
+			if err := json.Unmarshal(got, &create); err != nil {
+				t.Fatal(err)
+			}
+			if string(create.HostConfig) != tt.want {
+				t.Errorf("HostConfig = %s, want %s", create.HostConfig, tt.want)
+			}
+		})
+	}
+
+	// Sessions whose /workspace is a volume are left alone
+	body := `{"HostConfig":{"Binds":["/workspace:/app"]}}`
+	if got, _ := translateDockerRequest(dockerPolicy{Workspace: "/src/api", WorkspaceReadOnly: true}, "POST", "/containers/create", []byte(body)); string(got) != body {
+		t.Errorf("translateDockerRequest() without a workspace mount = %s", got)
+	}
+	if _, err := translateDockerRequest(policy, "POST", "/containers/create", []byte("{")); err == nil {
+		t.Error("translateDockerRequest() of a malformed body succeeded")
+	}
+}
+
+func TestComposeProjectName(t *testing.T) {
+	tests := []struct {
+		workdir string
+		want    string
+	}{
+		{"/src/api", "api"},
+		{"/src/My.App-2", "myapp-2"},
+		{"/src/_private", "private"},
+		{"/src/..", ""},
+	}
+	for _, tt := range tests {
+		if got := composeProjectName(tt.workdir); got != tt.want {
+			t.Errorf("composeProjectName(%q) = %q, want %q", tt.workdir, got, tt.want)
+		}
+	}
+}
+
+func TestBuildContainerArgsDockerProxy(t *testing.T) {
+	cfg := &Config{Workdir: "/src/api", MountDocker: true, DockerSocket: "/var/run/docker.sock", DockerProxyDir: "/run/user/1000/cc-sandbox-docker-1"}
+	argsStr := joinArgs(buildContainerArgs(cfg, "docker", "test-image", nil))
+	if !contains(argsStr, "-v /run/user/1000/cc-sandbox-docker-1:"+containerDockerDir+" ") || !contains(argsStr, "DOCKER_HOST=unix://"+containerDockerDir+"/docker.sock ") {
+		t.Errorf("buildContainerArgs() = %s, want the proxy directory and DOCKER_HOST", argsStr)
+	}
+	if contains(argsStr, ":/var/run/docker.sock") {
+		t.Errorf("buildContainerArgs() mounted the raw socket: %s", argsStr)
+	}
+	if !contains(argsStr, "-e COMPOSE_PROJECT_NAME=api ") {
+		t.Errorf("buildContainerArgs() = %s, want the Compose project named after the workdir", argsStr)
+	}
+}
+
+func TestRemoveDockerProxyDir(t *testing.T) {
+	base := t.TempDir()
+	proxyDir := filepath.Join(base, "cc-sandbox-docker-123")
+	other := filepath.Join(base, "other")
+	for _, dir := range []string{proxyDir, other} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removeDockerProxyDir(proxyDir)
+	removeDockerProxyDir(other)
+	if _, err := os.Stat(proxyDir); !errors.Is(err, os.ErrNotExist) {
+		t.Error("proxy directory was not removed")
+	}
+	if !dirExists(other) {
+		t.Error("removeDockerProxyDir() removed a directory it did not create")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// containerEntrypoint is the image entrypoint. exec runs commands through it
+// so they get the same user, credentials and git setup as the session.
+const containerEntrypoint = "/usr/local/bin/entrypoint.sh"
+
+// newShellCmd creates the shell subcommand that opens bash in a fresh sandbox.
+func newShellCmd() *cobra.Command {
+	cfg := &Config{}
+	var rootFlag string
+
+	cmd := &cobra.Command{
+		Use:   "shell [flags]",
+		Short: "Open a bash shell in a fresh sandbox",
+		Long: `Start a fresh sandbox running bash instead of Claude, with the same UID mapping,
+mounts, git/gh config and credentials a Claude session gets.
+
+Examples:
+  cc-sandbox shell
+  cc-sandbox shell -i docker --ssh`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg.Root = parseRootFlag(rootFlag)
+			return runSandbox(cfg, []string{"bash"}, cmd.Flags().Changed)
+		},
+	}
+
+	addSandboxFlags(cmd, cfg, &rootFlag)
+
+	return cmd
+}
+
+// newExecCmd creates the exec subcommand that runs a command in a running sandbox.
+func newExecCmd() *cobra.Command {
+	var runtimeFlag string
+
+	cmd := &cobra.Command{
+		Use:   "exec <name|workdir> [--] [command] [args...]",
+		Short: "Run a command in a running sandbox",
+		Long: `Run a command as the sandbox user inside a running sandbox, found by its
+name (from 'cc-sandbox start') or by the host directory it was started in.
+The command runs through the image entrypoint, so it sees the same
+environment as Claude. Without a command, bash is started.
+
+Examples:
+  cc-sandbox exec api-refactor                 # bash in a named sandbox
+  cc-sandbox exec . -- git status              # sandbox running in this directory
+  cc-sandbox exec ~/src/api -- npm test`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			command := execCommand(args[1:])
+			target, err := findRunningSandbox(psRuntimes(runtimeFlag), args[0])
+			if err != nil {
+				return err
+			}
+			return runExec(target, command)
+		},
+	}
+
+	cmd.Flags().StringVar(&runtimeFlag, "runtime", "auto", "Container runtime: auto (all installed), docker, or podman")
+	// Flags after the target belong to the command
+	cmd.Flags().SetInterspersed(false)
+
+	return cmd
+}
+
+// execCommand returns the command to run from the arguments after the target.
+// Flag parsing stops at the target, so a "--" separating the command reaches
+// here and is dropped. Without a command, bash is started.
+func execCommand(args []string) []string {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return []string{"bash"}
+	}
+	return args
+}
+
+// findRunningSandbox finds the running sandbox for target: a sandbox name,
+// or a host directory matched against the workdir label.
+func findRunningSandbox(runtimes []string, target string) (sandboxEntry, error) {
+	entries, err := listSandboxes(runtimes, false)
+	if err != nil {
+		return sandboxEntry{}, err
+	}
+	return matchSandbox(entries, target)
+}
+
+// matchSandbox picks the sandbox for target from entries. A name match wins
+// over a workdir match; several sandboxes in one workdir must be named.
+func matchSandbox(entries []sandboxEntry, target string) (sandboxEntry, error) {
+	for _, e := range entries {
+		if e.Name != "" && e.Name == target {
+			return e, nil
+		}
+	}
+
+	workdir, err := filepath.Abs(expandPath(target))
+	if err != nil {
+		return sandboxEntry{}, fmt.Errorf("failed to resolve %s: %w", target, err)
+	}
+	var matches []sandboxEntry
+	for _, e := range entries {
+		if e.Workdir == workdir {
+			matches = append(matches, e)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return sandboxEntry{}, fmt.Errorf("no running sandbox named %s or started in %s (see 'cc-sandbox ps')", target, workdir)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, 0, len(matches))
+		for _, e := range matches {
+			names = append(names, e.Container)
+		}
+		return sandboxEntry{}, fmt.Errorf("%d sandboxes are running in %s (%s); pick one by name", len(matches), workdir, strings.Join(names, ", "))
+	}
+}
+
+// buildExecArgs returns the runtime arguments that run command in a sandbox.
+// The container's own user (the mapped UID) is kept.
+func buildExecArgs(containerID string, command []string, tty bool) []string {
+	args := []string{"exec", "-i"}
+	if tty {
+		args = append(args, "-t")
+	}
+	args = append(args, "-w", "/workspace", containerID, containerEntrypoint)
+	return append(args, command...)
+}
+
+// runExec runs command in a running sandbox with the terminal attached.
+func runExec(target sandboxEntry, command []string) error {
+	cmd := exec.Command(target.Runtime, buildExecArgs(target.ID, command, isTerminal())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return runForwardingSignals(cmd)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchSandbox(t *testing.T) {
+	workdir := t.TempDir()
+	entries := []sandboxEntry{
+		{ID: "1", Container: "cc-sandbox-api", Name: "api", Workdir: "/src/api"},
+		{ID: "2", Container: "eager_turing", Workdir: workdir},
+		{ID: "3", Container: "cc-sandbox-web-1", Name: "web-1", Workdir: "/src/web"},
+		{ID: "4", Container: "cc-sandbox-web-2", Name: "web-2", Workdir: "/src/web"},
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		wantID  string
+		wantErr bool
+	}{
+		{"by name", "api", "1", false},
+		{"by workdir", workdir, "2", false},
+		{"by workdir with trailing slash", workdir + "/", "2", false},
+		{"workdir of a named sandbox", "/src/api", "1", false},
+		{"ambiguous workdir", "/src/web", "", true},
+		{"no match", "/src/other", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchSandbox(entries, tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("matchSandbox(%q) error = %v, wantErr %v", tt.target, err, tt.wantErr)
+			}
+			if got.ID != tt.wantID {
+				t.Errorf("matchSandbox(%q) = %q, want %q", tt.target, got.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestBuildExecArgs(t *testing.T) {
+	got := joinArgs(buildExecArgs("abc123", []string{"git", "status"}, true))
+	want := "exec -i -t -w /workspace abc123 " + containerEntrypoint + " git status "
+	if got != want {
+		t.Errorf("buildExecArgs() = %q, want %q", got, want)
+	}
+
+	got = joinArgs(buildExecArgs("abc123", []string{"bash"}, false))
+	if contains(got, "-t ") {
+		t.Errorf("buildExecArgs() without a terminal = %q, want no -t", got)
+	}
+}
+
+func TestExecCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"api"}, []string{"bash"}},
+		{[]string{".", "--"}, []string{"bash"}},
+		{[]string{".", "--", "git", "status"}, []string{"git", "status"}},
+		{[]string{".", "git", "status"}, []string{"git", "status"}},
+		{[]string{".", "npm", "--", "test"}, []string{"npm", "--", "test"}},
+		{[]string{"--runtime", "docker", ".", "--", "ls", "-la"}, []string{"ls", "-la"}},
+		{[]string{".", "--", "--version"}, []string{"--version"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(joinArgs(tt.args), func(t *testing.T) {
+			cmd := newExecCmd()
+			if err := cmd.Flags().Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got := execCommand(cmd.Flags().Args()[1:])
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("execCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
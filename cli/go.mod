@@ -3,11 +3,15 @@ module github.com/luwojtaszek/cc-sandbox/cli
 go 1.22
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/spf13/cobra v1.8.1
 	golang.org/x/mod v0.17.0
+	golang.org/x/term v0.29.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
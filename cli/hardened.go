@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// The IDs of the claude user in the images. fixuid remaps the user to the
+// host's IDs at startup when they differ.
+const (
+	imageUserUID = 1000
+	imageUserGID = 1000
+)
+
+// hardenedCapabilities are added back after --cap-drop=ALL when a hardened
+// container has to remap the claude user (see remapsImageUser). Only the
+// entrypoint's remap step, running as root, uses them; gosu then switches to
+// the user, which clears them, so the session runs without capabilities.
+var hardenedCapabilities = []string{
+	"CHOWN",        // hand the home dir, workspace and credentials volume to the host IDs
+	"DAC_OVERRIDE", // walk those files and edit /etc/passwd whoever owns them
+	"SETUID",       // gosu switches to the user
+	"SETGID",       // gosu switches to the user's groups
+}
+
+// seccompProfile is the seccomp profile of hardened containers. It allows
+// everything except the syscalls listed in it: kernel modules, mounts and
+// namespaces, keyrings, ptrace, BPF, io_uring, clock and reboot calls.
+//
+//go:embed seccomp.json
+var seccompProfile []byte
+
+// seccompProfileFile is the name of the seccomp profile in dataBaseDir().
+const seccompProfileFile = "seccomp.json"
+
+// writeSeccompProfile writes the shipped seccomp profile where the runtime
+// CLI can read it and returns its path. The runtime reads it when the
+// container is created, so one copy serves every sandbox.
+func writeSeccompProfile() (string, error) {
+	dir := dataBaseDir()
+	path := filepath.Join(dir, seccompProfileFile)
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, seccompProfile) {
+		return path, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, seccompProfileFile+".*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write seccomp profile: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(seccompProfile); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("failed to write seccomp profile: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write seccomp profile: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write seccomp profile: %w", err)
+	}
+	return path, nil
+}
+
+// remapsImageUser reports whether a hardened container starts as root so the
+// entrypoint can remap the claude user to uid:gid. fixuid does that in other
+// containers, but it is a setuid binary, which no-new-privileges disables.
+// Podman maps the host user to the image's user itself, and on Windows
+// (uid -1) Docker Desktop ignores file ownership.
+func remapsImageUser(cfg *Config, containerRuntime string, uid, gid int) bool {
+	if !cfg.Hardened || containerRuntime == RuntimePodman || uid < 0 || shouldUseRootMode(cfg, containerRuntime) {
+		return false
+	}
+	return uid != imageUserUID || gid != imageUserGID
+}
+
+// hardenedUserArgs returns the user flags of a hardened container that should
+// act as uid:gid on the host. It runs as the image's claude user, which the
+// entrypoint remaps first when the IDs differ (see remapsImageUser).
+func hardenedUserArgs(cfg *Config, containerRuntime string, uid, gid int) []string {
+	image := fmt.Sprintf("%d:%d", imageUserUID, imageUserGID)
+	switch {
+	case containerRuntime == RuntimePodman:
+		return []string{
+			fmt.Sprintf("--userns=keep-id:uid=%d,gid=%d", imageUserUID, imageUserGID),
+			"-u", image,
+			"-e", "CC_SANDBOX_PERMISSION_MODE=skip",
+		}
+	case remapsImageUser(cfg, containerRuntime, uid, gid):
+		return []string{
+			"-u", "0:0",
+			"-e", "CC_SANDBOX_USER=" + strconv.Itoa(uid) + ":" + strconv.Itoa(gid),
+			"-e", "CC_SANDBOX_PERMISSION_MODE=skip",
+		}
+	default:
+		return []string{
+			"-u", image,
+			"-e", "CC_SANDBOX_PERMISSION_MODE=skip",
+		}
+	}
+}
+
+// hardenedArgs returns the flags of --hardened other than the user flags: no
+// capabilities, no privilege gain through setuid binaries, the shipped
+// seccomp profile, and a read-only root filesystem.
+func hardenedArgs(cfg *Config, containerRuntime string, uid, gid int) []string {
+	if !cfg.Hardened {
+		return nil
+	}
+	args := []string{
+		"--cap-drop=ALL",
+		"--security-opt=no-new-privileges",
+		"--read-only",
+		"--tmpfs", "/tmp:rw,exec,mode=1777",
+		"--tmpfs", "/var/tmp:rw,exec,mode=1777",
+		// Also /var/run, a symlink to /run in the images
+		"--tmpfs", "/run:rw,mode=755",
+		"-e", "CC_SANDBOX_HARDENED=1",
+	}
+	if cfg.SeccompProfile != "" {
+		args = append(args, "--security-opt=seccomp="+cfg.SeccompProfile)
+	}
+
+	// Claude is installed in the home dir, which a tmpfs would hide, so the
+	// home dir is an anonymous volume the runtime fills from the image. It
+	// goes away with the container
+	home := "/home/claude"
+	if shouldUseRootMode(cfg, containerRuntime) {
+		home = "/root"
+	}
+	args = append(args, "-v", home)
+
+	if remapsImageUser(cfg, containerRuntime, uid, gid) {
+		for _, capability := range hardenedCapabilities {
+			args = append(args, "--cap-add="+capability)
+		}
+		// The remap edits /etc/passwd and /etc/group, so /etc is a
+		// throwaway copy as well
+		args = append(args, "-v", "/etc")
+	}
+	return args
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHardenedArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *Config
+		runtime  string
+		uid, gid int
+		want     []string
+		wantNot  []string
+	}{
+		{
+			name:    "off",
+			cfg:     &Config{Root: boolPtr(false)},
+			runtime: RuntimeDocker, uid: 1000, gid: 1000,
+			wantNot: []string{"--cap-drop=ALL", "--read-only", "CC_SANDBOX_HARDENED=1"},
+		},
+		{
+			name:    "image user",
+			cfg:     &Config{Root: boolPtr(false), Hardened: true, SeccompProfile: "/data/seccomp.json"},
+			runtime: RuntimeDocker, uid: 1000, gid: 1000,
+			want:    []string{"--cap-drop=ALL", "--security-opt=no-new-privileges", "--security-opt=seccomp=/data/seccomp.json", "--read-only", "--tmpfs /tmp:rw,exec,mode=1777", "--tmpfs /run:rw,mode=755", "-v /home/claude", "-u 1000:1000", "CC_SANDBOX_HARDENED=1"},
+			wantNot: []string{"--cap-add", "-v /etc", "CC_SANDBOX_USER"},
+		},
+		{
+			name:    "remapped user",
+			cfg:     &Config{Root: boolPtr(false), Hardened: true},
+			runtime: RuntimeDocker, uid: 1001, gid: 1000,
+			want:    []string{"--cap-drop=ALL", "--cap-add=CHOWN", "--cap-add=DAC_OVERRIDE", "--cap-add=SETUID", "--cap-add=SETGID", "-v /home/claude", "-v /etc", "-u 0:0", "CC_SANDBOX_USER=1001:1000"},
+			wantNot: []string{"--security-opt=seccomp"},
+		},
+		{
+			name:    "root mode",
+			cfg:     &Config{Root: boolPtr(true), Hardened: true},
+			runtime: RuntimeDocker, uid: 1001, gid: 1001,
+			want:    []string{"--cap-drop=ALL", "-v /root", "-u 0:0", "CC_SANDBOX_PERMISSION_MODE=accept"},
+			wantNot: []string{"--cap-add", "-v /etc", "CC_SANDBOX_USER"},
+		},
+		{
+			name:    "podman",
+			cfg:     &Config{Hardened: true},
+			runtime: RuntimePodman, uid: 1001, gid: 1001,
+			want:    []string{"--cap-drop=ALL", "-v /home/claude", "--userns=keep-id:uid=1000,gid=1000", "-u 1000:1000"},
+			wantNot: []string{"--cap-add", "-v /etc", "CC_SANDBOX_USER"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(hardenedArgs(tt.cfg, tt.runtime, tt.uid, tt.gid), containerUserArgs(tt.cfg, tt.runtime, tt.uid, tt.gid)...)
+			argsStr := joinArgs(args) + " "
+			for _, want := range tt.want {
+				if !contains(argsStr, want+" ") {
+					t.Errorf("args = %s, want %q", argsStr, want)
+				}
+			}
+			for _, notWant := range tt.wantNot {
+				if contains(argsStr, notWant) {
+					t.Errorf("args = %s, should not contain %q", argsStr, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestSeccompProfile(t *testing.T) {
+	var profile struct {
+		DefaultAction string `json:"defaultAction"`
+		Syscalls      []struct {
+			Names  []string `json:"names"`
+			Action string   `json:"action"`
+		} `json:"syscalls"`
+	}
+	if err := json.Unmarshal(seccompProfile, &profile); err != nil {
+		t.Fatalf("seccomp profile is not valid JSON: %v", err)
+	}
+
+	denied := map[string]bool{}
+	for _, rule := range profile.Syscalls {
+		if rule.Action != "SCMP_ACT_ERRNO" {
+			t.Errorf("rule for %v has action %s, want SCMP_ACT_ERRNO", rule.Names, rule.Action)
+		}
+		for _, name := range rule.Names {
+			denied[name] = true
+		}
+	}
+	for _, name := range []string{"mount", "unshare", "setns", "ptrace", "bpf", "keyctl", "init_module", "io_uring_setup", "clone3"} {
+		if !denied[name] {
+			t.Errorf("seccomp profile allows %s", name)
+		}
+	}
+	for _, name := range []string{"read", "execve", "socket"} {
+		if denied[name] {
+			t.Errorf("seccomp profile denies %s", name)
+		}
+	}
+}
+
+func TestWriteSeccompProfile(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	path, err := writeSeccompProfile()
+	if err != nil {
+		t.Fatalf("writeSeccompProfile() error = %v", err)
+	}
+	if want := filepath.Join(dataBaseDir(), seccompProfileFile); path != want {
+		t.Errorf("writeSeccompProfile() = %s, want %s", path, want)
+	}
+
+	// An outdated copy is replaced
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeSeccompProfile(); err != nil {
+		t.Fatalf("writeSeccompProfile() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(seccompProfile) {
+		t.Error("writeSeccompProfile() kept an outdated profile")
+	}
+
+	entries, _ := os.ReadDir(dataBaseDir())
+	if len(entries) != 1 {
+		t.Errorf("data dir has %d entries, want only the profile", len(entries))
+	}
+}
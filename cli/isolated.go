@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// isolatedVolumePrefix starts the names of the volumes holding isolated
+// sessions. Each session has a work volume, mounted at /workspace, and a
+// "-base" volume with the untouched copy that diffs are computed against.
+const isolatedVolumePrefix = "cc-sandbox-isolated-"
+
+// labelSession is set on the containers and volumes of an isolated session.
+const labelSession = "cc-sandbox.session"
+
+// containerSourceDir is where an isolated session sees the host workdir, read-only.
+const containerSourceDir = "/mnt/cc-sandbox-source"
+
+// Mount points of the helper containers that copy and diff session volumes.
+const (
+	helperBaseDir = "/mnt/cc-sandbox-base"
+	helperWorkDir = "/mnt/cc-sandbox-work"
+)
+
+// isolatedCopyScript copies the host workdir ($1) into the work ($2) and
+// base ($3) volumes, keeping ownership and modes.
+const isolatedCopyScript = `set -e
+cp -a "$1/." "$2/"
+cp -a "$1/." "$3/"`
+
+// treeDiffScript prints `git diff <options>` from the tree in $1 to the tree
+// in $2. Both trees are staged in a throwaway repository, so .gitignore rules
+// apply, .git directories are skipped and the trees need not be repositories.
+const treeDiffScript = `set -e
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+export GIT_DIR="$tmp/git" GIT_INDEX_FILE="$tmp/index"
+export GIT_CONFIG_COUNT=1 GIT_CONFIG_KEY_0=safe.directory GIT_CONFIG_VALUE_0='*'
+git init -q
+tree() { (cd "$1" && git -c core.autocrlf=false --work-tree=. add -A . && git write-tree) && rm -f "$GIT_INDEX_FILE"; }
+a=$(tree "$1")
+b=$(tree "$2")
+shift 2
+git diff "$@" "$a" "$b"`
+
+// sessionCommitsScript prints the commits made in the work copy ($2) since
+// the HEAD of the base copy ($1) as an mbox for git am, and reports
+// uncommitted changes on stderr.
+const sessionCommitsScript = `set -e
+export GIT_CONFIG_COUNT=1 GIT_CONFIG_KEY_0=safe.directory GIT_CONFIG_VALUE_0='*'
+base=$(git -C "$1" rev-parse HEAD)
+git -C "$2" format-patch --stdout --binary "$base..HEAD"
+if [ -n "$(git -C "$2" status --porcelain)" ]; then
+    echo "` + uncommittedMarker + `" >&2
+fi`
+
+// uncommittedMarker is written to stderr by sessionCommitsScript when the work
+// copy has uncommitted changes.
+const uncommittedMarker = "cc-sandbox: uncommitted changes"
+
+// isolatedSession is an isolated workspace kept in volumes after its sandbox exited.
+type isolatedSession struct {
+	ID      string
+	Workdir string // Host workdir the session was copied from
+	Image   string
+}
+
+// newSessionID returns a sortable, unique ID for an isolated session.
+func newSessionID(now time.Time) string {
+	b := make([]byte, 2)
+	_, _ = rand.Read(b)
+	return now.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// isolatedVolumes returns the work and base volume names of a session.
+func isolatedVolumes(session string) (work, base string) {
+	work = isolatedVolumePrefix + session
+	return work, work + "-base"
+}
+
+// helperUserArgs runs a helper container as root, so copies keep the owners
+// of the host files. Under podman, root maps to the invoking user.
+func helperUserArgs(containerRuntime string) []string {
+	if containerRuntime == RuntimePodman {
+		return []string{"--userns=keep-id", "-u", "0:0"}
+	}
+	return []string{"-u", "0:0"}
+}
+
+// prepareIsolatedWorkspace creates the volumes of a new isolated session for
+// cfg.Workdir and copies the workdir into them. It sets cfg.Session.
+func prepareIsolatedWorkspace(cfg *Config, containerRuntime, imageName string) error {
+	cfg.Session = newSessionID(time.Now())
+	work, base := isolatedVolumes(cfg.Session)
+
+	labels := []string{
+		labelSession + "=" + cfg.Session,
+		labelWorkdir + "=" + cfg.Workdir,
+		labelImage + "=" + imageName,
+		labelStarted + "=" + time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, volume := range []string{work, base} {
+		args := []string{"volume", "create"}
+		for _, label := range labels {
+			args = append(args, "--label", label)
+		}
+		if _, err := runContainerOutput(containerRuntime, append(args, volume)); err != nil {
+			removeIsolatedVolumes(containerRuntime, cfg.Session)
+			return fmt.Errorf("failed to create volume %s: %w", volume, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Copying %s into isolated session %s...\n", cfg.Workdir, cfg.Session)
+	args := []string{"run", "--rm"}
+	args = append(args, helperUserArgs(containerRuntime)...)
+	args = append(args,
+		"--entrypoint", "/bin/sh",
+		"-v", cfg.Workdir+":"+containerSourceDir+":ro",
+		"-v", work+":"+helperWorkDir,
+		"-v", base+":"+helperBaseDir,
+		imageName,
+		"-c", isolatedCopyScript, "sh", containerSourceDir, helperWorkDir, helperBaseDir)
+	if _, err := runContainerOutput(containerRuntime, args); err != nil {
+		removeIsolatedVolumes(containerRuntime, cfg.Session)
+		return fmt.Errorf("failed to copy the workdir into the session: %w", err)
+	}
+	return nil
+}
+
+// isolatedWorkspaceArgs returns the mounts of an isolated session: the work
+// volume as /workspace and the host workdir read-only for reference.
+func isolatedWorkspaceArgs(cfg *Config) []string {
+	work, _ := isolatedVolumes(cfg.Session)
+	return []string{
+		"-v", work + ":/workspace",
+		"-v", cfg.Workdir + ":" + containerSourceDir + ":ro",
+	}
+}
+
+// printIsolatedHint tells the user how to review and apply a session.
+func printIsolatedHint(w io.Writer, session string) {
+	fmt.Fprintf(w, "Isolated session %s: review with 'cc-sandbox diff %s', apply with 'cc-sandbox apply %s'\n", session, session, session)
+}
+
+// removeIsolatedVolumes deletes the volumes of a session.
+func removeIsolatedVolumes(containerRuntime, session string) {
+	work, base := isolatedVolumes(session)
+	if _, err := runContainerOutputQuiet(containerRuntime, []string{"volume", "rm", "-f", work, base}); err != nil {
+		debugLog("Failed to remove volumes of session %s: %v", session, err)
+	}
+}
+
+// listIsolatedSessions returns the isolated sessions in a runtime, oldest first.
+func listIsolatedSessions(containerRuntime string) ([]isolatedSession, error) {
+	output, err := runContainerOutputQuiet(containerRuntime, []string{
+		"volume", "ls", "-q", "--filter", "label=" + labelSession,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s volumes: %w", containerRuntime, err)
+	}
+	var volumes []string
+	for _, name := range strings.Fields(string(output)) {
+		if !strings.HasSuffix(name, "-base") {
+			volumes = append(volumes, name)
+		}
+	}
+	if len(volumes) == 0 {
+		return nil, nil
+	}
+
+	args := append([]string{"volume", "inspect", "--format", "{{json .Labels}}"}, volumes...)
+	output, err = runContainerOutputQuiet(containerRuntime, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect %s volumes: %w", containerRuntime, err)
+	}
+	return parseIsolatedSessions(string(output)), nil
+}
+
+// parseIsolatedSessions parses one JSON label object per line, as printed by
+// `volume inspect --format '{{json .Labels}}'`, sorted oldest first.
+func parseIsolatedSessions(output string) []isolatedSession {
+	var sessions []isolatedSession
+	for _, line := range strings.Split(output, "\n") {
+		var labels map[string]string
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &labels); err != nil || labels[labelSession] == "" {
+			continue
+		}
+		sessions = append(sessions, isolatedSession{
+			ID:      labels[labelSession],
+			Workdir: labels[labelWorkdir],
+			Image:   labels[labelImage],
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+
+// matchSession picks the session with the given ID, or without an ID the
+// latest session copied from dir.
+func matchSession(sessions []isolatedSession, id, dir string) (isolatedSession, error) {
+	if id != "" {
+		for _, s := range sessions {
+			if s.ID == id || isolatedVolumePrefix+s.ID == id {
+				return s, nil
+			}
+		}
+		return isolatedSession{}, fmt.Errorf("no isolated session %s%s", id, describeSessions(sessions))
+	}
+
+	for i := len(sessions) - 1; i >= 0; i-- {
+		if sessions[i].Workdir == dir {
+			return sessions[i], nil
+		}
+	}
+	return isolatedSession{}, fmt.Errorf("no isolated session for %s%s", dir, describeSessions(sessions))
+}
+
+// describeSessions lists sessions for an error message.
+func describeSessions(sessions []isolatedSession) string {
+	if len(sessions) == 0 {
+		return " (no sessions exist; start one with --isolated)"
+	}
+	var b strings.Builder
+	b.WriteString("; sessions:")
+	for _, s := range sessions {
+		fmt.Fprintf(&b, "\n  %s  %s", s.ID, s.Workdir)
+	}
+	return b.String()
+}
+
+// findSession resolves the session argument of diff, apply and discard.
+func findSession(containerRuntime, id string) (isolatedSession, error) {
+	sessions, err := listIsolatedSessions(containerRuntime)
+	if err != nil {
+		return isolatedSession{}, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return isolatedSession{}, fmt.Errorf("failed to get current directory: %w", err)
+	}
+	return matchSession(sessions, id, cwd)
+}
+
+// runSessionHelper runs script in a helper container with the base and work
+// volumes of a session mounted read-only and returns its standard output.
+// Standard error is returned separately.
+func runSessionHelper(containerRuntime string, s isolatedSession, script string, scriptArgs ...string) ([]byte, string, error) {
+	work, base := isolatedVolumes(s.ID)
+	image := s.Image
+	if image == "" {
+		image = resolveImageName(getEnv("CC_SANDBOX_REGISTRY", DefaultRegistry), "base", containerRuntime)
+	}
+	args := []string{"run", "--rm"}
+	args = append(args, helperUserArgs(containerRuntime)...)
+	args = append(args,
+		"--entrypoint", "/bin/sh",
+		"-v", base+":"+helperBaseDir+":ro",
+		"-v", work+":"+helperWorkDir+":ro",
+		image,
+		"-c", script, "sh", helperBaseDir, helperWorkDir)
+	args = append(args, scriptArgs...)
+
+	var stdout, stderr bytes.Buffer
+	if err := runContainerCapture(containerRuntime, args, &stdout, &stderr); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, "", fmt.Errorf("failed to read session %s: %s", s.ID, msg)
+	}
+	return stdout.Bytes(), stderr.String(), nil
+}
+
+// runContainerCapture runs the container runtime with separate output
+// buffers. Replaced in tests.
+var runContainerCapture = func(containerRuntime string, args []string, stdout, stderr io.Writer) error {
+	cmd := exec.Command(containerRuntime, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// sessionPatch returns the changes made in a session as a git patch.
+func sessionPatch(containerRuntime string, s isolatedSession, diffOptions ...string) ([]byte, error) {
+	patch, _, err := runSessionHelper(containerRuntime, s, treeDiffScript, diffOptions...)
+	return patch, err
+}
+
+// sessionCommits returns the commits made in a session as an mbox, and
+// whether the session also has uncommitted changes.
+func sessionCommits(containerRuntime string, s isolatedSession) ([]byte, bool, error) {
+	mbox, stderr, err := runSessionHelper(containerRuntime, s, sessionCommitsScript)
+	if err != nil {
+		return nil, false, err
+	}
+	return mbox, strings.Contains(stderr, uncommittedMarker), nil
+}
+
+// applySessionPatch applies a patch to the host workdir with git apply. In a
+// subdirectory of a repository, paths are made relative to the workdir.
+func applySessionPatch(workdir string, patch []byte, threeWay bool) error {
+	args := []string{"apply", "--whitespace=nowarn"}
+	if threeWay {
+		args = append(args, "--3way")
+	}
+	if prefix, err := runGit(workdir, "rev-parse", "--show-prefix"); err == nil && prefix != "" {
+		args = append(args, "--directory="+strings.TrimSuffix(prefix, "/"))
+	}
+	return runGitWithInput(workdir, bytes.NewReader(patch), args...)
+}
+
+// runGitWithInput runs git in dir with stdin from input and output on the terminal.
+var runGitWithInput = func(dir string, input io.Reader, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = input
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// newDiffCmd creates the diff subcommand.
+func newDiffCmd() *cobra.Command {
+	var runtimeFlag string
+	var stat bool
+
+	cmd := &cobra.Command{
+		Use:   "diff [session]",
+		Short: "Show the changes made in an isolated session",
+		Long: `Show the changes made in an isolated session (see --isolated) as a git
+patch. Without a session ID, the latest session of the current directory is used.
+
+Examples:
+  cc-sandbox diff
+  cc-sandbox diff 20261016-153045-a1b2 --stat`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			containerRuntime := detectRuntime(&Config{Runtime: runtimeFlag})
+			s, err := findSession(containerRuntime, firstArg(args))
+			if err != nil {
+				return err
+			}
+			options := []string{"--binary"}
+			if stat {
+				options = []string{"--stat"}
+			}
+			patch, err := sessionPatch(containerRuntime, s, options...)
+			if err != nil {
+				return err
+			}
+			if len(patch) == 0 {
+				fmt.Printf("No changes in session %s.\n", s.ID)
+				return nil
+			}
+			_, err = os.Stdout.Write(patch)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&runtimeFlag, "runtime", "auto", "Container runtime: auto, docker, or podman")
+	cmd.Flags().BoolVar(&stat, "stat", false, "Show a diffstat instead of the patch")
+
+	return cmd
+}
+
+// newApplyCmd creates the apply subcommand.
+func newApplyCmd() *cobra.Command {
+	var runtimeFlag string
+	var commits, threeWay, keep bool
+
+	cmd := &cobra.Command{
+		Use:   "apply [session]",
+		Short: "Apply the changes of an isolated session to the host workdir",
+		Long: `Apply the changes made in an isolated session to the directory it was copied
+from, then remove the session. By default the changes are applied as one
+patch to the working tree. With --commits, the commits made in the session
+are applied with 'git am' instead. Without a session ID, the latest session
+of the current directory is used.
+
+Examples:
+  cc-sandbox apply
+  cc-sandbox apply 20261016-153045-a1b2 --commits
+  cc-sandbox apply --3way --keep`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			containerRuntime := detectRuntime(&Config{Runtime: runtimeFlag})
+			s, err := findSession(containerRuntime, firstArg(args))
+			if err != nil {
+				return err
+			}
+			if err := applySession(containerRuntime, s, commits, threeWay); err != nil {
+				return err
+			}
+			if !keep {
+				removeIsolatedVolumes(containerRuntime, s.ID)
+				fmt.Printf("Removed session %s.\n", s.ID)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&runtimeFlag, "runtime", "auto", "Container runtime: auto, docker, or podman")
+	cmd.Flags().BoolVar(&commits, "commits", false, "Apply the commits made in the session with git am")
+	cmd.Flags().BoolVar(&threeWay, "3way", false, "Fall back to a three-way merge if the patch does not apply cleanly")
+	cmd.Flags().BoolVar(&keep, "keep", false, "Keep the session after applying it")
+
+	return cmd
+}
+
+// applySession brings the changes of a session back to its host workdir.
+func applySession(containerRuntime string, s isolatedSession, commits, threeWay bool) error {
+	if !dirExists(s.Workdir) {
+		return fmt.Errorf("workdir %s of session %s no longer exists", s.Workdir, s.ID)
+	}
+
+	if !commits {
+		patch, err := sessionPatch(containerRuntime, s, "--binary")
+		if err != nil {
+			return err
+		}
+		if len(patch) == 0 {
+			fmt.Printf("No changes in session %s.\n", s.ID)
+			return nil
+		}
+		if err := applySessionPatch(s.Workdir, patch, threeWay); err != nil {
+			return fmt.Errorf("failed to apply session %s to %s (try --3way): %w", s.ID, s.Workdir, err)
+		}
+		fmt.Printf("Applied session %s to %s.\n", s.ID, s.Workdir)
+		return nil
+	}
+
+	if _, err := runGit(s.Workdir, "rev-parse", "--git-dir"); err != nil {
+		return fmt.Errorf("--commits needs %s to be a git repository", s.Workdir)
+	}
+	mbox, uncommitted, err := sessionCommits(containerRuntime, s)
+	if err != nil {
+		return err
+	}
+	if uncommitted {
+		fmt.Fprintf(os.Stderr, "Warning: session %s has uncommitted changes, which are not applied; see 'cc-sandbox diff %s'\n", s.ID, s.ID)
+	}
+	if len(mbox) == 0 {
+		if uncommitted {
+			return errors.New("no commits to apply")
+		}
+		fmt.Printf("No commits in session %s.\n", s.ID)
+		return nil
+	}
+	args := []string{"am", "--3way"}
+	if err := runGitWithInput(s.Workdir, bytes.NewReader(mbox), args...); err != nil {
+		return fmt.Errorf("git am failed; resolve it in %s with 'git am --continue' or 'git am --abort': %w", s.Workdir, err)
+	}
+	fmt.Printf("Applied the commits of session %s to %s.\n", s.ID, s.Workdir)
+	return nil
+}
+
+// newDiscardCmd creates the discard subcommand.
+func newDiscardCmd() *cobra.Command {
+	var runtimeFlag string
+
+	cmd := &cobra.Command{
+		Use:   "discard <session> [session...]",
+		Short: "Remove isolated sessions without applying them",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			containerRuntime := detectRuntime(&Config{Runtime: runtimeFlag})
+			sessions, err := listIsolatedSessions(containerRuntime)
+			if err != nil {
+				return err
+			}
+			for _, id := range args {
+				s, err := matchSession(sessions, id, "")
+				if err != nil {
+					return err
+				}
+				removeIsolatedVolumes(containerRuntime, s.ID)
+				fmt.Printf("Removed session %s.\n", s.ID)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&runtimeFlag, "runtime", "auto", "Container runtime: auto, docker, or podman")
+
+	return cmd
+}
+
+// firstArg returns args[0], or "" if there are no args.
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// runScript runs a helper script locally with sh, as the helper container would.
+func runScript(t *testing.T, script string, args ...string) (string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", append([]string{"-c", script, "sh"}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("script failed: %v\n%s", err, stderr.String())
+	}
+	return stdout.String(), stderr.String()
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewSessionID(t *testing.T) {
+	now := time.Date(2026, 10, 16, 15, 30, 45, 0, time.UTC)
+	id := newSessionID(now)
+	if !regexp.MustCompile(`^20261016-153045-[0-9a-f]{4}$`).MatchString(id) {
+		t.Errorf("newSessionID() = %q", id)
+	}
+	work, base := isolatedVolumes(id)
+	if work != "cc-sandbox-isolated-"+id || base != work+"-base" {
+		t.Errorf("isolatedVolumes(%q) = %q, %q", id, work, base)
+	}
+}
+
+func TestBuildContainerArgsIsolated(t *testing.T) {
+	workdir := t.TempDir()
+	cfg := &Config{Workdir: workdir, Isolated: true, Session: "20261016-153045-a1b2"}
+	argsStr := joinArgs(buildContainerArgs(cfg, "docker", "test-image", nil))
+
+	for _, want := range []string{
+		"-v cc-sandbox-isolated-20261016-153045-a1b2:/workspace ",
+		"-v " + workdir + ":" + containerSourceDir + ":ro ",
+		"--label " + labelSession + "=20261016-153045-a1b2 ",
+		"--label " + labelReadOnly + "=true ",
+	} {
+		if !contains(argsStr, want) {
+			t.Errorf("buildContainerArgs() missing %q: %s", want, argsStr)
+		}
+	}
+	if contains(argsStr, workdir+":/workspace") {
+		t.Errorf("buildContainerArgs() bind-mounted the workdir in an isolated session: %s", argsStr)
+	}
+}
+
+func TestPrepareIsolatedWorkspace(t *testing.T) {
+	original := runContainerOutput
+	defer func() { runContainerOutput = original }()
+
+	var calls [][]string
+	runContainerOutput = func(_ string, args []string) ([]byte, error) {
+		calls = append(calls, args)
+		return nil, nil
+	}
+
+	cfg := &Config{Workdir: "/src/api"}
+	if err := prepareIsolatedWorkspace(cfg, "docker", "test-image"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Session == "" || len(calls) != 3 {
+		t.Fatalf("session %q, calls %v, want a session, two volumes and a copy", cfg.Session, calls)
+	}
+	work, base := isolatedVolumes(cfg.Session)
+	for i, volume := range []string{work, base} {
+		got := joinArgs(calls[i])
+		if !contains(got, "volume create ") || !contains(got, "--label "+labelWorkdir+"=/src/api ") || !contains(got, volume+" ") {
+			t.Errorf("call %d = %s, want %s created with the workdir label", i, got, volume)
+		}
+	}
+	copyArgs := joinArgs(calls[2])
+	if !contains(copyArgs, "-v /src/api:"+containerSourceDir+":ro ") || !contains(copyArgs, "-v "+work+":") {
+		t.Errorf("copy = %s, want the workdir read-only and the work volume", copyArgs)
+	}
+}
+
+func TestMatchSession(t *testing.T) {
+	sessions := parseIsolatedSessions(`{"cc-sandbox.session":"20261016-120000-bbbb","cc-sandbox.workdir":"/src/api"}
+{"cc-sandbox.session":"20261016-100000-aaaa","cc-sandbox.workdir":"/src/api","cc-sandbox.image":"img"}
+{"other":"label"}
+{"cc-sandbox.session":"20261016-110000-cccc","cc-sandbox.workdir":"/src/web"}
+`)
+	if len(sessions) != 3 || sessions[0].ID != "20261016-100000-aaaa" || sessions[0].Image != "img" {
+		t.Fatalf("parseIsolatedSessions() = %+v, want 3 sessions oldest first", sessions)
+	}
+
+	tests := []struct {
+		name    string
+		id, dir string
+		want    string
+		wantErr bool
+	}{
+		{"by ID", "20261016-110000-cccc", "/elsewhere", "20261016-110000-cccc", false},
+		{"by volume name", "cc-sandbox-isolated-20261016-100000-aaaa", "", "20261016-100000-aaaa", false},
+		{"latest in dir", "", "/src/api", "20261016-120000-bbbb", false},
+		{"unknown ID", "nope", "/src/api", "", true},
+		{"no session in dir", "", "/src/other", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchSession(sessions, tt.id, tt.dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("matchSession() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.ID != tt.want {
+				t.Errorf("matchSession() = %q, want %q", got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestTreeDiffScript(t *testing.T) {
+	base, work := t.TempDir(), t.TempDir()
+	writeFiles(t, base, map[string]string{"keep.txt": "same\n", "edit.txt": "one\n", "gone.txt": "bye\n"})
+	writeFiles(t, work, map[string]string{
+		"keep.txt":       "same\n",
+		"edit.txt":       "one\ntwo\n",
+		"dir/new.txt":    "hello\n",
+		".gitignore":     "build/\n",
+		"build/out.o":    "ignored\n",
+		".git/HEAD":      "ref: refs/heads/main\n",
+		"dir/.gitignore": "",
+	})
+
+	patch, _ := runScript(t, treeDiffScript, base, work, "--binary")
+	for _, want := range []string{"diff --git a/edit.txt b/edit.txt", "+two", "b/dir/new.txt", "deleted file mode", "a/gone.txt"} {
+		if !contains(patch, want) {
+			t.Errorf("patch missing %q:\n%s", want, patch)
+		}
+	}
+	for _, unwanted := range []string{"keep.txt", "build/out.o", ".git/HEAD"} {
+		if contains(patch, unwanted) {
+			t.Errorf("patch contains %q:\n%s", unwanted, patch)
+		}
+	}
+
+	// The patch brings a copy of the base to the state of the work tree
+	if err := applySessionPatch(base, []byte(patch), false); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"edit.txt": "one\ntwo\n", "dir/new.txt": "hello\n"} {
+		got, err := os.ReadFile(filepath.Join(base, name))
+		if err != nil || string(got) != want {
+			t.Errorf("%s after apply = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(base, "gone.txt")); !os.IsNotExist(err) {
+		t.Error("gone.txt was not deleted by the patch")
+	}
+}
+
+func TestSessionCommitsScript(t *testing.T) {
+	base := newTestRepo(t)
+	writeFiles(t, base, map[string]string{"a.txt": "a\n"})
+	gitOrFail(t, base, "add", "a.txt")
+	gitOrFail(t, base, "commit", "-q", "-m", "add a")
+
+	work := filepath.Join(t.TempDir(), "work")
+	if out, err := exec.Command("cp", "-a", base, work).CombinedOutput(); err != nil {
+		t.Skipf("cp -a failed: %v %s", err, out)
+	}
+	writeFiles(t, work, map[string]string{"b.txt": "b\n"})
+	gitOrFail(t, work, "add", "b.txt")
+	gitOrFail(t, work, "commit", "-q", "-m", "add b")
+	writeFiles(t, work, map[string]string{"a.txt": "changed\n"})
+
+	mbox, stderr := runScript(t, sessionCommitsScript, base, work)
+	if !contains(mbox, "Subject: [PATCH] add b") || contains(mbox, "add a") {
+		t.Errorf("mbox does not hold exactly the session's commit:\n%s", mbox)
+	}
+	if !contains(stderr, uncommittedMarker) {
+		t.Errorf("stderr = %q, want the uncommitted changes marker", stderr)
+	}
+
+	if err := runGitWithInput(base, bytes.NewReader([]byte(mbox)), "am", "--3way"); err != nil {
+		t.Fatal(err)
+	}
+	if got := gitOrFail(t, base, "log", "-1", "--format=%s"); got != "add b" {
+		t.Errorf("HEAD after git am = %q, want add b", got)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// phaseTiming is the duration of one launch phase.
+type phaseTiming struct {
+	Name     string
+	Duration time.Duration
+}
+
+// phaseTimer records how long each phase of a launch takes, for --timings.
+// A disabled timer records nothing.
+type phaseTimer struct {
+	enabled bool
+	start   time.Time
+	last    time.Time
+	phases  []phaseTiming
+}
+
+// newPhaseTimer starts a timer. Phases are measured from the previous mark.
+func newPhaseTimer(enabled bool) *phaseTimer {
+	now := time.Now()
+	return &phaseTimer{enabled: enabled, start: now, last: now}
+}
+
+// mark ends the current phase under the given name.
+func (t *phaseTimer) mark(name string) {
+	if !t.enabled {
+		return
+	}
+	now := time.Now()
+	t.phases = append(t.phases, phaseTiming{Name: name, Duration: now.Sub(t.last)})
+	t.last = now
+}
+
+// report writes the recorded phases and their total to w.
+func (t *phaseTimer) report(w io.Writer) {
+	if !t.enabled {
+		return
+	}
+	var total time.Duration
+	_, _ = fmt.Fprintln(w, "[cc-sandbox] timings:")
+	for _, p := range t.phases {
+		_, _ = fmt.Fprintf(w, "  %-10s %8.1fms\n", p.Name, float64(p.Duration.Microseconds())/1000)
+		total += p.Duration
+	}
+	_, _ = fmt.Fprintf(w, "  %-10s %8.1fms\n", "total", float64(total.Microseconds())/1000)
+}
+
+// prefetchLaunchProbes runs the independent host and runtime checks a launch
+// needs concurrently and reports whether imageName exists locally. The other
+// results are cached by the probes themselves, so buildContainerArgs reuses
+// them without starting more subprocesses.
+func prefetchLaunchProbes(cfg *Config, containerRuntime, imageName string) bool {
+	var wg sync.WaitGroup
+	run := func(probe func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probe()
+		}()
+	}
+
+	// Local images (e.g. cc-sandbox:base) are never pulled, so need no check
+	imageExists := true
+	if isRegistryImage(imageName) {
+		run(func() { imageExists = imageExistsLocally(imageName, containerRuntime) })
+	}
+
+	// Named accounts map straight to a volume name; only the default account
+	// checks for the legacy volume
+	if cfg.Account == "" || cfg.Account == defaultAccount {
+		run(func() { getCredentialsVolumeName() })
+	}
+
+	// Only needed when neither value is overridden
+	if cfg.GitUserName == "" || cfg.GitUserEmail == "" {
+		run(func() { getGitUserConfigBatched() })
+	}
+
+	// Root mode detection may query `docker info`
+	if cfg.Root == nil && containerRuntime != RuntimePodman {
+		run(func() { shouldUseRootMode(cfg, containerRuntime) })
+	}
+
+	wg.Wait()
+	return imageExists
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPhaseTimer(t *testing.T) {
+	timer := newPhaseTimer(true)
+	timer.mark("config")
+	timer.mark("probes")
+
+	var buf bytes.Buffer
+	timer.report(&buf)
+	out := buf.String()
+	for _, want := range []string{"timings:", "config", "probes", "total"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report() missing %q:\n%s", want, out)
+		}
+	}
+
+	disabled := newPhaseTimer(false)
+	disabled.mark("config")
+	buf.Reset()
+	disabled.report(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("disabled timer reported: %q", buf.String())
+	}
+}
+
+func TestPrefetchLaunchProbes(t *testing.T) {
+	original := imageExistsLocally
+	defer func() { imageExistsLocally = original }()
+
+	var checked []string
+	imageExistsLocally = func(imageName, _ string) bool {
+		checked = append(checked, imageName)
+		return false
+	}
+
+	// Everything overridden: only the image check is left to run
+	cfg := &Config{
+		Account:      "work",
+		GitUserName:  "Jane",
+		GitUserEmail: "jane@example.com",
+		Root:         boolPtr(false),
+	}
+	if prefetchLaunchProbes(cfg, "docker", "ghcr.io/luwojtaszek/cc-sandbox:base") {
+		t.Error("prefetchLaunchProbes() = true, want false for a missing registry image")
+	}
+	if len(checked) != 1 {
+		t.Errorf("imageExistsLocally called %d times, want 1", len(checked))
+	}
+
+	// Local images are never pulled, so they are not inspected
+	checked = nil
+	if !prefetchLaunchProbes(cfg, "docker", "cc-sandbox:base") {
+		t.Error("prefetchLaunchProbes() = false, want true for a local image")
+	}
+	if len(checked) != 0 {
+		t.Errorf("imageExistsLocally called for a local image: %v", checked)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// timeoutExitCode is the exit status of a session stopped by --timeout, as
+// with timeout(1).
+const timeoutExitCode = 124
+
+// memoryLimitPattern matches a --memory or --disk value the runtimes accept,
+// e.g. 4g or 512m.
+var memoryLimitPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[bkmgBKMG]?$`)
+
+// validateResourceLimits checks --memory, --cpus, --pids-limit, --disk and
+// --timeout.
+// They are strings in Config so config files and env vars can set them.
+func validateResourceLimits(cfg *Config) error {
+	if cfg.Memory != "" && !memoryLimitPattern.MatchString(cfg.Memory) {
+		return fmt.Errorf("invalid memory limit %q: use a size like 4g or 512m", cfg.Memory)
+	}
+	if cfg.CPUs != "" {
+		if cpus, err := strconv.ParseFloat(cfg.CPUs, 64); err != nil || cpus <= 0 {
+			return fmt.Errorf("invalid cpus %q: use a number like 2 or 1.5", cfg.CPUs)
+		}
+	}
+	if cfg.PidsLimit != "" {
+		if pids, err := strconv.Atoi(cfg.PidsLimit); err != nil || pids == 0 || pids < -1 {
+			return fmt.Errorf("invalid pids limit %q: use a positive number, or -1 for no limit", cfg.PidsLimit)
+		}
+	}
+	if cfg.Disk != "" && !memoryLimitPattern.MatchString(cfg.Disk) {
+		return fmt.Errorf("invalid disk limit %q: use a size like 20g", cfg.Disk)
+	}
+	_, err := parseSessionTimeout(cfg.Timeout)
+	return err
+}
+
+// parseSessionTimeout parses a --timeout value; empty means no timeout.
+func parseSessionTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid timeout %q: use a duration like 30m or 2h", value)
+	}
+	return timeout, nil
+}
+
+// resourceLimitArgs returns the container flags for the sandbox's resource
+// limits. The disk limit caps the container's writable layer; the runtime
+// refuses it on storage drivers without per-container quotas.
+func resourceLimitArgs(cfg *Config) []string {
+	var args []string
+	if cfg.Memory != "" {
+		args = append(args, "--memory", cfg.Memory)
+	}
+	if cfg.CPUs != "" {
+		args = append(args, "--cpus", cfg.CPUs)
+	}
+	if cfg.PidsLimit != "" {
+		args = append(args, "--pids-limit", cfg.PidsLimit)
+	}
+	if cfg.Disk != "" {
+		args = append(args, "--storage-opt", "size="+cfg.Disk)
+	}
+	return args
+}
+
+// sessionTimeout stops a session's container when its timeout expires: the
+// runtime sends SIGTERM, then SIGKILL after interruptGracePeriod.
+type sessionTimeout struct {
+	timer   *time.Timer
+	done    chan struct{} // Closed by stop
+	expired atomic.Bool
+}
+
+// startSessionTimeout arms the timeout of a session whose container ID is
+// written to cfg.CIDFile. Returns nil if the session has no timeout.
+func startSessionTimeout(cfg *Config, containerRuntime string, w io.Writer) *sessionTimeout {
+	timeout, _ := parseSessionTimeout(cfg.Timeout)
+	if timeout == 0 {
+		return nil
+	}
+	t := &sessionTimeout{done: make(chan struct{})}
+	t.timer = time.AfterFunc(timeout, func() {
+		// The container may not have been created yet, e.g. while a large
+		// workspace is copied; it is stopped as soon as it is. A session that
+		// ends before that didn't time out
+		if !waitForCIDFile(cfg.CIDFile, t.done) {
+			return
+		}
+		t.expired.Store(true)
+		fmt.Fprintf(w, "\n[cc-sandbox] Session timed out after %s, stopping the container\n", timeout)
+		stopContainerFromCIDFile(containerRuntime, cfg.CIDFile, interruptGracePeriod)
+	})
+	return t
+}
+
+// stop disarms the timeout and reports whether it expired. It is safe to
+// call on a nil timeout.
+func (t *sessionTimeout) stop() bool {
+	if t == nil {
+		return false
+	}
+	t.timer.Stop()
+	close(t.done)
+	return t.expired.Load()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidateResourceLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"no limits", Config{}, false},
+		{"all limits", Config{Memory: "4g", CPUs: "1.5", PidsLimit: "512", Timeout: "30m"}, false},
+		{"memory in bytes", Config{Memory: "536870912"}, false},
+		{"memory unit", Config{Memory: "4gb"}, true},
+		{"memory negative", Config{Memory: "-1g"}, true},
+		{"cpus zero", Config{CPUs: "0"}, true},
+		{"cpus not a number", Config{CPUs: "two"}, true},
+		{"pids unlimited", Config{PidsLimit: "-1"}, false},
+		{"pids zero", Config{PidsLimit: "0"}, true},
+		{"pids negative", Config{PidsLimit: "-2"}, true},
+		{"timeout without unit", Config{Timeout: "30"}, true},
+		{"timeout negative", Config{Timeout: "-5m"}, true},
+		{"disk", Config{Disk: "20g"}, false},
+		{"disk unit", Config{Disk: "20GiB"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateResourceLimits(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateResourceLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSessionTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"90s", 90 * time.Second, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"soon", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSessionTimeout(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSessionTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSessionTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildContainerArgsResourceLimits(t *testing.T) {
+	cfg := &Config{Workdir: "/home/user/project", Memory: "4g", CPUs: "2", PidsLimit: "512", Disk: "20g", Timeout: "30m"}
+	argsStr := joinArgs(buildContainerArgs(cfg, RuntimeDocker, "img", nil))
+	for _, want := range []string{"--memory 4g ", "--cpus 2 ", "--pids-limit 512 ", "--storage-opt size=20g "} {
+		if !contains(argsStr, want) {
+			t.Errorf("buildContainerArgs() = %s, want %q", argsStr, want)
+		}
+	}
+	if contains(argsStr, "30m") {
+		t.Errorf("buildContainerArgs() = %s, timeout should not be a container flag", argsStr)
+	}
+
+	if got := resourceLimitArgs(&Config{}); got != nil {
+		t.Errorf("resourceLimitArgs() without limits = %v, want nil", got)
+	}
+}
+
+// missingRuntime is a runtime CLI that doesn't exist, so stopping a
+// container does nothing.
+const missingRuntime = "cc-sandbox-test-missing-runtime"
+
+func TestSessionTimeout(t *testing.T) {
+	if timeout := startSessionTimeout(&Config{}, missingRuntime, io.Discard); timeout != nil {
+		t.Fatal("startSessionTimeout() without a timeout should return nil")
+	}
+	var none *sessionTimeout
+	if none.stop() {
+		t.Error("stop() on a nil timeout reported expiry")
+	}
+
+	// A session that ends before its container was created didn't time out
+	cidFile := filepath.Join(t.TempDir(), "cid")
+	timeout := startSessionTimeout(&Config{Timeout: "10ms", CIDFile: cidFile}, missingRuntime, io.Discard)
+	time.Sleep(50 * time.Millisecond)
+	if timeout.stop() {
+		t.Error("stop() without a container = true, want false")
+	}
+
+	// A container created after the timeout expired is stopped once it exists
+	timeout = startSessionTimeout(&Config{Timeout: "10ms", CIDFile: cidFile}, missingRuntime, io.Discard)
+	time.Sleep(50 * time.Millisecond)
+	if timeout.expired.Load() {
+		t.Fatal("timeout expired before the container was created")
+	}
+	if err := os.WriteFile(cidFile, []byte("abc123\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !timeout.expired.Load() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !timeout.stop() {
+		t.Error("stop() after expiry = false, want true")
+	}
+
+	timeout = startSessionTimeout(&Config{Timeout: "1h", CIDFile: cidFile}, missingRuntime, io.Discard)
+	if timeout.stop() {
+		t.Error("stop() before expiry = true, want false")
+	}
+}
+
+func TestResolveConfigImageDefaults(t *testing.T) {
+	tmpDir := t.TempDir()
+	userConfig := filepath.Join(tmpDir, "config.yaml")
+	content := `default:
+  memory: 2g
+  cpus: "2"
+images:
+  bun-full:
+    image: base
+    memory: 8g
+    cpus: "4"
+    timeout: 2h
+    env:
+      - BUN_RUNTIME=1
+profiles:
+  small:
+    cpus: "1"
+`
+	if err := os.WriteFile(userConfig, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Setenv("CC_SANDBOX_CONFIG_FILE", userConfig)
+	defer func() { _ = os.Unsetenv("CC_SANDBOX_CONFIG_FILE") }()
+	for _, key := range []string{"CC_SANDBOX_DEFAULT_IMAGE", "CC_SANDBOX_PROFILE"} {
+		_ = os.Unsetenv(key)
+	}
+
+	workdir := filepath.Join(tmpDir, "project")
+	if err := os.MkdirAll(workdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		cfg         Config
+		flags       []string
+		wantImage   string
+		wantMemory  string
+		wantCPUs    string
+		wantTimeout string
+		wantEnv     []string
+	}{
+		{"other image", Config{}, nil, "base", "2g", "2", "", nil},
+		{"image defaults", Config{Image: "bun-full"}, []string{"image"}, "bun-full", "8g", "4", "2h", []string{"BUN_RUNTIME=1"}},
+		{"profile beats image", Config{Image: "bun-full", Profile: "small"}, []string{"image"}, "bun-full", "8g", "1", "2h", []string{"BUN_RUNTIME=1"}},
+		{"flag beats image", Config{Image: "bun-full", Memory: "16g"}, []string{"image", "memory"}, "bun-full", "16g", "4", "2h", []string{"BUN_RUNTIME=1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Workdir = workdir
+			flags := map[string]bool{}
+			for _, f := range tt.flags {
+				flags[f] = true
+			}
+			if err := resolveConfig(&cfg, func(name string) bool { return flags[name] }); err != nil {
+				t.Fatalf("resolveConfig() error = %v", err)
+			}
+
+			if cfg.Image != tt.wantImage {
+				t.Errorf("Image = %q, want %q", cfg.Image, tt.wantImage)
+			}
+			if cfg.Memory != tt.wantMemory {
+				t.Errorf("Memory = %q, want %q", cfg.Memory, tt.wantMemory)
+			}
+			if cfg.CPUs != tt.wantCPUs {
+				t.Errorf("CPUs = %q, want %q", cfg.CPUs, tt.wantCPUs)
+			}
+			if cfg.Timeout != tt.wantTimeout {
+				t.Errorf("Timeout = %q, want %q", cfg.Timeout, tt.wantTimeout)
+			}
+			if !reflect.DeepEqual(cfg.EnvVars, tt.wantEnv) {
+				t.Errorf("Env = %v, want %v", cfg.EnvVars, tt.wantEnv)
+			}
+		})
+	}
+}
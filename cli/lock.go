@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// workspaceLock is held while a sandbox may edit a workspace.
+type workspaceLock struct {
+	file *os.File
+}
+
+// release unlocks the workspace. It is safe to call on a nil lock.
+func (l *workspaceLock) release() {
+	if l == nil || l.file == nil {
+		return
+	}
+	unlockFile(l.file)
+	_ = l.file.Close()
+	l.file = nil
+}
+
+// workspaceInUseError reports who holds a workspace and how to proceed.
+type workspaceInUseError struct {
+	Workdir string
+	Holder  string       // Description of the session holding the lock
+	Sandbox sandboxEntry // Running sandbox holding the workspace, if known
+}
+
+func (e *workspaceInUseError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "workspace %s is already in use by %s\n", e.Workdir, e.Holder)
+	b.WriteString("Options:\n")
+	if e.Sandbox.Name != "" {
+		fmt.Fprintf(&b, "  cc-sandbox attach %s       # reconnect to it\n", e.Sandbox.Name)
+		fmt.Fprintf(&b, "  cc-sandbox exec %s -- ...  # run a command in it\n", e.Sandbox.Name)
+	} else if e.Sandbox.ID != "" {
+		fmt.Fprintf(&b, "  cc-sandbox exec %s -- ...  # run a command in it\n", e.Workdir)
+	}
+	b.WriteString("  --read-only-workspace       # mount the workspace read-only\n")
+	b.WriteString("  --force                     # run anyway")
+	return b.String()
+}
+
+// resolveWorkspacePath returns the canonical host path used to key workspace
+// locks, so symlinked and relative paths to one directory share a lock.
+func resolveWorkspacePath(workdir string) string {
+	path, err := filepath.Abs(workdir)
+	if err != nil {
+		return workdir
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// workspaceLockPath returns the lock file for a resolved workspace path.
+func workspaceLockPath(workspace string) string {
+	sum := sha256.Sum256([]byte(workspace))
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "cc-sandbox", "locks", hex.EncodeToString(sum[:12])+".lock")
+}
+
+// lockWorkspace takes the exclusive lock on cfg.Workdir for a read-write
+// sandbox. Two things hold a workspace: a cc-sandbox process with the lock
+// file locked (released by the OS even on a crash), and a running container
+// labeled with the workdir (e.g. a sandbox from `cc-sandbox start`).
+// Read-only, isolated, --repo and --force runs take no lock; the returned
+// lock is then nil.
+func lockWorkspace(cfg *Config, containerRuntime string) (*workspaceLock, error) {
+	if cfg.Force || cfg.ReadOnlyWorkspace || cfg.Isolated || cfg.Repo != "" {
+		return nil, nil
+	}
+	workspace := resolveWorkspacePath(cfg.Workdir)
+
+	lock, err := lockWorkspaceFile(workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	if sandbox, ok := findWorkspaceSandbox(containerRuntime, cfg.Workdir, workspace); ok {
+		lock.release()
+		holder := "sandbox " + sandbox.Container
+		if sandbox.Name != "" {
+			holder = "sandbox " + sandbox.Name
+		}
+		return nil, &workspaceInUseError{Workdir: workspace, Holder: holder, Sandbox: sandbox}
+	}
+	return lock, nil
+}
+
+// lockWorkspaceFile locks the lock file of a resolved workspace path. It
+// returns a *workspaceInUseError if another cc-sandbox process holds it.
+func lockWorkspaceFile(workspace string) (*workspaceLock, error) {
+	path := workspaceLockPath(workspace)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workspace lock: %w", err)
+	}
+	if !tryLockFile(f) {
+		holder := "another cc-sandbox session"
+		if pid := readLockHolder(f); pid > 0 {
+			holder += fmt.Sprintf(" (pid %d)", pid)
+		}
+		_ = f.Close()
+		return nil, &workspaceInUseError{Workdir: workspace, Holder: holder}
+	}
+
+	// Record the holder for the message shown to the next session
+	_ = f.Truncate(0)
+	_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"+workspace+"\n"), 0)
+	return &workspaceLock{file: f}, nil
+}
+
+// readLockHolder returns the PID recorded in a lock file, or 0.
+func readLockHolder(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	line, _, _ := strings.Cut(string(buf[:n]), "\n")
+	pid, _ := strconv.Atoi(line)
+	return pid
+}
+
+// findWorkspaceSandbox returns a running read-write sandbox whose workdir
+// label is workdir or its resolved path, workspace. The label filter keeps
+// this to a single subprocess per path when the workspace is free.
+func findWorkspaceSandbox(containerRuntime, workdir, workspace string) (sandboxEntry, bool) {
+	candidates := []string{workdir}
+	if workspace != workdir {
+		candidates = append(candidates, workspace)
+	}
+
+	for _, path := range candidates {
+		output, err := runContainerOutputQuiet(containerRuntime, []string{
+			"ps", "-q", "--no-trunc", "--filter", "label=" + labelWorkdir + "=" + path,
+		})
+		if err != nil {
+			debugLog("Workspace lock: failed to list containers: %v", err)
+			return sandboxEntry{}, false
+		}
+		ids := strings.Fields(string(output))
+		if len(ids) == 0 {
+			continue
+		}
+
+		inspectArgs := append([]string{"container", "inspect", "--format", containerInspectFormat}, ids...)
+		output, err = runContainerOutputQuiet(containerRuntime, inspectArgs)
+		if err != nil {
+			continue
+		}
+		for _, e := range parseSandboxEntries(string(output), containerRuntime) {
+			if !e.ReadOnly {
+				return e, true
+			}
+		}
+	}
+	return sandboxEntry{}, false
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// useTempLockDir points the user cache directory, and so the lock files, at a
+// temporary directory.
+func useTempLockDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("LocalAppData", dir)
+}
+
+func TestResolveWorkspacePath(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	if got := resolveWorkspacePath(link); got != dir {
+		t.Errorf("resolveWorkspacePath(%q) = %q, want %q", link, got, dir)
+	}
+	if workspaceLockPath(resolveWorkspacePath(link)) != workspaceLockPath(resolveWorkspacePath(dir)) {
+		t.Error("a symlink and its target got different lock files")
+	}
+}
+
+func TestLockWorkspace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("lock files are not locked on Windows")
+	}
+	useTempLockDir(t)
+	original := runContainerOutputQuiet
+	defer func() { runContainerOutputQuiet = original }()
+	runContainerOutputQuiet = func(_ string, _ []string) ([]byte, error) {
+		return nil, nil
+	}
+
+	workdir := t.TempDir()
+	lock, err := lockWorkspace(&Config{Workdir: workdir}, "docker")
+	if err != nil || lock == nil {
+		t.Fatalf("lockWorkspace() = %v, %v, want a lock", lock, err)
+	}
+
+	_, err = lockWorkspace(&Config{Workdir: workdir}, "docker")
+	var inUse *workspaceInUseError
+	if !errors.As(err, &inUse) {
+		t.Fatalf("second lockWorkspace() error = %v, want *workspaceInUseError", err)
+	}
+	if !contains(inUse.Holder, "pid ") {
+		t.Errorf("holder = %q, want the PID of the lock holder", inUse.Holder)
+	}
+
+	// Read-only and forced runs don't take or need the lock
+	for _, cfg := range []*Config{{Workdir: workdir, ReadOnlyWorkspace: true}, {Workdir: workdir, Force: true}} {
+		if l, err := lockWorkspace(cfg, "docker"); err != nil || l != nil {
+			t.Errorf("lockWorkspace(%+v) = %v, %v, want no lock and no error", cfg, l, err)
+		}
+	}
+
+	lock.release()
+	lock, err = lockWorkspace(&Config{Workdir: workdir}, "docker")
+	if err != nil {
+		t.Fatalf("lockWorkspace() after release = %v", err)
+	}
+	lock.release()
+}
+
+func TestLockWorkspaceRunningSandbox(t *testing.T) {
+	useTempLockDir(t)
+	original := runContainerOutputQuiet
+	defer func() { runContainerOutputQuiet = original }()
+
+	readOnly := false
+	var filters []string
+	runContainerOutputQuiet = func(_ string, args []string) ([]byte, error) {
+		if args[0] == "ps" {
+			filters = append(filters, args[len(args)-1])
+			return []byte("0123abcd\n"), nil
+		}
+		labels := `{"cc-sandbox.version":"1.0.0","cc-sandbox.name":"api"}`
+		if readOnly {
+			labels = `{"cc-sandbox.version":"1.0.0","cc-sandbox.name":"api","cc-sandbox.read-only":"true"}`
+		}
+		return []byte("0123abcd\t/cc-sandbox-api\trunning\t" + labels + "\n"), nil
+	}
+
+	workdir := t.TempDir()
+	_, err := lockWorkspace(&Config{Workdir: workdir}, "docker")
+	var inUse *workspaceInUseError
+	if !errors.As(err, &inUse) || inUse.Sandbox.Name != "api" {
+		t.Fatalf("lockWorkspace() error = %v, want the workspace held by sandbox api", err)
+	}
+	if !contains(err.Error(), "cc-sandbox attach api") {
+		t.Errorf("error does not suggest attaching:\n%s", err)
+	}
+	if filters[0] != "label="+labelWorkdir+"="+workdir {
+		t.Errorf("ps filter = %q, want the workdir label", filters[0])
+	}
+
+	// A read-only sandbox leaves the workspace free
+	readOnly = true
+	lock, err := lockWorkspace(&Config{Workdir: workdir}, "docker")
+	if err != nil {
+		t.Fatalf("lockWorkspace() next to a read-only sandbox = %v", err)
+	}
+	lock.release()
+}
+
+func TestBuildContainerArgsReadOnlyWorkspace(t *testing.T) {
+	workdir := t.TempDir()
+	cfg := &Config{Workdir: workdir, ReadOnlyWorkspace: true}
+	argsStr := joinArgs(buildContainerArgs(cfg, "docker", "test-image", nil))
+	if !contains(argsStr, "-v "+workdir+":/workspace:ro ") {
+		t.Errorf("buildContainerArgs() missing read-only workspace mount: %s", argsStr)
+	}
+	if !contains(argsStr, "--label "+labelReadOnly+"=true") {
+		t.Errorf("buildContainerArgs() missing %s label: %s", labelReadOnly, argsStr)
+	}
+
+	cfg.ReadOnlyWorkspace = false
+	if argsStr := joinArgs(buildContainerArgs(cfg, "docker", "test-image", nil)); contains(argsStr, ":/workspace:ro") || contains(argsStr, labelReadOnly) {
+		t.Errorf("buildContainerArgs() mounted the workspace read-only by default: %s", argsStr)
+	}
+}
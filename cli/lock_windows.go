@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// tryLockFile always succeeds on Windows. Workspaces are still locked by the
+// workdir label of running containers, which cc-sandbox checks on launch.
+func tryLockFile(_ *os.File) bool {
+	return true
+}
+
+// unlockFile is a no-op on Windows.
+func unlockFile(_ *os.File) {}
@@ -2,15 +2,19 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -25,6 +29,9 @@ var (
 
 const oauthTokenPath = "/mnt/claude-data/.oauth-token"
 
+// oauthTokenPrefix starts every Claude OAuth token printed by `claude setup-token`.
+const oauthTokenPrefix = "sk-ant-oat01-"
+
 const envVarHelpText = `
 Environment Variables:
   CC_SANDBOX_DEFAULT_IMAGE      Default image tag (default: base)
@@ -38,28 +45,71 @@ Environment Variables:
   CC_SANDBOX_DEBUG              Enable debug output (set to 1 to enable)
   CC_SANDBOX_CLAUDE_CONFIG      Claude config directory path (e.g., ~/.claude)
   CC_SANDBOX_CLAUDE_CONFIG_REPO Git repository URL for Claude config
+  CC_SANDBOX_ACCOUNT            Claude account whose credentials to use (default: default)
+  CC_SANDBOX_PROVIDER           Auth provider: oauth, api-key, bedrock, or vertex (default: stored by auth)
+  CC_SANDBOX_NETWORK_POLICY     Network access: open, none, or allowlist (default: open)
+  CC_SANDBOX_PROFILE            Profile to apply from the user config file
+  CC_SANDBOX_CONFIG_FILE        User config file path (default: ~/.config/cc-sandbox/config.yaml)
+
+Config Files:
+  ~/.config/cc-sandbox/config.yaml  User defaults and named profiles (--profile)
+  .cc-sandbox.yaml / .cc-sandbox.toml in the workdir or any parent directory.
+  Precedence: flags, env vars, profile, project file, user defaults, built-in defaults.
 `
 
 type Config struct {
-	Image            string
-	Registry         string
-	DockerSocket     string
-	Workdir          string
-	Mounts           []string
-	EnvVars          []string
-	MountDocker      bool
-	MountGit         bool
-	MountGH          bool
-	MountSSH         bool
-	Interactive      bool
-	Root             *bool  // nil = auto-detect, true = run as root, false = run as claude
-	Runtime          string // "auto", "docker", "podman"
-	GitUserName      string // Override git user.name
-	GitUserEmail     string // Override git user.email
-	HostNetwork      bool   // Use host network mode for DinD localhost access
-	ClaudeConfigPath string // Host path to mount (e.g., ~/.claude)
-	ClaudeConfigRepo string // Git repo URL for config
-	ClaudeConfigSync bool   // Pull latest changes from repo
+	Image             string
+	Registry          string
+	DockerSocket      string
+	Workdir           string
+	Mounts            []string
+	EnvVars           []string
+	DockerAllow       []string
+	NetworkAllow      []string
+	MountDocker       bool
+	MountGit          bool
+	MountGH           bool
+	MountSSH          bool
+	Interactive       bool
+	Root              *bool  // nil = auto-detect, true = run as root, false = run as claude
+	Runtime           string // "auto", "docker", "podman"
+	GitUserName       string // Override git user.name
+	GitUserEmail      string // Override git user.email
+	HostNetwork       bool   // Use host network mode for DinD localhost access
+	NetworkPolicy     string // "open", "none" or "allowlist" (see network.go)
+	Memory            string // Memory limit, e.g. "4g" (see limits.go)
+	CPUs              string // CPU limit, e.g. "2"
+	PidsLimit         string // Process limit, e.g. "512"
+	Disk              string // Size limit of the container's writable layer, e.g. "20g"
+	Timeout           string // Session timeout, e.g. "30m"
+	Hardened          bool   // Drop capabilities, read-only root filesystem (see hardened.go)
+	ClaudeConfigPath  string // Host path to mount (e.g., ~/.claude)
+	ClaudeConfigRepo  string // Git repo URL for config
+	ClaudeConfigSync  bool   // Pull latest changes from repo
+	Account           string // Claude account; each account has its own credentials volume
+	Provider          string // Auth provider override; empty uses the one stored by auth
+	Profile           string // Named profile from the user config file
+	SecretsDir        string // Host directory of secret env files, mounted read-only
+	Timings           bool   // Print per-phase launch durations
+	Name              string // Persistent sandbox name; empty runs a --rm container
+	CIDFile           string // File the runtime writes the container ID to
+	ReadOnlyWorkspace bool   // Mount the workdir read-only; takes no workspace lock
+	Force             bool   // Launch even if another sandbox holds the workspace lock
+	Worktree          string // Branch whose managed git worktree is mounted instead of the workdir
+	Isolated          bool   // Work on a copy of the workdir in a volume (see isolated.go)
+	Session           string // ID of the isolated session, set at launch
+	Repo              string // Repository URL cloned into a volume instead of mounting the workdir
+	RepoBranch        string // Branch to clone for Repo; empty uses the remote's default
+	PushBranch        string // Branch to push the clone's HEAD to when the session ends
+	DiscardClone      bool   // Remove the clone even when the session or push failed
+	RepoVolume        string // Volume holding the clone, set at launch
+	DockerProxy       bool   // Serve the Docker socket through the filtering proxy (see dockerproxy.go)
+	DockerProxyDir    string // Host directory of the proxy socket, set at launch
+	NetworkProxyDir   string // Host directory of the allowlist proxy socket, set at launch
+	NetworkLog        string // Log of the allowlist proxy's decisions, set at launch
+	SeccompProfile    string // Host path of the hardened seccomp profile, set at launch
+
+	sources map[string][]valueSource // Where each setting came from (see resolveConfig)
 }
 
 // flagsWithValues contains flags that require a separate value argument.
@@ -73,6 +123,21 @@ var flagsWithValues = map[string]bool{
 	"--git-user-name": true, "--git-user-email": true,
 	"-C": true, "--claude-config": true,
 	"--claude-config-repo": true,
+	"--profile":            true,
+	"--account":            true,
+	"--provider":           true,
+	"--worktree":           true,
+	"--repo":               true,
+	"--branch":             true,
+	"--push-branch":        true,
+	"--docker-allow":       true,
+	"--network-policy":     true,
+	"--network-allow":      true,
+	"--memory":             true,
+	"--cpus":               true,
+	"--pids-limit":         true,
+	"--disk":               true,
+	"--timeout":            true,
 }
 
 func main() {
@@ -81,7 +146,12 @@ func main() {
 	// Workaround for Cobra treating first positional arg as subcommand.
 	// Find the first positional argument and insert "--" before it if needed.
 	args := os.Args[1:]
-	knownCommands := map[string]bool{"version": true, "help": true, "update": true, "completion": true, "auth": true}
+	knownCommands := map[string]bool{
+		"version": true, "help": true, "update": true, "completion": true, "auth": true, "config": true,
+		"start": true, "attach": true, "stop": true, "rm": true, "ps": true,
+		"shell": true, "exec": true, "worktrees": true,
+		"diff": true, "apply": true, "discard": true, "batch": true, "task": true, "docker-proxy": true, "network-proxy": true,
+	}
 
 	// Find the index of the first positional argument (not a flag)
 	firstPosIdx := -1
@@ -116,7 +186,12 @@ func main() {
 	}
 
 	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+		// A container's exit status is passed through as is, without a message
+		var exitErr *exitCodeError
+		if !errors.As(err, &exitErr) {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(exitCodeOf(err))
 	}
 }
 
@@ -139,31 +214,16 @@ Examples:
 		Version:               fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, date),
 		DisableFlagsInUseLine: true,
 		SilenceUsage:          true,
-		RunE: func(_ *cobra.Command, args []string) error {
+		SilenceErrors:         true, // Printed by main, which also sets the exit code
+		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg.Root = parseRootFlag(rootFlag)
-			return runSandbox(cfg, args)
+			return runSandbox(cfg, args, cmd.Flags().Changed)
 		},
 	}
 
 	rootCmd.SetHelpTemplate(rootCmd.HelpTemplate() + envVarHelpText)
 
-	rootCmd.Flags().StringVarP(&cfg.Image, "image", "i", "", "Docker image tag (default: base)")
-	rootCmd.Flags().StringArrayVarP(&cfg.Mounts, "mount", "m", nil, "Additional volume mounts (host:container)")
-	rootCmd.Flags().StringArrayVarP(&cfg.EnvVars, "env", "e", nil, "Environment variables (KEY=value)")
-	rootCmd.Flags().StringVarP(&cfg.Workdir, "workdir", "w", "", "Working directory (default: current directory)")
-	rootCmd.Flags().BoolVar(&cfg.MountDocker, "docker", false, "Mount Docker socket")
-	rootCmd.Flags().BoolVar(&cfg.MountGit, "git", true, "Mount .gitconfig from host")
-	rootCmd.Flags().BoolVar(&cfg.MountGH, "gh", true, "Mount GitHub CLI config from host")
-	rootCmd.Flags().BoolVar(&cfg.MountSSH, "ssh", false, "Mount SSH keys from host")
-	rootCmd.Flags().BoolVarP(&cfg.Interactive, "interactive", "t", true, "Run in interactive mode with TTY")
-	rootCmd.Flags().StringVar(&rootFlag, "root", "auto", "Run as root user: auto, true, or false")
-	rootCmd.Flags().StringVar(&cfg.Runtime, "runtime", "auto", "Container runtime: auto, docker, or podman")
-	rootCmd.Flags().StringVar(&cfg.GitUserName, "git-user-name", "", "Override git user.name in container")
-	rootCmd.Flags().StringVar(&cfg.GitUserEmail, "git-user-email", "", "Override git user.email in container")
-	rootCmd.Flags().BoolVar(&cfg.HostNetwork, "host-network", false, "Use host network mode (enables localhost access for DinD port mappings)")
-	rootCmd.Flags().StringVarP(&cfg.ClaudeConfigPath, "claude-config", "C", "", "Mount Claude config directory from host")
-	rootCmd.Flags().StringVar(&cfg.ClaudeConfigRepo, "claude-config-repo", "", "Git repository URL for Claude config")
-	rootCmd.Flags().BoolVar(&cfg.ClaudeConfigSync, "claude-config-sync", false, "Pull latest changes from config repo")
+	addSandboxFlags(rootCmd, cfg, &rootFlag)
 
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
@@ -178,68 +238,271 @@ Examples:
 
 	rootCmd.AddCommand(newUpdateCmd())
 	rootCmd.AddCommand(newAuthCmd())
+	rootCmd.AddCommand(newConfigCmd())
+	rootCmd.AddCommand(newStartCmd())
+	rootCmd.AddCommand(newAttachCmd())
+	rootCmd.AddCommand(newStopCmd())
+	rootCmd.AddCommand(newRmCmd())
+	rootCmd.AddCommand(newPsCmd())
+	rootCmd.AddCommand(newShellCmd())
+	rootCmd.AddCommand(newExecCmd())
+	rootCmd.AddCommand(newWorktreesCmd())
+	rootCmd.AddCommand(newDiffCmd())
+	rootCmd.AddCommand(newApplyCmd())
+	rootCmd.AddCommand(newDiscardCmd())
+	rootCmd.AddCommand(newBatchCmd())
+	rootCmd.AddCommand(newTaskCmd())
+	rootCmd.AddCommand(newDockerProxyCmd())
+	rootCmd.AddCommand(newNetworkProxyCmd())
 
 	return rootCmd
 }
 
-func runSandbox(cfg *Config, args []string) error {
-	cfg.Registry = getEnv("CC_SANDBOX_REGISTRY", DefaultRegistry)
-	cfg.DockerSocket = getEnv("CC_SANDBOX_DOCKER_SOCKET", getDefaultDockerSocket())
+// addSandboxFlags registers the flags that configure a sandbox container.
+// Shared by the root command and subcommands that resolve the same Config.
+func addSandboxFlags(cmd *cobra.Command, cfg *Config, rootFlag *string) {
+	cmd.Flags().StringVarP(&cfg.Image, "image", "i", "", "Docker image tag (default: base)")
+	cmd.Flags().StringArrayVarP(&cfg.Mounts, "mount", "m", nil, "Additional volume mounts (host:container)")
+	cmd.Flags().StringArrayVarP(&cfg.EnvVars, "env", "e", nil, "Environment variables (KEY=value)")
+	cmd.Flags().StringVarP(&cfg.Workdir, "workdir", "w", "", "Working directory (default: current directory)")
+	cmd.Flags().BoolVar(&cfg.MountDocker, "docker", false, "Mount Docker socket")
+	cmd.Flags().BoolVar(&cfg.DockerProxy, "docker-proxy", true, "Filter the Docker socket through cc-sandbox's policy proxy")
+	cmd.Flags().StringArrayVar(&cfg.DockerAllow, "docker-allow", nil, "Let the Docker socket proxy allow privileged, host-namespaces, devices, host-mounts, or a host path")
+	cmd.Flags().BoolVar(&cfg.MountGit, "git", true, "Mount .gitconfig from host")
+	cmd.Flags().BoolVar(&cfg.MountGH, "gh", true, "Mount GitHub CLI config from host")
+	cmd.Flags().BoolVar(&cfg.MountSSH, "ssh", false, "Mount SSH keys from host")
+	cmd.Flags().BoolVarP(&cfg.Interactive, "interactive", "t", true, "Run in interactive mode with TTY")
+	cmd.Flags().StringVar(rootFlag, "root", "auto", "Run as root user: auto, true, or false")
+	cmd.Flags().StringVar(&cfg.Runtime, "runtime", "auto", "Container runtime: auto, docker, or podman")
+	cmd.Flags().StringVar(&cfg.GitUserName, "git-user-name", "", "Override git user.name in container")
+	cmd.Flags().StringVar(&cfg.GitUserEmail, "git-user-email", "", "Override git user.email in container")
+	cmd.Flags().BoolVar(&cfg.HostNetwork, "host-network", false, "Use host network mode (enables localhost access for DinD port mappings)")
+	cmd.Flags().StringVar(&cfg.NetworkPolicy, "network-policy", networkPolicyOpen, "Network access: open, none, or allowlist (HTTP(S) to allowed hosts only)")
+	cmd.Flags().StringArrayVar(&cfg.NetworkAllow, "network-allow", nil, "Host the allowlist policy may reach, e.g. pypi.org or *.example.com")
+	cmd.Flags().StringVar(&cfg.Memory, "memory", "", "Memory limit, e.g. 4g (default: none)")
+	cmd.Flags().StringVar(&cfg.CPUs, "cpus", "", "CPU limit, e.g. 2 or 1.5 (default: none)")
+	cmd.Flags().StringVar(&cfg.PidsLimit, "pids-limit", "", "Maximum number of processes (default: none)")
+	cmd.Flags().StringVar(&cfg.Disk, "disk", "", "Size limit of the container's writable layer, e.g. 20g (default: none)")
+	cmd.Flags().StringVar(&cfg.Timeout, "timeout", "", "Stop the session after this long, e.g. 30m; exits with status 124")
+	cmd.Flags().BoolVar(&cfg.Hardened, "hardened", false, "Drop all capabilities, forbid privilege gain, apply a seccomp profile and make the root filesystem read-only")
+	cmd.Flags().StringVarP(&cfg.ClaudeConfigPath, "claude-config", "C", "", "Mount Claude config directory from host")
+	cmd.Flags().StringVar(&cfg.ClaudeConfigRepo, "claude-config-repo", "", "Git repository URL for Claude config")
+	cmd.Flags().BoolVar(&cfg.ClaudeConfigSync, "claude-config-sync", false, "Pull latest changes from config repo")
+	cmd.Flags().StringVar(&cfg.Account, "account", "", "Claude account whose credentials to use (default: default)")
+	cmd.Flags().StringVar(&cfg.Provider, "provider", "", "Auth provider for this run: oauth, api-key, bedrock, or vertex (default: stored by auth)")
+	cmd.Flags().StringVar(&cfg.Profile, "profile", "", "Named profile from the user config file")
+	cmd.Flags().BoolVar(&cfg.Timings, "timings", false, "Print how long each launch phase took")
+	cmd.Flags().BoolVar(&cfg.ReadOnlyWorkspace, "read-only-workspace", false, "Mount the working directory read-only (allowed while another sandbox uses it)")
+	cmd.Flags().StringVar(&cfg.Worktree, "worktree", "", "Run in a managed git worktree of this branch, created from HEAD if needed")
+	cmd.Flags().StringVar(&cfg.Repo, "repo", "", "Clone this repository into a volume instead of mounting the working directory")
+	cmd.Flags().StringVar(&cfg.RepoBranch, "branch", "", "Branch to clone with --repo (default: the remote's default branch)")
+	cmd.Flags().StringVar(&cfg.PushBranch, "push-branch", "", "With --repo, push the result to this branch when the session ends")
+	cmd.Flags().BoolVar(&cfg.DiscardClone, "discard-clone", false, "With --repo, remove the clone even when the session or push fails")
+	cmd.Flags().BoolVar(&cfg.Isolated, "isolated", false, "Work on a copy of the working directory; review and apply it with diff and apply")
+	cmd.Flags().BoolVar(&cfg.Force, "force", false, "Launch even if another sandbox is using the working directory")
+}
 
-	// Environment variable overrides CLI flag for root mode
-	if envRoot := os.Getenv("CC_SANDBOX_ROOT"); envRoot != "" {
-		cfg.Root = parseRootFlag(envRoot)
+// prepareConfig fills in the workdir and merges every configuration source into cfg.
+func prepareConfig(cfg *Config, flagChanged func(string) bool) error {
+	if cfg.Workdir == "" {
+		var err error
+		cfg.Workdir, err = os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+	} else {
+		// The workdir is bind-mounted and labeled, so it must be absolute
+		workdir, err := filepath.Abs(expandPath(cfg.Workdir))
+		if err != nil {
+			return fmt.Errorf("failed to resolve workdir %s: %w", cfg.Workdir, err)
+		}
+		cfg.Workdir = workdir
 	}
 
-	// Environment variable overrides CLI flag for runtime
-	if envRuntime := os.Getenv("CC_SANDBOX_RUNTIME"); envRuntime != "" {
-		cfg.Runtime = envRuntime
+	// Merge config files and environment variables (flags take precedence)
+	if err := resolveConfig(cfg, flagChanged); err != nil {
+		return err
 	}
 
-	if cfg.Image == "" {
-		cfg.Image = getEnv("CC_SANDBOX_DEFAULT_IMAGE", "base")
+	if err := validateAccountName(cfg.Account); err != nil {
+		return err
 	}
-
-	// Environment variable overrides for Claude config
-	if cfg.ClaudeConfigPath == "" {
-		cfg.ClaudeConfigPath = os.Getenv("CC_SANDBOX_CLAUDE_CONFIG")
+	if err := validateProvider(cfg.Provider); err != nil {
+		return err
+	}
+	if err := validateWorkspaceOptions(cfg); err != nil {
+		return err
+	}
+	if err := validateDockerAllow(cfg.DockerAllow); err != nil {
+		return err
+	}
+	if err := validateNetworkPolicy(cfg); err != nil {
+		return err
 	}
-	if cfg.ClaudeConfigRepo == "" {
-		cfg.ClaudeConfigRepo = os.Getenv("CC_SANDBOX_CLAUDE_CONFIG_REPO")
+	if err := validateResourceLimits(cfg); err != nil {
+		return err
 	}
 
 	// Auto-enable Docker socket for docker and bun-full images
 	applyDockerAutoMount(cfg)
 
-	if cfg.Workdir == "" {
-		var err error
-		cfg.Workdir, err = os.Getwd()
+	return applyDockerProxySupport(cfg)
+}
+
+func runSandbox(cfg *Config, args []string, flagChanged func(string) bool) error {
+	timer := newPhaseTimer(cfg.Timings)
+	defer timer.report(os.Stderr)
+
+	runtime, imageName, err := prepareLaunch(cfg, flagChanged, timer)
+	if err != nil {
+		return err
+	}
+
+	// Only one read-write sandbox may edit a workspace at a time
+	lock, err := lockWorkspace(cfg, runtime)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	timer.mark("lock")
+
+	// Sibling containers are created through a filtering proxy, so the
+	// socket can't be used to escape the sandbox
+	proxy, err := startDockerProxy(cfg)
+	if err != nil {
+		return err
+	}
+	defer proxy.close()
+	timer.mark("docker-proxy")
+
+	// In allowlist mode the sandbox's only way out is the network proxy
+	netProxy, err := startNetworkProxy(cfg)
+	if err != nil {
+		return err
+	}
+	defer netProxy.close()
+	timer.mark("network-proxy")
+
+	// Secrets go through a read-only file mount so they never show up in
+	// process arguments or `docker inspect`
+	if secrets := collectSecretEnv(cfg); len(secrets) > 0 {
+		dir, cleanup, err := writeSecretsDir(secrets)
 		if err != nil {
-			return fmt.Errorf("failed to get current directory: %w", err)
+			return err
 		}
+		defer cleanup()
+		cfg.SecretsDir = dir
+	}
+	timer.mark("secrets")
+
+	// The runtime records the container ID, so an interrupted run can remove
+	// a container that ignores the forwarded signal
+	cidDir, err := os.MkdirTemp("", "cc-sandbox-cid-")
+	if err != nil {
+		return fmt.Errorf("failed to create container ID directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(cidDir) }()
+	cfg.CIDFile = filepath.Join(cidDir, "cid")
+
+	containerArgs := buildContainerArgs(cfg, runtime, imageName, args)
+	timer.mark("args")
+
+	containerCmd := exec.Command(runtime, containerArgs...)
+	containerCmd.Stdin = os.Stdin
+	containerCmd.Stdout = os.Stdout
+	containerCmd.Stderr = os.Stderr
+	if !useTTY(cfg) {
+		detachFromTerminalSignals(containerCmd)
+	}
+
+	if err := containerCmd.Start(); err != nil {
+		return err
+	}
+	timer.mark("start")
+
+	stopForwarding := forwardSignals(containerCmd.Process, func() {
+		removeContainerFromCIDFile(runtime, cfg.CIDFile)
+		_ = containerCmd.Process.Kill()
+	})
+	timeout := startSessionTimeout(cfg, runtime, os.Stderr)
+	err = containerCmd.Wait()
+	timedOut := timeout.stop()
+	stopForwarding()
+	timer.mark("run")
+	netProxy.report(os.Stderr)
+	if cfg.Session != "" {
+		printIsolatedHint(os.Stderr, cfg.Session)
+	}
+	if cfg.RepoVolume != "" {
+		err = finishRepoSession(cfg, runtime, imageName, err, os.Stderr)
+	}
+	if timedOut {
+		return &exitCodeError{code: timeoutExitCode}
+	}
+	return commandExitError(err)
+}
+
+// prepareLaunch resolves the configuration, runtime and image for a sandbox
+// and pulls the image if it is not available locally.
+// Returns the container runtime and the image name.
+func prepareLaunch(cfg *Config, flagChanged func(string) bool, timer *phaseTimer) (string, string, error) {
+	if err := prepareConfig(cfg, flagChanged); err != nil {
+		return "", "", err
+	}
+	timer.mark("config")
+
+	// Each branch gets its own checkout, so parallel sandboxes on one repo
+	// don't share a working tree
+	if cfg.Worktree != "" {
+		path, err := ensureWorktree(cfg.Workdir, cfg.Worktree)
+		if err != nil {
+			return "", "", err
+		}
+		cfg.Workdir = path
+		timer.mark("worktree")
 	}
 
 	// Detect runtime
 	runtime := detectRuntime(cfg)
+	timer.mark("runtime")
+
+	if cfg.Hardened {
+		path, err := writeSeccompProfile()
+		if err != nil {
+			return "", "", err
+		}
+		cfg.SeccompProfile = path
+	}
 
 	imageName := resolveImageName(cfg.Registry, cfg.Image, runtime)
 
+	// Image, credentials volume, git identity and root mode checks are
+	// independent, so they run concurrently
+	imageExists := prefetchLaunchProbes(cfg, runtime, imageName)
+	timer.mark("probes")
+
 	// Pull image if it's from a registry and not available locally
-	if isRegistryImage(imageName) && !imageExistsLocally(imageName, runtime) {
+	if !imageExists {
 		fmt.Fprintf(os.Stderr, "Pulling image %s...\n", imageName)
 		if err := pullImage(imageName, runtime); err != nil {
-			return fmt.Errorf("failed to pull image: %w", err)
+			return "", "", fmt.Errorf("failed to pull image: %w", err)
 		}
+		timer.mark("pull")
 	}
 
-	containerArgs := buildContainerArgs(cfg, runtime, imageName, args)
-
-	containerCmd := exec.Command(runtime, containerArgs...)
-	containerCmd.Stdin = os.Stdin
-	containerCmd.Stdout = os.Stdout
-	containerCmd.Stderr = os.Stderr
+	if cfg.Isolated {
+		if err := prepareIsolatedWorkspace(cfg, runtime, imageName); err != nil {
+			return "", "", err
+		}
+		timer.mark("copy")
+	}
+	if cfg.Repo != "" {
+		if err := createRepoVolume(cfg, runtime); err != nil {
+			return "", "", err
+		}
+	}
 
-	return containerCmd.Run()
+	return runtime, imageName, nil
 }
 
 func buildImageName(registry, image string) string {
@@ -260,53 +523,66 @@ func buildImageName(registry, image string) string {
 }
 
 func buildContainerArgs(cfg *Config, containerRuntime, imageName string, containerArgs []string) []string {
-	args := []string{"run", "--rm"}
-
-	if cfg.Interactive && isTerminal() {
-		args = append(args, "-it")
+	var args []string
+	if cfg.Name != "" {
+		// Persistent sandboxes run detached and keep a TTY open for attach
+		args = []string{"run", "-d", "-it", "--name", sandboxContainerName(cfg.Name)}
+	} else {
+		args = []string{"run", "--rm"}
+		if useTTY(cfg) {
+			args = append(args, "-it")
+		}
+	}
+	if cfg.CIDFile != "" {
+		args = append(args, "--cidfile", cfg.CIDFile)
 	}
+	args = append(args, containerLabelArgs(cfg, imageName, time.Now())...)
 
 	// Use host network mode if requested (enables localhost access for DinD port mappings)
 	if cfg.HostNetwork {
 		args = append(args, "--network=host")
 	}
+	args = append(args, networkPolicyArgs(cfg)...)
+	args = append(args, resourceLimitArgs(cfg)...)
+	args = append(args, hardenedArgs(cfg, containerRuntime, os.Getuid(), os.Getgid())...)
 
-	// Determine if we should run as root based on runtime and config
-	runAsRoot := shouldUseRootMode(cfg, containerRuntime)
+	args = append(args, containerUserArgs(cfg, containerRuntime, os.Getuid(), os.Getgid())...)
 
-	// Set container user and permission mode based on runtime and root mode
-	if containerRuntime == RuntimePodman {
-		// Podman: use --userns=keep-id for UID mapping
-		args = append(args, "--userns=keep-id")
-		args = append(args, "-u", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
-		args = append(args, "-e", "CC_SANDBOX_PERMISSION_MODE=skip")
-	} else if runAsRoot {
-		// Docker rootless: add --userns=host to run as root
-		args = append(args, "--userns=host")
-		args = append(args, "-u", "0:0")
-		// Root in container can't use --dangerously-skip-permissions
-		args = append(args, "-e", "CC_SANDBOX_PERMISSION_MODE=accept")
+	if cfg.RepoVolume != "" {
+		args = append(args, repoWorkspaceArgs(cfg)...)
+	} else if cfg.Isolated {
+		args = append(args, isolatedWorkspaceArgs(cfg)...)
 	} else {
-		// Regular Docker or OrbStack: use -u flag for proper fixuid support
-		args = append(args, "-u", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
-		args = append(args, "-e", "CC_SANDBOX_PERMISSION_MODE=skip")
+		workspaceMount := cfg.Workdir + ":/workspace"
+		if cfg.ReadOnlyWorkspace {
+			workspaceMount += ":ro"
+		}
+		args = append(args, "-v", workspaceMount)
 	}
-
-	args = append(args, "-v", cfg.Workdir+":/workspace")
 	args = append(args, "-w", "/workspace")
 
 	// Mount bare repository if running in a git worktree
-	if bareRepoPath := resolveGitWorktreePaths(cfg.Workdir); bareRepoPath != "" {
-		args = append(args, "-v", bareRepoPath+":"+bareRepoPath)
+	// (read-only for an isolated session, which must not change the host)
+	if bareRepoPath := resolveGitWorktreePaths(cfg.Workdir); bareRepoPath != "" && cfg.Repo == "" {
+		gitMount := bareRepoPath + ":" + bareRepoPath
+		if cfg.Isolated {
+			gitMount += ":ro"
+		}
+		args = append(args, "-v", gitMount)
 	}
 
 	// User-specific credentials volume
-	credentialsVolume := getCredentialsVolumeName()
+	credentialsVolume := credentialsVolumeFor(-1, cfg.Account)
 	args = append(args, "-v", credentialsVolume+":/mnt/claude-data")
 
-	// Check for stored OAuth token and pass it to container
-	if token, err := loadOAuthTokenFromVolume(containerRuntime, credentialsVolume); err == nil && token != "" {
-		args = append(args, "-e", "CLAUDE_CODE_OAUTH_TOKEN="+token)
+	// Stored credentials (OAuth token, API key, cloud provider files) are
+	// exported by the entrypoint straight from the credentials volume; only the
+	// provider name is passed here. Secrets from the host come in through SecretsDir
+	if cfg.Provider != "" {
+		args = append(args, "-e", "CC_SANDBOX_PROVIDER="+cfg.Provider)
+	}
+	if cfg.SecretsDir != "" {
+		args = append(args, "-v", cfg.SecretsDir+":"+containerSecretsDir+":ro")
 	}
 
 	homeDir, _ := os.UserHomeDir()
@@ -337,12 +613,7 @@ func buildContainerArgs(cfg *Config, containerRuntime, imageName string, contain
 		if dirExists(ghConfig) {
 			args = append(args, "-v", ghConfig+":/mnt/host-config/gh:ro")
 		}
-		if token := os.Getenv("GH_TOKEN"); token != "" {
-			args = append(args, "-e", "GH_TOKEN")
-		}
-		if token := os.Getenv("GITHUB_TOKEN"); token != "" {
-			args = append(args, "-e", "GITHUB_TOKEN")
-		}
+		// GH_TOKEN and GITHUB_TOKEN are delivered through SecretsDir
 	}
 
 	if cfg.MountSSH {
@@ -369,7 +640,17 @@ func buildContainerArgs(cfg *Config, containerRuntime, imageName string, contain
 		}
 	}
 
-	if cfg.MountDocker {
+	// Name Compose projects after the host workdir rather than /workspace
+	// (an -e COMPOSE_PROJECT_NAME below still wins)
+	if cfg.MountDocker && cfg.Repo == "" {
+		if name := composeProjectName(cfg.Workdir); name != "" {
+			args = append(args, "-e", "COMPOSE_PROJECT_NAME="+name)
+		}
+	}
+
+	if cfg.DockerProxyDir != "" {
+		args = append(args, dockerProxyArgs(cfg)...)
+	} else if cfg.MountDocker {
 		if fileExists(cfg.DockerSocket) {
 			args = append(args, "-v", cfg.DockerSocket+":/var/run/docker.sock")
 			// Add docker socket's group to allow access without sudo
@@ -394,6 +675,10 @@ func buildContainerArgs(cfg *Config, containerRuntime, imageName string, contain
 	}
 
 	for _, env := range cfg.EnvVars {
+		// Secret-looking values are delivered through SecretsDir instead
+		if isSecretEnvVar(env) {
+			continue
+		}
 		args = append(args, "-e", env)
 	}
 
@@ -406,6 +691,40 @@ func buildContainerArgs(cfg *Config, containerRuntime, imageName string, contain
 	return args
 }
 
+// containerUserArgs returns the user and permission mode flags for a container
+// that should act as uid:gid on the host.
+func containerUserArgs(cfg *Config, containerRuntime string, uid, gid int) []string {
+	// Determine if we should run as root based on runtime and config
+	runAsRoot := shouldUseRootMode(cfg, containerRuntime)
+	if cfg.Hardened && !runAsRoot {
+		return hardenedUserArgs(cfg, containerRuntime, uid, gid)
+	}
+
+	// Set container user and permission mode based on runtime and root mode
+	if containerRuntime == RuntimePodman {
+		// Podman: use --userns=keep-id for UID mapping
+		return []string{
+			"--userns=keep-id",
+			"-u", fmt.Sprintf("%d:%d", uid, gid),
+			"-e", "CC_SANDBOX_PERMISSION_MODE=skip",
+		}
+	}
+	if runAsRoot {
+		// Docker rootless: add --userns=host to run as root
+		// Root in container can't use --dangerously-skip-permissions
+		return []string{
+			"--userns=host",
+			"-u", "0:0",
+			"-e", "CC_SANDBOX_PERMISSION_MODE=accept",
+		}
+	}
+	// Regular Docker or OrbStack: use -u flag for proper fixuid support
+	return []string{
+		"-u", fmt.Sprintf("%d:%d", uid, gid),
+		"-e", "CC_SANDBOX_PERMISSION_MODE=skip",
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -426,7 +745,7 @@ func debugLog(format string, args ...interface{}) {
 func applyDockerAutoMount(cfg *Config) {
 	// Built-in images that auto-mount Docker
 	if cfg.Image == "docker" || cfg.Image == "bun-full" {
-		cfg.MountDocker = true
+		enableDockerAutoMount(cfg)
 		return
 	}
 
@@ -434,13 +753,20 @@ func applyDockerAutoMount(cfg *Config) {
 	if envImages := os.Getenv("CC_SANDBOX_DOCKER_IMAGES"); envImages != "" {
 		for _, img := range strings.Split(envImages, ",") {
 			if strings.TrimSpace(img) == cfg.Image {
-				cfg.MountDocker = true
+				enableDockerAutoMount(cfg)
 				return
 			}
 		}
 	}
 }
 
+func enableDockerAutoMount(cfg *Config) {
+	if !cfg.MountDocker {
+		cfg.MountDocker = true
+		cfg.setSource("docker", valueSource{Kind: SourceAuto, Origin: "image " + cfg.Image})
+	}
+}
+
 // parseRootFlag parses a root flag string value.
 // Returns nil for "auto", true for "true/yes/1", false for "false/no/0".
 func parseRootFlag(flag string) *bool {
@@ -486,23 +812,50 @@ func shouldUseRootMode(cfg *Config, runtime string) bool {
 	return isRootlessDocker()
 }
 
+// currentCredentialsOwner returns the part of the credentials volume name that
+// identifies the current user, or an empty string if it cannot be determined.
+func currentCredentialsOwner() string {
+	// Unix (Linux/macOS): use UID for uniqueness
+	if uid := os.Getuid(); uid >= 0 {
+		return strconv.Itoa(uid)
+	}
+	// Windows: use username (os.Getuid() returns -1)
+	// Sanitize username for Docker volume name (alphanumeric, dash, underscore)
+	if u, err := user.Current(); err == nil {
+		return sanitizeVolumeName(u.Username)
+	}
+	return ""
+}
+
+// Cached launch probe results (see prefetchLaunchProbes)
+var (
+	credentialsVolumeOnce  sync.Once
+	credentialsVolumeCache string
+
+	gitUserConfigOnce sync.Once
+	gitUserNameCache  string
+	gitUserEmailCache string
+)
+
 // getCredentialsVolumeName returns a user-specific volume name.
 // It also handles migration from the old shared volume name.
+// Results are cached for the lifetime of the process.
 func getCredentialsVolumeName() string {
-	var newVolume string
+	credentialsVolumeOnce.Do(func() {
+		credentialsVolumeCache = lookupCredentialsVolumeName()
+	})
+	return credentialsVolumeCache
+}
 
-	// Unix (Linux/macOS): use UID for uniqueness
-	if uid := os.Getuid(); uid >= 0 {
-		newVolume = "cc-sandbox-credentials-" + strconv.Itoa(uid)
-	} else if u, err := user.Current(); err == nil {
-		// Windows: use username (os.Getuid() returns -1)
-		// Sanitize username for Docker volume name (alphanumeric, dash, underscore)
-		name := sanitizeVolumeName(u.Username)
-		newVolume = "cc-sandbox-credentials-" + name
-	} else {
+// lookupCredentialsVolumeName finds the current user's credentials volume,
+// migrating the legacy shared volume if needed.
+func lookupCredentialsVolumeName() string {
+	owner := currentCredentialsOwner()
+	if owner == "" {
 		// Fallback (shouldn't happen)
 		return "cc-sandbox-credentials"
 	}
+	newVolume := "cc-sandbox-credentials-" + owner
 
 	// Optimization: Check new volume FIRST (most common case - already migrated)
 	// This avoids the old volume check in the common case
@@ -667,7 +1020,16 @@ func resolveGitWorktreePaths(workdir string) string {
 }
 
 // getGitUserConfigBatched retrieves user.name and user.email in a single subprocess call.
+// Results are cached for the lifetime of the process.
 func getGitUserConfigBatched() (name, email string) {
+	gitUserConfigOnce.Do(func() {
+		gitUserNameCache, gitUserEmailCache = readGitUserConfig()
+	})
+	return gitUserNameCache, gitUserEmailCache
+}
+
+// readGitUserConfig reads user.name and user.email from the global git config.
+func readGitUserConfig() (name, email string) {
 	cmd := exec.Command("git", "config", "--global", "--get-regexp", "^user\\.(name|email)$")
 	output, err := cmd.Output()
 	if err != nil {
@@ -708,6 +1070,11 @@ func resolveGitUserConfig(cfg *Config) (string, string) {
 	return userName, userEmail
 }
 
+// useTTY reports whether a run attaches the terminal to the container.
+func useTTY(cfg *Config) bool {
+	return cfg.Interactive && isTerminal()
+}
+
 func isTerminal() bool {
 	fileInfo, _ := os.Stdout.Stat()
 	return (fileInfo.Mode() & os.ModeCharDevice) != 0
@@ -765,7 +1132,10 @@ func pullImage(imageName, runtime string) error {
 
 // newAuthCmd creates the auth subcommand for authenticating Claude credentials.
 func newAuthCmd() *cobra.Command {
-	var targetUID int
+	var target authTarget
+	var tokenStdin bool
+	var provider string
+	var providerOpts providerOptions
 
 	authCmd := &cobra.Command{
 		Use:   "auth",
@@ -774,45 +1144,60 @@ func newAuthCmd() *cobra.Command {
 
 Examples:
   cc-sandbox auth              # Authenticate current user's credentials
-  cc-sandbox auth --uid 10000  # Authenticate for specific UID (e.g., cc-web's UID)`,
-		RunE: func(_ *cobra.Command, _ []string) error {
-			return runAuth(targetUID)
+  cc-sandbox auth --uid 10000  # Authenticate for specific UID (e.g., cc-web's UID)
+  echo "$TOKEN" | cc-sandbox auth --token-stdin  # Store an existing token
+  cc-sandbox auth import       # Copy host Claude credentials into the volume
+  cc-sandbox auth --account work  # Authenticate a separate Claude account
+  cc-sandbox auth --provider api-key   # Store an Anthropic API key
+  cc-sandbox auth --provider bedrock --region us-east-1
+  cc-sandbox auth --provider vertex --vertex-project my-project
+  cc-sandbox auth status       # Show stored credentials
+  cc-sandbox auth logout       # Wipe stored credentials
+  cc-sandbox auth list         # List credentials volumes for all UIDs`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := resolveAuthTarget(cmd, &target); err != nil {
+				return err
+			}
+			if err := validateProvider(provider); err != nil {
+				return err
+			}
+			if provider != "" && provider != ProviderOAuth {
+				return runAuthProvider(target, provider, providerOpts, os.Stdin, tokenStdin)
+			}
+			if tokenStdin {
+				return runAuthTokenStdin(target, os.Stdin)
+			}
+			return runAuth(target)
 		},
 	}
 
-	authCmd.Flags().IntVar(&targetUID, "uid", -1, "Target UID for credentials volume (default: current user)")
+	authCmd.Flags().BoolVar(&tokenStdin, "token-stdin", false, "Read an OAuth token (or API key) from stdin instead of running setup-token")
+	authCmd.Flags().StringVar(&provider, "provider", "", "Auth provider: oauth, api-key, bedrock, or vertex (default: oauth)")
+	authCmd.Flags().StringVar(&providerOpts.Region, "region", "", "AWS region for bedrock or Vertex AI region for vertex")
+	authCmd.Flags().StringVar(&providerOpts.AWSProfile, "aws-profile", "", "AWS profile for bedrock (default: $AWS_PROFILE)")
+	authCmd.Flags().StringVar(&providerOpts.VertexProject, "vertex-project", "", "Google Cloud project for vertex")
+	authCmd.PersistentFlags().IntVar(&target.UID, "uid", -1, "Target UID for credentials volume (default: current user)")
+	authCmd.PersistentFlags().StringVar(&target.Account, "account", "", "Claude account to authenticate (default: configured account or default)")
+
+	authCmd.AddCommand(newAuthStatusCmd(&target))
+	authCmd.AddCommand(newAuthLogoutCmd(&target))
+	authCmd.AddCommand(newAuthListCmd())
+	authCmd.AddCommand(newAuthImportCmd(&target))
 
 	return authCmd
 }
 
 // runAuth runs the claude setup-token command in a container with the target credentials volume.
-func runAuth(targetUID int) error {
-	// Determine target UID
-	uid := targetUID
-	if uid < 0 {
-		uid = os.Getuid()
-	}
-
-	// Get registry from environment
-	registry := getEnv("CC_SANDBOX_REGISTRY", DefaultRegistry)
-
-	// Detect runtime
-	cfg := &Config{Runtime: "auto"}
-	containerRuntime := detectRuntime(cfg)
-
-	// Build image name - use bun-full for auth since it has Claude CLI
-	imageName := resolveImageName(registry, "bun-full", containerRuntime)
+func runAuth(target authTarget) error {
+	uid := target.uid()
 
-	// Pull image if needed
-	if isRegistryImage(imageName) && !imageExistsLocally(imageName, containerRuntime) {
-		fmt.Fprintf(os.Stderr, "Pulling image %s...\n", imageName)
-		if err := pullImage(imageName, containerRuntime); err != nil {
-			return fmt.Errorf("failed to pull image: %w", err)
-		}
+	// Use bun-full for auth since it has Claude CLI
+	containerRuntime, imageName, err := prepareAuthImage("bun-full")
+	if err != nil {
+		return err
 	}
 
-	// Build credentials volume name
-	volumeName := fmt.Sprintf("cc-sandbox-credentials-%d", uid)
+	volumeName := target.volume()
 
 	// Ensure volume exists
 	createCmd := exec.Command(containerRuntime, "volume", "create", volumeName)
@@ -846,13 +1231,17 @@ func runAuth(targetUID int) error {
 	// Extract and store OAuth token if present in output
 	if token := extractOAuthToken(outputBuffer.String()); token != "" {
 		debugLog("Found OAuth token in output, storing to volume")
-		if err := storeOAuthToken(containerRuntime, volumeName, imageName, token); err != nil {
+		if err := storeOAuthToken(containerRuntime, volumeName, imageName, token, uid); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to store OAuth token: %v\n", err)
 		} else {
 			fmt.Printf("OAuth token stored successfully.\n")
 		}
 	}
 
+	if err := selectOAuthProvider(containerRuntime, volumeName, imageName, uid); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to select OAuth provider: %v\n", err)
+	}
+
 	fmt.Printf("\nAuthentication complete! Credentials stored in volume: %s\n", volumeName)
 	return nil
 }
@@ -889,8 +1278,7 @@ func extractOAuthToken(output string) string {
 	output = stripANSI(output)
 
 	// Find where the token starts
-	const prefix = "sk-ant-oat01-"
-	startIdx := strings.Index(output, prefix)
+	startIdx := strings.Index(output, oauthTokenPrefix)
 	if startIdx == -1 {
 		return ""
 	}
@@ -919,26 +1307,63 @@ func extractOAuthToken(output string) string {
 	return token.String()
 }
 
-// storeOAuthToken stores the OAuth token in the credentials volume.
-func storeOAuthToken(containerRuntime, volumeName, imageName, token string) error {
-	// Use printf to avoid trailing newline
-	cmd := exec.Command(containerRuntime, "run", "--rm",
-		"-v", volumeName+":/mnt/claude-data",
-		imageName,
-		"sh", "-c", fmt.Sprintf("printf '%%s' '%s' > %s", token, oauthTokenPath))
+// oauthTokenPattern is the shape of a Claude OAuth token from `claude setup-token`.
+var oauthTokenPattern = regexp.MustCompile(`^` + oauthTokenPrefix + `[A-Za-z0-9_-]{20,500}$`)
+
+// validateOAuthToken checks that token looks like a Claude OAuth token.
+// The token itself is never included in the error.
+func validateOAuthToken(token string) error {
+	if !strings.HasPrefix(token, oauthTokenPrefix) {
+		return errors.New("invalid OAuth token: expected sk-ant-oat01- prefix")
+	}
+	if !oauthTokenPattern.MatchString(token) {
+		return errors.New("invalid OAuth token: unexpected length or characters")
+	}
+	return nil
+}
+
+// atomicWriteScript writes stdin to the path in $1 with 0600 permissions,
+// via a temp file in the same directory and a rename.
+// It takes the data on stdin, so nothing secret is ever parsed by the shell.
+const atomicWriteScript = `umask 077
+mkdir -p "${1%/*}" || exit 1
+tmp=$(mktemp "$1.XXXXXX") || exit 1
+if cat > "$tmp" && chmod 600 "$tmp" && mv -f "$tmp" "$1"; then exit 0; fi
+rm -f "$tmp"
+exit 1`
+
+// runContainerWithInput runs a container command with input on stdin.
+// This is a variable to allow mocking in tests.
+var runContainerWithInput = func(containerRuntime string, args []string, input io.Reader) error {
+	cmd := exec.Command(containerRuntime, args...)
+	cmd.Stdin = input
+	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
-// loadOAuthTokenFromVolume loads the OAuth token from the credentials volume using a minimal alpine image.
-// This is used during container args building when we don't have the full image name.
-func loadOAuthTokenFromVolume(containerRuntime, volumeName string) (string, error) {
-	cmd := exec.Command(containerRuntime, "run", "--rm",
-		"-v", volumeName+":/mnt/claude-data",
-		"alpine:latest",
-		"cat", oauthTokenPath)
-	output, err := cmd.Output()
-	if err != nil {
-		return "", err
+// storeOAuthToken validates the OAuth token and stores it in the credentials volume.
+func storeOAuthToken(containerRuntime, volumeName, imageName, token string, uid int) error {
+	if err := validateOAuthToken(token); err != nil {
+		return err
+	}
+	return storeVolumeFile(containerRuntime, volumeName, imageName, oauthTokenPath, strings.NewReader(token), uid)
+}
+
+// storeVolumeFile writes data to path in the credentials volume.
+// The data is streamed over stdin and written by the target UID, so the
+// entrypoint can read the 0600 file in later sessions.
+func storeVolumeFile(containerRuntime, volumeName, imageName, path string, data io.Reader, uid int) error {
+	gid := os.Getgid()
+	if uid != os.Getuid() {
+		gid = uid
 	}
-	return strings.TrimSpace(string(output)), nil
+
+	args := []string{"run", "--rm", "-i"}
+	args = append(args, containerUserArgs(&Config{}, containerRuntime, uid, gid)...)
+	args = append(args,
+		"-v", volumeName+":/mnt/claude-data",
+		imageName,
+		"sh", "-c", atomicWriteScript, "sh", path)
+
+	return runContainerWithInput(containerRuntime, args, data)
 }
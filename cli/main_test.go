@@ -1,7 +1,11 @@
 package main
 
 import (
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -395,6 +399,117 @@ func TestClaudeConfigEnvVarOverrides(t *testing.T) {
 	}
 }
 
+func TestValidateOAuthToken(t *testing.T) {
+	valid := "sk-ant-oat01-" + strings.Repeat("aB3_-", 20)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"empty", "", true},
+		{"wrong prefix", "sk-ant-api03-" + strings.Repeat("a", 40), true},
+		{"too short", "sk-ant-oat01-abc", true},
+		{"too long", "sk-ant-oat01-" + strings.Repeat("a", 501), true},
+		{"shell quote", valid + "';rm -rf /;'", true},
+		{"newline", valid + "\nmore", true},
+		{"space", "sk-ant-oat01-" + strings.Repeat("a", 20) + " b", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOAuthToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateOAuthToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && tt.token != "" && strings.Contains(err.Error(), tt.token) {
+				t.Errorf("validateOAuthToken() error leaks the token: %v", err)
+			}
+		})
+	}
+}
+
+func TestAtomicWriteScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, ".oauth-token")
+	if err := os.WriteFile(target, []byte("old-token"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Quotes and metacharacters in the data must be written verbatim
+	data := "sk-ant-oat01-abc'$(touch pwned)\"$HOME"
+	cmd := exec.Command("sh", "-c", atomicWriteScript, "sh", target)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("atomicWriteScript failed: %v: %s", err, out)
+	}
+
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("written content = %q, want %q", got, data)
+	}
+	info, _ := os.Stat(target)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %o, want 600", info.Mode().Perm())
+	}
+	if fileExists(filepath.Join(dir, "pwned")) {
+		t.Error("data was evaluated by the shell")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
+
+func TestStoreOAuthToken(t *testing.T) {
+	token := "sk-ant-oat01-" + strings.Repeat("x", 90) + "AA"
+
+	var gotArgs []string
+	var gotInput string
+	originalFn := runContainerWithInput
+	runContainerWithInput = func(_ string, args []string, input io.Reader) error {
+		gotArgs = args
+		data, _ := io.ReadAll(input)
+		gotInput = string(data)
+		return nil
+	}
+	defer func() { runContainerWithInput = originalFn }()
+
+	if err := storeOAuthToken("podman", "cc-sandbox-credentials-1000", "test-image", token, 1000); err != nil {
+		t.Fatalf("storeOAuthToken() error = %v", err)
+	}
+	if gotInput != token {
+		t.Errorf("token on stdin = %q, want %q", gotInput, token)
+	}
+	argsStr := joinArgs(gotArgs)
+	if contains(argsStr, token) {
+		t.Errorf("token leaked into container args: %v", gotArgs)
+	}
+	for _, want := range []string{"-i", "cc-sandbox-credentials-1000:/mnt/claude-data", atomicWriteScript, oauthTokenPath} {
+		if !contains(argsStr, want) {
+			t.Errorf("container args missing %q: %v", want, gotArgs)
+		}
+	}
+
+	gotArgs = nil
+	if err := storeOAuthToken("podman", "vol", "test-image", "sk-ant-oat01-bad'quote", 1000); err == nil {
+		t.Error("storeOAuthToken() accepted a malformed token")
+	}
+	if gotArgs != nil {
+		t.Error("storeOAuthToken() ran a container for a malformed token")
+	}
+}
+
 // Helper functions
 func boolPtr(b bool) *bool { return &b }
 
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Network policies (--network-policy). In allowlist mode the sandbox has no
+// network of its own (--network none); its HTTP_PROXY is a loopback port that
+// the entrypoint forwards to a socket served by cc-sandbox on the host. The
+// proxy only connects to allowed hosts and logs every decision.
+const (
+	networkPolicyOpen      = "open"
+	networkPolicyNone      = "none"
+	networkPolicyAllowlist = "allowlist"
+)
+
+// containerNetworkDir is where the network proxy socket's directory is
+// mounted in the sandbox.
+const containerNetworkDir = "/run/cc-sandbox-net"
+
+// networkProxySocketName is the network proxy socket's file name in its directory.
+const networkProxySocketName = "proxy.sock"
+
+// networkProxyPort is the loopback port the entrypoint forwards to the proxy socket.
+const networkProxyPort = 3128
+
+// defaultNetworkAllow lists the hosts every allowlist sandbox may reach: the
+// Anthropic API and login, GitHub and the npm registry. network_allow entries
+// add to it.
+var defaultNetworkAllow = []string{
+	"api.anthropic.com",
+	"console.anthropic.com",
+	"statsig.anthropic.com",
+	"claude.ai",
+	"github.com",
+	"api.github.com",
+	"codeload.github.com",
+	"*.githubusercontent.com",
+	"registry.npmjs.org",
+}
+
+// networkAllowPattern matches a network_allow entry: a host name, optionally
+// with a "*." prefix for its subdomains.
+var networkAllowPattern = regexp.MustCompile(`^(\*\.)?[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+// validateNetworkPolicy checks --network-policy and the network_allow entries.
+func validateNetworkPolicy(cfg *Config) error {
+	switch cfg.NetworkPolicy {
+	case "", networkPolicyOpen:
+		return nil
+	case networkPolicyNone, networkPolicyAllowlist:
+	default:
+		return fmt.Errorf("invalid network policy %q: use open, none or allowlist", cfg.NetworkPolicy)
+	}
+	if cfg.HostNetwork {
+		return fmt.Errorf("--network-policy %s can't be combined with --host-network", cfg.NetworkPolicy)
+	}
+	for _, entry := range cfg.NetworkAllow {
+		if !networkAllowPattern.MatchString(entry) && net.ParseIP(entry) == nil {
+			return fmt.Errorf("invalid network_allow entry %q: use a host name, *.domain or an IP address", entry)
+		}
+	}
+	return nil
+}
+
+// networkAllowed reports whether host matches an allowlist entry. "*.example.com"
+// matches the subdomains of example.com, any other entry only itself.
+func networkAllowed(allow []string, host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, entry := range allow {
+		entry = strings.ToLower(entry)
+		if domain, ok := strings.CutPrefix(entry, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// networkProxyConfig is everything a network proxy process needs to serve a sandbox.
+type networkProxyConfig struct {
+	Dir   string   `json:"dir"`   // Host directory of the proxy socket
+	Allow []string `json:"allow"` // Allowed hosts (see networkAllowed)
+	Log   string   `json:"log"`   // Log of allowed and blocked connections
+}
+
+// networkProxyConfigFor returns the proxy config of a sandbox whose proxy
+// directory and log have been created.
+func networkProxyConfigFor(cfg *Config) networkProxyConfig {
+	allow := append(append([]string(nil), defaultNetworkAllow...), cfg.NetworkAllow...)
+	return networkProxyConfig{Dir: cfg.NetworkProxyDir, Allow: allow, Log: cfg.NetworkLog}
+}
+
+// networkPolicyArgs returns the container flags of the sandbox's network policy.
+func networkPolicyArgs(cfg *Config) []string {
+	switch cfg.NetworkPolicy {
+	case networkPolicyNone:
+		return []string{"--network=none"}
+	case networkPolicyAllowlist:
+		proxyURL := "http://127.0.0.1:" + strconv.Itoa(networkProxyPort)
+		args := []string{"--network=none", "-v", cfg.NetworkProxyDir + ":" + containerNetworkDir}
+		for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+			args = append(args, "-e", name+"="+proxyURL)
+		}
+		return append(args, "-e", "NO_PROXY=localhost,127.0.0.1,::1", "-e", "no_proxy=localhost,127.0.0.1,::1")
+	}
+	return nil
+}
+
+// networkLogsDir returns the directory of the allowlist proxy's session logs.
+func networkLogsDir() string {
+	return filepath.Join(dataBaseDir(), "network-logs")
+}
+
+// createNetworkProxyFiles creates the proxy directory and the session log of
+// an allowlist sandbox and sets cfg.NetworkProxyDir and cfg.NetworkLog.
+func createNetworkProxyFiles(cfg *Config) error {
+	if err := os.MkdirAll(networkLogsDir(), 0700); err != nil {
+		return fmt.Errorf("failed to create network log directory: %w", err)
+	}
+	name := cfg.Name
+	if name == "" {
+		name = composeProjectName(cfg.Workdir)
+	}
+	logFile, err := os.CreateTemp(networkLogsDir(), time.Now().Format("20060102-150405")+"-"+name+"-*.log")
+	if err != nil {
+		return fmt.Errorf("failed to create network log: %w", err)
+	}
+	_ = logFile.Close()
+
+	dir, err := os.MkdirTemp(secretsBaseDir(), "cc-sandbox-net-")
+	if err != nil {
+		return fmt.Errorf("failed to create network proxy directory: %w", err)
+	}
+	cfg.NetworkProxyDir, cfg.NetworkLog = dir, logFile.Name()
+	return nil
+}
+
+// removeNetworkProxyDir deletes a proxy directory. The path may come from a
+// container label, so only directories created by createNetworkProxyFiles are removed.
+func removeNetworkProxyDir(dir string) {
+	if dir == "" || !filepath.IsAbs(dir) || !strings.HasPrefix(filepath.Base(dir), "cc-sandbox-net-") {
+		return
+	}
+	_ = os.RemoveAll(dir)
+}
+
+// networkProxy is an HTTP proxy that only connects to allowed hosts. Plain
+// HTTP requests are forwarded; HTTPS goes through CONNECT tunnels.
+type networkProxy struct {
+	cfg       networkProxyConfig
+	server    *http.Server
+	transport *http.Transport
+
+	mu      sync.Mutex
+	log     *os.File
+	blocked int
+}
+
+// listenNetworkProxy creates the proxy socket in cfg.Dir and serves it until close.
+func listenNetworkProxy(cfg networkProxyConfig) (*networkProxy, error) {
+	logFile, err := os.OpenFile(cfg.Log, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open network log: %w", err)
+	}
+	socket := filepath.Join(cfg.Dir, networkProxySocketName)
+	_ = os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		_ = logFile.Close()
+		return nil, fmt.Errorf("failed to create network proxy socket: %w", err)
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		_ = listener.Close()
+		_ = logFile.Close()
+		return nil, fmt.Errorf("failed to create network proxy socket: %w", err)
+	}
+
+	p := &networkProxy{cfg: cfg, log: logFile, transport: &http.Transport{}}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: time.Minute}
+	go func() { _ = p.server.Serve(listener) }()
+	return p, nil
+}
+
+// Close stops serving and closes the log.
+func (p *networkProxy) Close() error {
+	err := p.server.Close()
+	p.mu.Lock()
+	_ = p.log.Close()
+	p.mu.Unlock()
+	return err
+}
+
+// close stops serving and removes the proxy directory. It is safe to call on
+// a nil proxy.
+func (p *networkProxy) close() {
+	if p == nil {
+		return
+	}
+	_ = p.Close()
+	removeNetworkProxyDir(p.cfg.Dir)
+}
+
+// report tells the user about blocked connections. It is safe to call on a
+// nil proxy.
+func (p *networkProxy) report(w io.Writer) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	blocked := p.blocked
+	p.mu.Unlock()
+	if blocked > 0 {
+		fmt.Fprintf(w, "[cc-sandbox] Blocked %d connection(s) outside the network allowlist, see %s\n", blocked, p.cfg.Log)
+	}
+}
+
+// record logs a decision as "<time> allowed|blocked <method> <host:port>".
+func (p *networkProxy) record(allowed bool, method, target string) {
+	decision := "allowed"
+	if !allowed {
+		decision = "blocked"
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !allowed {
+		p.blocked++
+	}
+	fmt.Fprintf(p.log, "%s %s %s %s\n", time.Now().UTC().Format(time.RFC3339), decision, method, target)
+}
+
+func (p *networkProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Host
+	if r.Method == http.MethodConnect {
+		target = r.Host
+	}
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+	}
+	if host == "" {
+		http.Error(w, "cc-sandbox: the network proxy only serves CONNECT and absolute http:// URLs", http.StatusBadRequest)
+		return
+	}
+
+	allowed := networkAllowed(p.cfg.Allow, host)
+	p.record(allowed, r.Method, target)
+	if !allowed {
+		http.Error(w, fmt.Sprintf("cc-sandbox: %s is not in the network allowlist (allow it with --network-allow %s or network_allow in the config)", host, host), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, target)
+		return
+	}
+	p.forward(w, r)
+}
+
+// tunnel connects a CONNECT request to target.
+func (p *networkProxy) tunnel(w http.ResponseWriter, target string) {
+	upstream, err := net.DialTimeout("tcp", target, 30*time.Second)
+	if err != nil {
+		http.Error(w, "cc-sandbox: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = upstream.Close() }()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "cc-sandbox: tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer func() { _ = client.Close() }()
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+
+	go func() {
+		_, _ = io.Copy(upstream, buffered)
+		closeWrite(upstream)
+	}()
+	_, _ = io.Copy(client, upstream)
+}
+
+// hopHeaders are the headers that apply to one connection and are not forwarded.
+var hopHeaders = []string{"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// forward sends a plain HTTP request on and copies the response back.
+func (p *networkProxy) forward(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Scheme != "http" {
+		http.Error(w, "cc-sandbox: the network proxy only serves CONNECT and absolute http:// URLs", http.StatusBadRequest)
+		return
+	}
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, "cc-sandbox: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// startNetworkProxy serves the allowlist proxy for a sandbox run by this
+// process. Returns a nil proxy if the sandbox doesn't use it.
+func startNetworkProxy(cfg *Config) (*networkProxy, error) {
+	if cfg.NetworkPolicy != networkPolicyAllowlist {
+		return nil, nil
+	}
+	if err := createNetworkProxyFiles(cfg); err != nil {
+		return nil, err
+	}
+	proxy, err := listenNetworkProxy(networkProxyConfigFor(cfg))
+	if err != nil {
+		removeNetworkProxyDir(cfg.NetworkProxyDir)
+		return nil, err
+	}
+	return proxy, nil
+}
+
+// startDetachedNetworkProxy serves the allowlist proxy for a named sandbox
+// from a background `cc-sandbox network-proxy` process. Does nothing if the
+// sandbox doesn't use the proxy.
+func startDetachedNetworkProxy(cfg *Config, containerRuntime string) error {
+	if cfg.NetworkPolicy != networkPolicyAllowlist {
+		return nil
+	}
+	if err := createNetworkProxyFiles(cfg); err != nil {
+		return err
+	}
+	proxyCfg := networkProxyConfigFor(cfg)
+	if err := spawnProxyHelper("network-proxy", containerRuntime, sandboxContainerName(cfg.Name), filepath.Join(proxyCfg.Dir, networkProxySocketName), proxyCfg); err != nil {
+		removeNetworkProxyDir(cfg.NetworkProxyDir)
+		return err
+	}
+	return nil
+}
+
+// ensureNetworkProxy restarts the network proxy process of a named sandbox
+// if it is not running.
+func ensureNetworkProxy(containerRuntime, name string, cfg networkProxyConfig) error {
+	return ensureProxyHelper("network-proxy", containerRuntime, sandboxContainerName(name), filepath.Join(cfg.Dir, networkProxySocketName), cfg)
+}
+
+// newNetworkProxyCmd creates the hidden command that serves the network
+// proxy of a named sandbox in the background.
+func newNetworkProxyCmd() *cobra.Command {
+	return newProxyHelperCmd("network-proxy", "Serve the network allowlist proxy of a named sandbox", func(configJSON string) (string, func() (io.Closer, error), error) {
+		var cfg networkProxyConfig
+		if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+			return "", nil, err
+		}
+		return cfg.Dir, func() (io.Closer, error) {
+			return listenNetworkProxy(cfg)
+		}, nil
+	})
+}
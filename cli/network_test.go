@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateNetworkPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"open", Config{NetworkPolicy: "open", HostNetwork: true}, false},
+		{"default", Config{}, false},
+		{"none", Config{NetworkPolicy: "none"}, false},
+		{"allowlist", Config{NetworkPolicy: "allowlist", NetworkAllow: []string{"pypi.org", "*.example.com", "10.0.0.1"}}, false},
+		{"unknown policy", Config{NetworkPolicy: "closed"}, true},
+		{"with host network", Config{NetworkPolicy: "allowlist", HostNetwork: true}, true},
+		{"URL entry", Config{NetworkPolicy: "allowlist", NetworkAllow: []string{"https://pypi.org"}}, true},
+		{"wildcard in the middle", Config{NetworkPolicy: "allowlist", NetworkAllow: []string{"api.*.com"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateNetworkPolicy(&tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateNetworkPolicy() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNetworkAllowed(t *testing.T) {
+	allow := []string{"github.com", "*.githubusercontent.com", "Registry.npmjs.org"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"github.com", true},
+		{"GitHub.com.", true},
+		{"gist.github.com", false},
+		{"raw.githubusercontent.com", true},
+		{"githubusercontent.com", false},
+		{"registry.npmjs.org", true},
+		{"evilgithub.com", false},
+		{"github.com.evil.io", false},
+	}
+	for _, tt := range tests {
+		if got := networkAllowed(allow, tt.host); got != tt.want {
+			t.Errorf("networkAllowed(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestBuildContainerArgsNetworkPolicy(t *testing.T) {
+	cfg := &Config{Workdir: "/src/api", NetworkPolicy: "none"}
+	if argsStr := joinArgs(buildContainerArgs(cfg, "docker", "test-image", nil)); !contains(argsStr, "--network=none ") {
+		t.Errorf("buildContainerArgs() = %s, want --network=none", argsStr)
+	}
+
+	cfg = &Config{Workdir: "/src/api", NetworkPolicy: "allowlist", NetworkProxyDir: "/run/user/1000/cc-sandbox-net-1"}
+	argsStr := joinArgs(buildContainerArgs(cfg, "docker", "test-image", nil))
+	for _, want := range []string{
+		"--network=none ",
+		"-v /run/user/1000/cc-sandbox-net-1:" + containerNetworkDir + " ",
+		"-e HTTPS_PROXY=http://127.0.0.1:3128 ",
+		"-e no_proxy=localhost,127.0.0.1,::1 ",
+	} {
+		if !contains(argsStr, want) {
+			t.Errorf("buildContainerArgs() = %s, want %q", argsStr, want)
+		}
+	}
+
+	cfg = &Config{Workdir: "/src/api"}
+	if argsStr := joinArgs(buildContainerArgs(cfg, "docker", "test-image", nil)); contains(argsStr, "--network") || contains(argsStr, "PROXY") {
+		t.Errorf("buildContainerArgs() with the open policy = %s", argsStr)
+	}
+}
+
+func TestNetworkProxyConfigFor(t *testing.T) {
+	proxyCfg := networkProxyConfigFor(&Config{NetworkAllow: []string{"pypi.org"}})
+	if !networkAllowed(proxyCfg.Allow, "api.anthropic.com") || !networkAllowed(proxyCfg.Allow, "pypi.org") {
+		t.Errorf("networkProxyConfigFor() allow = %v, want the defaults and the configured hosts", proxyCfg.Allow)
+	}
+}
+
+func TestNetworkProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "plain "+r.URL.Path)
+	}))
+	defer upstream.Close()
+	tlsUpstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "tls "+r.URL.Path)
+	}))
+	defer tlsUpstream.Close()
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "network.log")
+	proxy, err := listenNetworkProxy(networkProxyConfig{Dir: dir, Allow: []string{"127.0.0.1"}, Log: logPath})
+	if err != nil {
+		t.Skipf("unix sockets not available: %v", err)
+	}
+	defer func() { _ = proxy.Close() }()
+
+	transport := tlsUpstream.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: "proxy"})
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", filepath.Join(dir, networkProxySocketName))
+	}
+	client := &http.Client{Transport: transport}
+	get := func(target string) (int, string) {
+		resp, err := client.Get(target)
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := get(upstream.URL + "/a"); status != http.StatusOK || body != "plain /a" {
+		t.Errorf("allowed http = %d %q", status, body)
+	}
+	if status, body := get(tlsUpstream.URL + "/b"); status != http.StatusOK || body != "tls /b" {
+		t.Errorf("allowed https = %d %q", status, body)
+	}
+	if status, body := get("http://blocked.invalid/c"); status != http.StatusForbidden || !strings.Contains(body, "not in the network allowlist") {
+		t.Errorf("blocked http = %d %q, want 403 with an explanation", status, body)
+	}
+	if status, _ := get("https://blocked.invalid/d"); status != 0 {
+		t.Errorf("blocked https = %d, want the CONNECT to fail", status)
+	}
+
+	var buf bytes.Buffer
+	proxy.report(&buf)
+	if !strings.Contains(buf.String(), "Blocked 2 connection(s)") {
+		t.Errorf("report() = %q", buf.String())
+	}
+	_ = proxy.Close()
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	for _, want := range []string{
+		"allowed GET " + strings.TrimPrefix(upstream.URL, "http://"),
+		"allowed CONNECT " + strings.TrimPrefix(tlsUpstream.URL, "https://"),
+		"blocked GET blocked.invalid",
+		"blocked CONNECT blocked.invalid:443",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("network log missing %q:\n%s", want, log)
+		}
+	}
+}
+
+func TestRemoveNetworkProxyDir(t *testing.T) {
+	base := t.TempDir()
+	proxyDir := filepath.Join(base, "cc-sandbox-net-123")
+	other := filepath.Join(base, "cc-sandbox-docker-123")
+	for _, dir := range []string{proxyDir, other} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removeNetworkProxyDir(proxyDir)
+	removeNetworkProxyDir(other)
+	if dirExists(proxyDir) || !dirExists(other) {
+		t.Error("removeNetworkProxyDir() must remove only network proxy directories")
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Auth providers. OAuth uses a Claude subscription; the others bill through
+// an Anthropic API key or a cloud provider.
+const (
+	ProviderOAuth   = "oauth"
+	ProviderAPIKey  = "api-key"
+	ProviderBedrock = "bedrock"
+	ProviderVertex  = "vertex"
+)
+
+// KnownProviders lists the supported auth providers.
+var KnownProviders = []string{ProviderOAuth, ProviderAPIKey, ProviderBedrock, ProviderVertex}
+
+// providerDataDir holds provider credentials and settings in the credentials volume.
+// The entrypoint reads it to export the provider's environment variables.
+const providerDataDir = "/mnt/claude-data/.cc-sandbox"
+
+// defaultVertexRegion is used when neither --region nor CLOUD_ML_REGION is set.
+const defaultVertexRegion = "us-east5"
+
+// apiKeyPattern matches Anthropic API keys.
+var apiKeyPattern = regexp.MustCompile(`^sk-ant-api[0-9]{2}-[A-Za-z0-9_-]{20,500}$`)
+
+// providerOptions holds the auth flags that configure cloud providers.
+type providerOptions struct {
+	Region        string // AWS region or Vertex AI region
+	AWSProfile    string // AWS profile for Bedrock
+	VertexProject string // Google Cloud project for Vertex AI
+}
+
+// volumeFile is a file to store in the credentials volume.
+type volumeFile struct {
+	Path string // Absolute path in the container
+	Data []byte
+}
+
+// validateProvider checks a provider name. An empty name keeps the stored provider.
+func validateProvider(provider string) error {
+	if provider == "" {
+		return nil
+	}
+	for _, p := range KnownProviders {
+		if provider == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid provider %q: must be one of %s", provider, strings.Join(KnownProviders, ", "))
+}
+
+// validateAPIKey checks that key looks like an Anthropic API key.
+func validateAPIKey(key string) error {
+	if !strings.HasPrefix(key, "sk-ant-api") {
+		return errors.New("invalid API key: expected an sk-ant-api key")
+	}
+	if !apiKeyPattern.MatchString(key) {
+		return errors.New("invalid API key: unexpected length or characters")
+	}
+	return nil
+}
+
+// readSecretInput reads a secret from input. On a terminal it prompts and reads
+// one line without echo; otherwise (or with fromStdin) it reads everything up
+// to EOF.
+func readSecretInput(input io.Reader, fromStdin bool, prompt string) (string, error) {
+	if fromStdin || !isStdinTerminal() {
+		return readTokenInput(input)
+	}
+
+	// Not echoed, so the secret doesn't stay in the terminal's scrollback
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := readPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	secret := strings.TrimSpace(string(line))
+	if secret == "" {
+		return "", errors.New("no value entered")
+	}
+	return secret, nil
+}
+
+// readPassword reads a line from a terminal without echo.
+// This is a variable to allow mocking in tests.
+var readPassword = term.ReadPassword
+
+// isStdinTerminal reports whether stdin is a terminal.
+// This is a variable to allow mocking in tests.
+var isStdinTerminal = func() bool {
+	fileInfo, err := os.Stdin.Stat()
+	return err == nil && (fileInfo.Mode()&os.ModeCharDevice) != 0
+}
+
+// formatEnvFile renders settings as sorted KEY=VALUE lines for the entrypoint.
+func formatEnvFile(settings map[string]string) ([]byte, error) {
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		v := settings[k]
+		if v == "" {
+			continue
+		}
+		if !isValidEnvName(k) || strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("invalid setting %s=%q", k, v)
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", k, v)
+	}
+	return buf.Bytes(), nil
+}
+
+// firstNonEmpty returns the first non-empty value.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// apiKeyFiles returns the files that store an Anthropic API key.
+func apiKeyFiles(key string) ([]volumeFile, error) {
+	if err := validateAPIKey(key); err != nil {
+		return nil, err
+	}
+	return []volumeFile{{providerDataDir + "/api-key", []byte(key)}}, nil
+}
+
+// bedrockFiles returns the files that configure Amazon Bedrock: the selected
+// profile from the host's AWS config and credentials files, and the region
+// and profile settings. The agent can read the credentials volume, so other
+// profiles stay on the host. Without a matching profile, static keys from the
+// AWS_* environment are used instead.
+func bedrockFiles(opts providerOptions, home string) ([]volumeFile, error) {
+	region := firstNonEmpty(opts.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))
+	if region == "" {
+		return nil, errors.New("bedrock needs an AWS region: use --region or set AWS_REGION")
+	}
+	profile := firstNonEmpty(opts.AWSProfile, os.Getenv("AWS_PROFILE"))
+
+	configPath := firstNonEmpty(os.Getenv("AWS_CONFIG_FILE"), filepath.Join(home, ".aws", "config"))
+	credentialsPath := firstNonEmpty(os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), filepath.Join(home, ".aws", "credentials"))
+	config, err := readOptionalFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := readOptionalFile(credentialsPath)
+	if err != nil {
+		return nil, err
+	}
+	config, credentials = awsProfileFiles(config, credentials, firstNonEmpty(profile, "default"))
+
+	var files []volumeFile
+	if len(config) > 0 {
+		files = append(files, volumeFile{providerDataDir + "/aws/config", config})
+	}
+	if len(credentials) > 0 {
+		files = append(files, volumeFile{providerDataDir + "/aws/credentials", credentials})
+	}
+
+	if len(files) == 0 {
+		accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if accessKey == "" || secretKey == "" {
+			return nil, fmt.Errorf("no AWS credentials found for profile %s: add it to %s or set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY",
+				firstNonEmpty(profile, "default"), credentialsPath)
+		}
+		section := firstNonEmpty(profile, "default")
+		creds := fmt.Sprintf("[%s]\naws_access_key_id = %s\naws_secret_access_key = %s\n", section, accessKey, secretKey)
+		if sessionToken := os.Getenv("AWS_SESSION_TOKEN"); sessionToken != "" {
+			creds += "aws_session_token = " + sessionToken + "\n"
+		}
+		files = append(files, volumeFile{providerDataDir + "/aws/credentials", []byte(creds)})
+	}
+
+	settings, err := formatEnvFile(map[string]string{"AWS_REGION": region, "AWS_PROFILE": profile})
+	if err != nil {
+		return nil, err
+	}
+	return append(files, volumeFile{providerDataDir + "/bedrock.env", settings}), nil
+}
+
+// readOptionalFile reads path; a missing file reads as empty.
+func readOptionalFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// awsProfileFiles trims an AWS config and credentials file down to profile
+// and the sections it depends on: the profiles named by source_profile (role
+// chains) and its sso-session. Either file may be empty.
+func awsProfileFiles(config, credentials []byte, profile string) ([]byte, []byte) {
+	configSections, credentialsSections := parseINISections(config), parseINISections(credentials)
+
+	keepConfig := map[string]bool{}
+	keepCredentials := map[string]bool{}
+	pending := []string{profile}
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if keepCredentials[name] {
+			continue
+		}
+		keepCredentials[name] = true
+
+		// The config file names sections "profile <name>", except default
+		header := "profile " + name
+		if _, ok := configSections.index[header]; !ok && name == "default" {
+			header = "default"
+		}
+		keepConfig[header] = true
+		for _, sectionLines := range [][]string{configSections.lines(header), credentialsSections.lines(name)} {
+			for _, line := range sectionLines {
+				key, value, ok := strings.Cut(line, "=")
+				if !ok {
+					continue
+				}
+				switch strings.TrimSpace(key) {
+				case "source_profile":
+					pending = append(pending, strings.TrimSpace(value))
+				case "sso_session":
+					keepConfig["sso-session "+strings.TrimSpace(value)] = true
+				}
+			}
+		}
+	}
+	return configSections.render(keepConfig), credentialsSections.render(keepCredentials)
+}
+
+// iniSections is an INI file split into its sections, in file order.
+type iniSections struct {
+	names []string
+	index map[string]int
+	body  [][]string
+}
+
+// parseINISections splits data into sections. Lines before the first section
+// header are dropped.
+func parseINISections(data []byte) iniSections {
+	s := iniSections{index: map[string]int{}}
+	current := -1
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			name := strings.Join(strings.Fields(trimmed[1:len(trimmed)-1]), " ")
+			if i, ok := s.index[name]; ok {
+				current = i
+				continue
+			}
+			current = len(s.names)
+			s.index[name] = current
+			s.names = append(s.names, name)
+			s.body = append(s.body, nil)
+			continue
+		}
+		if current >= 0 && trimmed != "" {
+			s.body[current] = append(s.body[current], line)
+		}
+	}
+	return s
+}
+
+// lines returns the lines of section name, or nil if there is none.
+func (s iniSections) lines(name string) []string {
+	if i, ok := s.index[name]; ok {
+		return s.body[i]
+	}
+	return nil
+}
+
+// render writes the sections in keep back out, in file order.
+func (s iniSections) render(keep map[string]bool) []byte {
+	var buf bytes.Buffer
+	for i, name := range s.names {
+		if !keep[name] {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "[%s]\n", name)
+		for _, line := range s.body[i] {
+			buf.WriteString(line + "\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// vertexFiles returns the files that configure Google Vertex AI: the host's
+// application default credentials and the project and region settings.
+func vertexFiles(opts providerOptions, home string) ([]volumeFile, error) {
+	adcPath := firstNonEmpty(os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"),
+		filepath.Join(home, ".config", "gcloud", "application_default_credentials.json"))
+	data, err := os.ReadFile(adcPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no application default credentials at %s: run 'gcloud auth application-default login' or set GOOGLE_APPLICATION_CREDENTIALS", adcPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", adcPath, err)
+	}
+
+	var adc struct {
+		QuotaProjectID string `json:"quota_project_id"`
+	}
+	if err := json.Unmarshal(data, &adc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", adcPath, err)
+	}
+
+	project := firstNonEmpty(opts.VertexProject, os.Getenv("ANTHROPIC_VERTEX_PROJECT_ID"), adc.QuotaProjectID, os.Getenv("GOOGLE_CLOUD_PROJECT"))
+	if project == "" {
+		return nil, errors.New("vertex needs a Google Cloud project: use --vertex-project or set ANTHROPIC_VERTEX_PROJECT_ID")
+	}
+	region := firstNonEmpty(opts.Region, os.Getenv("CLOUD_ML_REGION"), defaultVertexRegion)
+
+	settings, err := formatEnvFile(map[string]string{"ANTHROPIC_VERTEX_PROJECT_ID": project, "CLOUD_ML_REGION": region})
+	if err != nil {
+		return nil, err
+	}
+	return []volumeFile{
+		{providerDataDir + "/gcloud/adc.json", data},
+		{providerDataDir + "/vertex.env", settings},
+	}, nil
+}
+
+// providerSelectionFile records provider as the one the entrypoint uses by default.
+func providerSelectionFile(provider string) volumeFile {
+	return volumeFile{providerDataDir + "/provider", []byte(provider)}
+}
+
+// storeVolumeFiles writes files into the credentials volume in order.
+func storeVolumeFiles(containerRuntime, volumeName, imageName string, files []volumeFile, uid int) error {
+	for _, f := range files {
+		if err := storeVolumeFile(containerRuntime, volumeName, imageName, f.Path, bytes.NewReader(f.Data), uid); err != nil {
+			return fmt.Errorf("failed to store %s: %w", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// selectOAuthProvider records OAuth as the volume's provider after a
+// subscription login, so an earlier API key or cloud setup stops applying.
+func selectOAuthProvider(containerRuntime, volumeName, imageName string, uid int) error {
+	return storeVolumeFiles(containerRuntime, volumeName, imageName, []volumeFile{providerSelectionFile(ProviderOAuth)}, uid)
+}
+
+// runAuthProvider captures credentials for an API key or cloud provider and
+// stores them in the credentials volume. Everything is read and checked before
+// a container is started.
+func runAuthProvider(target authTarget, provider string, opts providerOptions, input io.Reader, fromStdin bool) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	var files []volumeFile
+	switch provider {
+	case ProviderAPIKey:
+		var key string
+		if key, err = readSecretInput(input, fromStdin, "Anthropic API key: "); err == nil {
+			files, err = apiKeyFiles(key)
+		}
+	case ProviderBedrock:
+		files, err = bedrockFiles(opts, home)
+	case ProviderVertex:
+		files, err = vertexFiles(opts, home)
+	default:
+		return fmt.Errorf("provider %q does not store credentials this way", provider)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Written last, so a failed store leaves the previous provider selected
+	files = append(files, providerSelectionFile(provider))
+
+	containerRuntime, imageName, err := prepareAuthImage("base")
+	if err != nil {
+		return err
+	}
+	volumeName := target.volume()
+
+	if err := storeVolumeFiles(containerRuntime, volumeName, imageName, files, target.uid()); err != nil {
+		return err
+	}
+
+	fmt.Printf("Provider %s configured in volume: %s\n", provider, volumeName)
+	return nil
+}
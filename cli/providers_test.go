@@ -0,0 +1,300 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setEnv sets environment variables for a test and restores them afterwards.
+func setEnv(t *testing.T, vars map[string]string) {
+	t.Helper()
+	for k, v := range vars {
+		old, had := os.LookupEnv(k)
+		if v == "" {
+			_ = os.Unsetenv(k)
+		} else {
+			_ = os.Setenv(k, v)
+		}
+		t.Cleanup(func() {
+			if had {
+				_ = os.Setenv(k, old)
+			} else {
+				_ = os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+// volumeFileMap indexes volume files by path.
+func volumeFileMap(files []volumeFile) map[string]string {
+	m := make(map[string]string, len(files))
+	for _, f := range files {
+		m[f.Path] = string(f.Data)
+	}
+	return m
+}
+
+func TestValidateProvider(t *testing.T) {
+	for _, p := range []string{"", "oauth", "api-key", "bedrock", "vertex"} {
+		if err := validateProvider(p); err != nil {
+			t.Errorf("validateProvider(%q) error = %v", p, err)
+		}
+	}
+	for _, p := range []string{"openai", "API-KEY", "bedrock "} {
+		if err := validateProvider(p); err == nil {
+			t.Errorf("validateProvider(%q) expected error", p)
+		}
+	}
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	if err := validateAPIKey("sk-ant-api03-" + strings.Repeat("x", 40)); err != nil {
+		t.Errorf("validateAPIKey() error = %v", err)
+	}
+	for _, key := range []string{"", "sk-ant-oat01-" + strings.Repeat("x", 40), "sk-ant-api03-short", "sk-ant-api03-" + strings.Repeat("x", 40) + "\n"} {
+		if err := validateAPIKey(key); err == nil {
+			t.Errorf("validateAPIKey(%q) expected error", key)
+		}
+	}
+}
+
+func TestFormatEnvFile(t *testing.T) {
+	got, err := formatEnvFile(map[string]string{"B": "2", "A": "1", "EMPTY": ""})
+	if err != nil {
+		t.Fatalf("formatEnvFile() error = %v", err)
+	}
+	if string(got) != "A=1\nB=2\n" {
+		t.Errorf("formatEnvFile() = %q, want %q", got, "A=1\nB=2\n")
+	}
+
+	if _, err := formatEnvFile(map[string]string{"A": "1\nB=2"}); err == nil {
+		t.Error("formatEnvFile() accepted a value with a newline")
+	}
+}
+
+func TestReadSecretInput(t *testing.T) {
+	oldTerminal, oldReadPassword := isStdinTerminal, readPassword
+	defer func() { isStdinTerminal, readPassword = oldTerminal, oldReadPassword }()
+
+	// A terminal is read without echo, never from input
+	isStdinTerminal = func() bool { return true }
+	readPassword = func(int) ([]byte, error) { return []byte(" sk-secret \n"), nil }
+	got, err := readSecretInput(strings.NewReader("echoed\n"), false, "Key: ")
+	if err != nil || got != "sk-secret" {
+		t.Errorf("readSecretInput() on a terminal = %q, %v, want sk-secret", got, err)
+	}
+
+	readPassword = func(int) ([]byte, error) { return nil, nil }
+	if _, err := readSecretInput(strings.NewReader(""), false, "Key: "); err == nil {
+		t.Error("readSecretInput() expected error for an empty value")
+	}
+
+	// Piped input is read up to EOF
+	isStdinTerminal = func() bool { return false }
+	readPassword = func(int) ([]byte, error) { t.Fatal("readPassword called without a terminal"); return nil, nil }
+	if got, err := readSecretInput(strings.NewReader("piped\n"), false, "Key: "); err != nil || got != "piped" {
+		t.Errorf("readSecretInput() from a pipe = %q, %v, want piped", got, err)
+	}
+}
+
+func TestBedrockFiles(t *testing.T) {
+	home := t.TempDir()
+	setEnv(t, map[string]string{
+		"AWS_REGION": "", "AWS_DEFAULT_REGION": "", "AWS_PROFILE": "",
+		"AWS_CONFIG_FILE": "", "AWS_SHARED_CREDENTIALS_FILE": "",
+		"AWS_ACCESS_KEY_ID": "", "AWS_SECRET_ACCESS_KEY": "", "AWS_SESSION_TOKEN": "",
+	})
+
+	if _, err := bedrockFiles(providerOptions{}, home); err == nil {
+		t.Error("bedrockFiles() expected error without a region")
+	}
+	if _, err := bedrockFiles(providerOptions{Region: "us-east-1"}, home); err == nil {
+		t.Error("bedrockFiles() expected error without credentials")
+	}
+
+	// Static keys from the environment become a credentials file
+	setEnv(t, map[string]string{"AWS_ACCESS_KEY_ID": "AKIAEXAMPLE", "AWS_SECRET_ACCESS_KEY": "secret"})
+	files, err := bedrockFiles(providerOptions{Region: "us-east-1", AWSProfile: "bedrock"}, home)
+	if err != nil {
+		t.Fatalf("bedrockFiles() error = %v", err)
+	}
+	got := volumeFileMap(files)
+	if !strings.Contains(got[providerDataDir+"/aws/credentials"], "[bedrock]\naws_access_key_id = AKIAEXAMPLE") {
+		t.Errorf("credentials = %q, want generated bedrock profile", got[providerDataDir+"/aws/credentials"])
+	}
+	if got[providerDataDir+"/bedrock.env"] != "AWS_PROFILE=bedrock\nAWS_REGION=us-east-1\n" {
+		t.Errorf("bedrock.env = %q", got[providerDataDir+"/bedrock.env"])
+	}
+
+	// Host files take priority over environment keys
+	if err := os.MkdirAll(filepath.Join(home, ".aws"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".aws", "config"), []byte("[default]\nregion = eu-west-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, map[string]string{"AWS_REGION": "eu-west-1"})
+	files, err = bedrockFiles(providerOptions{}, home)
+	if err != nil {
+		t.Fatalf("bedrockFiles() error = %v", err)
+	}
+	got = volumeFileMap(files)
+	if got[providerDataDir+"/aws/config"] != "[default]\nregion = eu-west-1\n" {
+		t.Errorf("aws/config = %q, want host file", got[providerDataDir+"/aws/config"])
+	}
+	if _, ok := got[providerDataDir+"/aws/credentials"]; ok {
+		t.Error("bedrockFiles() generated credentials although host files exist")
+	}
+
+	// Only the selected profile and the profiles it depends on are stored
+	config := `[default]
+region = eu-west-1
+
+[profile bedrock]
+role_arn = arn:aws:iam::123456789012:role/bedrock
+source_profile = base
+
+[profile base]
+region = us-east-1
+
+[profile production]
+region = us-west-2
+`
+	credentials := `[default]
+aws_access_key_id = AKIADEFAULT
+aws_secret_access_key = default-secret
+
+[base]
+aws_access_key_id = AKIABASE
+aws_secret_access_key = base-secret
+
+[production]
+aws_access_key_id = AKIAPRODUCTION
+aws_secret_access_key = production-secret
+`
+	if err := os.WriteFile(filepath.Join(home, ".aws", "config"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".aws", "credentials"), []byte(credentials), 0600); err != nil {
+		t.Fatal(err)
+	}
+	files, err = bedrockFiles(providerOptions{AWSProfile: "bedrock"}, home)
+	if err != nil {
+		t.Fatalf("bedrockFiles() error = %v", err)
+	}
+	got = volumeFileMap(files)
+	wantConfig := "[profile bedrock]\nrole_arn = arn:aws:iam::123456789012:role/bedrock\nsource_profile = base\n\n[profile base]\nregion = us-east-1\n"
+	if got[providerDataDir+"/aws/config"] != wantConfig {
+		t.Errorf("aws/config = %q, want %q", got[providerDataDir+"/aws/config"], wantConfig)
+	}
+	wantCredentials := "[base]\naws_access_key_id = AKIABASE\naws_secret_access_key = base-secret\n"
+	if got[providerDataDir+"/aws/credentials"] != wantCredentials {
+		t.Errorf("aws/credentials = %q, want %q", got[providerDataDir+"/aws/credentials"], wantCredentials)
+	}
+
+	// A profile in neither file is an error without environment keys
+	setEnv(t, map[string]string{"AWS_ACCESS_KEY_ID": "", "AWS_SECRET_ACCESS_KEY": ""})
+	if _, err := bedrockFiles(providerOptions{AWSProfile: "missing"}, home); err == nil {
+		t.Error("bedrockFiles() expected error for an unknown profile")
+	}
+}
+
+func TestVertexFiles(t *testing.T) {
+	home := t.TempDir()
+	setEnv(t, map[string]string{
+		"GOOGLE_APPLICATION_CREDENTIALS": "", "ANTHROPIC_VERTEX_PROJECT_ID": "",
+		"GOOGLE_CLOUD_PROJECT": "", "CLOUD_ML_REGION": "",
+	})
+
+	if _, err := vertexFiles(providerOptions{}, home); err == nil {
+		t.Error("vertexFiles() expected error without ADC file")
+	}
+
+	adcDir := filepath.Join(home, ".config", "gcloud")
+	if err := os.MkdirAll(adcDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	adc := `{"type": "authorized_user", "quota_project_id": "adc-project"}`
+	if err := os.WriteFile(filepath.Join(adcDir, "application_default_credentials.json"), []byte(adc), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := vertexFiles(providerOptions{}, home)
+	if err != nil {
+		t.Fatalf("vertexFiles() error = %v", err)
+	}
+	got := volumeFileMap(files)
+	if got[providerDataDir+"/gcloud/adc.json"] != adc {
+		t.Errorf("adc.json = %q, want host ADC file", got[providerDataDir+"/gcloud/adc.json"])
+	}
+	want := "ANTHROPIC_VERTEX_PROJECT_ID=adc-project\nCLOUD_ML_REGION=" + defaultVertexRegion + "\n"
+	if got[providerDataDir+"/vertex.env"] != want {
+		t.Errorf("vertex.env = %q, want %q", got[providerDataDir+"/vertex.env"], want)
+	}
+
+	files, err = vertexFiles(providerOptions{VertexProject: "flag-project", Region: "europe-west1"}, home)
+	if err != nil {
+		t.Fatalf("vertexFiles() error = %v", err)
+	}
+	if env := volumeFileMap(files)[providerDataDir+"/vertex.env"]; env != "ANTHROPIC_VERTEX_PROJECT_ID=flag-project\nCLOUD_ML_REGION=europe-west1\n" {
+		t.Errorf("vertex.env with flags = %q", env)
+	}
+}
+
+func TestRunAuthProviderRejectsInvalidAPIKey(t *testing.T) {
+	original := runContainerWithInput
+	defer func() { runContainerWithInput = original }()
+
+	called := false
+	runContainerWithInput = func(_ string, _ []string, _ io.Reader) error {
+		called = true
+		return nil
+	}
+
+	err := runAuthProvider(authTarget{UID: 1000}, ProviderAPIKey, providerOptions{}, strings.NewReader("sk-ant-oat01-wrong-kind\n"), true)
+	if err == nil {
+		t.Error("runAuthProvider() expected error for invalid API key")
+	}
+	if called {
+		t.Error("runAuthProvider() started a container for an invalid API key")
+	}
+}
+
+func TestAtomicWriteScriptCreatesParentDir(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	target := filepath.Join(t.TempDir(), ".cc-sandbox", "aws", "credentials")
+	cmd := exec.Command("sh", "-c", atomicWriteScript, "sh", target)
+	cmd.Stdin = strings.NewReader("[default]\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("atomicWriteScript failed: %v: %s", err, out)
+	}
+
+	info, err := os.Stat(filepath.Dir(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("parent dir mode = %o, want 700", info.Mode().Perm())
+	}
+}
+
+func TestBuildContainerArgsProvider(t *testing.T) {
+	cfg := &Config{Workdir: t.TempDir(), Provider: ProviderBedrock}
+	argsStr := joinArgs(buildContainerArgs(cfg, "docker", "test-image", nil))
+	if !contains(argsStr, "CC_SANDBOX_PROVIDER=bedrock") {
+		t.Errorf("buildContainerArgs() missing provider override: %s", argsStr)
+	}
+
+	cfg.Provider = ""
+	argsStr = joinArgs(buildContainerArgs(cfg, "docker", "test-image", nil))
+	if contains(argsStr, "CC_SANDBOX_PROVIDER") {
+		t.Errorf("buildContainerArgs() passes a provider without --provider: %s", argsStr)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Named sandboxes outlive the cc-sandbox process that starts them, so their
+// proxies (the Docker socket proxy, the network allowlist proxy) are served
+// by a hidden helper command running in the background. The helper follows
+// the container and exits when it stops; attach starts it again if needed.
+
+// proxySocketAlive reports whether a proxy is serving socket.
+func proxySocketAlive(socket string) bool {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+// ensureProxyHelper restarts the helper serving socket if it is not running.
+func ensureProxyHelper(command, containerRuntime, container, socket string, config any) error {
+	if proxySocketAlive(socket) {
+		return nil
+	}
+	// The directory is on a tmpfs that may have been cleared by a reboot
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return fmt.Errorf("failed to create proxy directory: %w", err)
+	}
+	return spawnProxyHelper(command, containerRuntime, container, socket, config)
+}
+
+// spawnProxyHelper starts `cc-sandbox <command>` in the background for
+// container and waits for it to serve socket. The helper's output goes to
+// proxy.log next to the socket.
+func spawnProxyHelper(command, containerRuntime, container, socket string, config any) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", command, err)
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(filepath.Join(filepath.Dir(socket), "proxy.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", command, err)
+	}
+	defer func() { _ = logFile.Close() }()
+
+	cmd := exec.Command(exe, command, "--runtime", containerRuntime, "--container", container, "--config", string(configJSON))
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	// Closing the terminal or pressing Ctrl-C must not stop the proxy
+	detachFromTerminalSignals(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", command, err)
+	}
+	_ = cmd.Process.Release()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if proxySocketAlive(socket) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s did not start, see %s", command, logFile.Name())
+}
+
+// watchSandboxContainer returns once container has stopped, or has not come
+// up within a minute.
+func watchSandboxContainer(containerRuntime, container string) {
+	deadline := time.Now().Add(time.Minute)
+	seenRunning := false
+	for {
+		time.Sleep(2 * time.Second)
+		out, err := runContainerOutputQuiet(containerRuntime, []string{"container", "inspect", "--format", "{{.State.Running}}", container})
+		if err == nil && strings.TrimSpace(string(out)) == "true" {
+			seenRunning = true
+			continue
+		}
+		if seenRunning || time.Now().After(deadline) {
+			return
+		}
+	}
+}
+
+// newProxyHelperCmd creates a hidden helper command. parse reads the --config
+// JSON and returns the proxy's directory and a function that starts serving.
+func newProxyHelperCmd(use, short string, parse func(configJSON string) (string, func() (io.Closer, error), error)) *cobra.Command {
+	var configJSON, runtimeFlag, container string
+
+	cmd := &cobra.Command{
+		Use:    use,
+		Short:  short,
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			dir, listen, err := parse(configJSON)
+			if err != nil {
+				return fmt.Errorf("invalid --config: %w", err)
+			}
+
+			// One helper per proxy; a second one has nothing to do
+			lockFile, err := os.OpenFile(filepath.Join(dir, "proxy.lock"), os.O_CREATE|os.O_RDWR, 0600)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = lockFile.Close() }()
+			if !tryLockFile(lockFile) {
+				return nil
+			}
+
+			proxy, err := listen()
+			if err != nil {
+				return err
+			}
+			defer func() { _ = proxy.Close() }()
+			watchSandboxContainer(runtimeFlag, container)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&configJSON, "config", "", "Proxy config as JSON")
+	cmd.Flags().StringVar(&runtimeFlag, "runtime", "docker", "Container runtime of the sandbox")
+	cmd.Flags().StringVar(&container, "container", "", "Container whose lifetime the proxy follows")
+
+	return cmd
+}
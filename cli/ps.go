@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// containerInspectFormat prints "id<TAB>name<TAB>status<TAB>labels as JSON"
+// for a container. Docker and podman both understand it.
+const containerInspectFormat = "{{.Id}}\t{{.Name}}\t{{.State.Status}}\t{{json .Config.Labels}}"
+
+// sandboxEntry is one row of `cc-sandbox ps` output.
+type sandboxEntry struct {
+	ID        string     `json:"id"`
+	Container string     `json:"container"`
+	Name      string     `json:"name,omitempty"` // Set for sandboxes started with `cc-sandbox start`
+	Runtime   string     `json:"runtime"`
+	Status    string     `json:"status"`
+	Workdir   string     `json:"workdir"`
+	Repo      string     `json:"repo,omitempty"` // Set for sandboxes started with --repo
+	Image     string     `json:"image"`
+	Version   string     `json:"version"`
+	Profile   string     `json:"profile,omitempty"`
+	Started   *time.Time `json:"started,omitempty"`
+	ReadOnly  bool       `json:"read_only,omitempty"` // Workspace mounted read-only
+}
+
+// newPsCmd creates the ps subcommand.
+func newPsCmd() *cobra.Command {
+	var runtimeFlag string
+	var all, jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "ps",
+		Short: "List sandboxes with their workspace, image and uptime",
+		Long: `List the containers started by cc-sandbox in docker and podman.
+
+Examples:
+  cc-sandbox ps                  # Running sandboxes
+  cc-sandbox ps -a               # Include stopped named sandboxes
+  cc-sandbox ps --json           # Machine-readable output
+  cc-sandbox ps --runtime podman # Only one runtime`,
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			entries, err := listSandboxes(psRuntimes(runtimeFlag), all)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return printSandboxesJSON(os.Stdout, entries)
+			}
+			return printSandboxesTable(os.Stdout, entries, time.Now())
+		},
+	}
+
+	cmd.Flags().StringVar(&runtimeFlag, "runtime", "auto", "Container runtime: auto (all installed), docker, or podman")
+	cmd.Flags().BoolVarP(&all, "all", "a", false, "Include stopped sandboxes")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+
+	return cmd
+}
+
+// psRuntimes returns the runtimes to list sandboxes from.
+// With "auto" every installed runtime is queried.
+func psRuntimes(runtimeFlag string) []string {
+	if runtimeFlag != "" && runtimeFlag != "auto" {
+		return []string{runtimeFlag}
+	}
+	var runtimes []string
+	if isDockerAvailable() {
+		runtimes = append(runtimes, RuntimeDocker)
+	}
+	if isPodmanAvailable() {
+		runtimes = append(runtimes, RuntimePodman)
+	}
+	return runtimes
+}
+
+// listSandboxes returns the cc-sandbox containers in each runtime.
+// A runtime that fails (e.g. its daemon is not running) is reported as a
+// warning, unless no runtime could be queried at all.
+func listSandboxes(runtimes []string, all bool) ([]sandboxEntry, error) {
+	var entries []sandboxEntry
+	seen := make(map[string]bool)
+	var lastErr error
+	queried := 0
+
+	for _, rt := range runtimes {
+		found, err := listRuntimeSandboxes(rt, all)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			lastErr = err
+			continue
+		}
+		queried++
+		// podman-docker makes both CLIs report the same containers
+		for _, e := range found {
+			if !seen[e.ID] {
+				seen[e.ID] = true
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	if queried == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return entries, nil
+}
+
+// listRuntimeSandboxes returns the cc-sandbox containers in one runtime.
+func listRuntimeSandboxes(containerRuntime string, all bool) ([]sandboxEntry, error) {
+	args := []string{"ps", "-q", "--no-trunc", "--filter", "label=" + labelVersion}
+	if all {
+		args = append(args, "-a")
+	}
+	output, err := runContainerOutputQuiet(containerRuntime, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s containers: %w", containerRuntime, err)
+	}
+	ids := strings.Fields(string(output))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	inspectArgs := append([]string{"container", "inspect", "--format", containerInspectFormat}, ids...)
+	output, err = runContainerOutputQuiet(containerRuntime, inspectArgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect %s containers: %w", containerRuntime, err)
+	}
+	return parseSandboxEntries(string(output), containerRuntime), nil
+}
+
+// parseSandboxEntries parses containerInspectFormat output.
+// Malformed lines are skipped.
+func parseSandboxEntries(output, containerRuntime string) []sandboxEntry {
+	var entries []sandboxEntry
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "\t", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		var labels map[string]string
+		if err := json.Unmarshal([]byte(parts[3]), &labels); err != nil {
+			continue
+		}
+
+		e := sandboxEntry{
+			ID:        parts[0],
+			Container: strings.TrimPrefix(parts[1], "/"), // docker prefixes names with a slash
+			Name:      labels[labelName],
+			Runtime:   containerRuntime,
+			Status:    parts[2],
+			Workdir:   labels[labelWorkdir],
+			Repo:      labels[labelRepo],
+			Image:     labels[labelImage],
+			Version:   labels[labelVersion],
+			Profile:   labels[labelProfile],
+			ReadOnly:  labels[labelReadOnly] == "true",
+		}
+		if started, err := time.Parse(time.RFC3339, labels[labelStarted]); err == nil {
+			e.Started = &started
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func printSandboxesJSON(w io.Writer, entries []sandboxEntry) error {
+	if entries == nil {
+		entries = []sandboxEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+func printSandboxesTable(w io.Writer, entries []sandboxEntry, now time.Time) error {
+	if len(entries) == 0 {
+		_, err := fmt.Fprintln(w, "No sandboxes found.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tRUNTIME\tSTATUS\tUPTIME\tIMAGE\tPROFILE\tWORKDIR")
+	for _, e := range entries {
+		name := e.Name
+		if name == "" {
+			name = e.Container
+		}
+		profile := e.Profile
+		if profile == "" {
+			profile = "-"
+		}
+		workdir := e.Workdir
+		if workdir == "" {
+			workdir = e.Repo
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			name, e.Runtime, e.Status, formatUptime(e, now), e.Image, profile, workdir)
+	}
+	return tw.Flush()
+}
+
+// formatUptime describes how long a running sandbox has been up.
+func formatUptime(e sandboxEntry, now time.Time) string {
+	if e.Status != "running" || e.Started == nil {
+		return "-"
+	}
+	d := now.Sub(*e.Started)
+	switch {
+	case d < time.Minute:
+		return "<1m"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
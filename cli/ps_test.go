@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const psInspectFixture = `0123abcd	/cc-sandbox-api	running	{"cc-sandbox.image":"cc-sandbox:docker","cc-sandbox.name":"api","cc-sandbox.profile":"work","cc-sandbox.started":"2026-03-01T10:00:00Z","cc-sandbox.version":"1.6.0","cc-sandbox.workdir":"/src/api"}
+4567efgh	/eager_turing	running	{"cc-sandbox.image":"cc-sandbox:base","cc-sandbox.started":"2026-03-01T11:59:30Z","cc-sandbox.version":"1.6.0","cc-sandbox.workdir":"/src/web"}
+not a valid line
+`
+
+func TestParseSandboxEntries(t *testing.T) {
+	entries := parseSandboxEntries(psInspectFixture, "docker")
+	if len(entries) != 2 {
+		t.Fatalf("parseSandboxEntries() returned %d entries, want 2", len(entries))
+	}
+
+	api := entries[0]
+	if api.Container != "cc-sandbox-api" || api.Name != "api" || api.Workdir != "/src/api" ||
+		api.Image != "cc-sandbox:docker" || api.Profile != "work" || api.Runtime != "docker" || api.Status != "running" {
+		t.Errorf("parseSandboxEntries()[0] = %+v", api)
+	}
+	if api.Started == nil || !api.Started.Equal(time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseSandboxEntries()[0].Started = %v", api.Started)
+	}
+	if entries[1].Name != "" || entries[1].Container != "eager_turing" {
+		t.Errorf("parseSandboxEntries()[1] = %+v, want an unnamed sandbox", entries[1])
+	}
+}
+
+func TestListSandboxes(t *testing.T) {
+	original := runContainerOutputQuiet
+	defer func() { runContainerOutputQuiet = original }()
+
+	runContainerOutputQuiet = func(containerRuntime string, args []string) ([]byte, error) {
+		if containerRuntime == "podman" {
+			return nil, errors.New("cannot connect")
+		}
+		if args[0] == "ps" {
+			return []byte("0123abcd\n4567efgh\n"), nil
+		}
+		return []byte(psInspectFixture), nil
+	}
+
+	// The failing runtime is only a warning
+	entries, err := listSandboxes([]string{"docker", "podman"}, false)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("listSandboxes() = %d entries, %v, want 2 entries", len(entries), err)
+	}
+
+	// The same containers seen through two CLIs are listed once
+	entries, err = listSandboxes([]string{"docker", "docker"}, false)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("listSandboxes() = %d entries, %v, want duplicates removed", len(entries), err)
+	}
+
+	if _, err := listSandboxes([]string{"podman"}, false); err == nil {
+		t.Error("listSandboxes() = nil error when no runtime could be queried")
+	}
+}
+
+func TestPrintSandboxes(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	entries := parseSandboxEntries(psInspectFixture, "docker")
+
+	var buf bytes.Buffer
+	if err := printSandboxesTable(&buf, entries, now); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"NAME", "api", "eager_turing", "2h0m", "<1m", "/src/api", "work"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printSandboxesTable() missing %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	if err := printSandboxesJSON(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []sandboxEntry
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded == nil {
+		t.Errorf("printSandboxesJSON(nil) = %q, want an empty JSON array", buf.String())
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	now := time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+
+	tests := []struct {
+		entry sandboxEntry
+		want  string
+	}{
+		{sandboxEntry{Status: "running", Started: at(30 * time.Second)}, "<1m"},
+		{sandboxEntry{Status: "running", Started: at(42 * time.Minute)}, "42m"},
+		{sandboxEntry{Status: "running", Started: at(3*time.Hour + 5*time.Minute)}, "3h5m"},
+		{sandboxEntry{Status: "running", Started: at(50 * time.Hour)}, "2d2h"},
+		{sandboxEntry{Status: "exited", Started: at(time.Hour)}, "-"},
+		{sandboxEntry{Status: "running"}, "-"},
+	}
+
+	for _, tt := range tests {
+		if got := formatUptime(tt.entry, now); got != tt.want {
+			t.Errorf("formatUptime(%+v) = %q, want %q", tt.entry, got, tt.want)
+		}
+	}
+}
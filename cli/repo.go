@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// repoVolumePrefix starts the names of the volumes that --repo clones into.
+const repoVolumePrefix = "cc-sandbox-repo-"
+
+// Labels for --repo sandboxes. labelRepo replaces labelWorkdir on the
+// container; labelRepoVolume lets `cc-sandbox rm` delete a named sandbox's clone.
+const (
+	labelRepo       = "cc-sandbox.repo"
+	labelRepoVolume = "cc-sandbox.repo-volume"
+)
+
+// repoPushScript pushes the HEAD of the clone to branch $1 of origin.
+// Uncommitted changes are not pushed.
+const repoPushScript = `set -e
+cd /workspace
+if [ -n "$(git status --porcelain)" ]; then
+    echo "[cc-sandbox] Warning: uncommitted changes are not pushed" >&2
+fi
+git push origin "HEAD:refs/heads/$1"`
+
+// validateWorkspaceOptions rejects combinations of the options that choose
+// what is mounted at /workspace.
+func validateWorkspaceOptions(cfg *Config) error {
+	if cfg.Repo == "" {
+		if cfg.RepoBranch != "" || cfg.PushBranch != "" {
+			return errors.New("--branch and --push-branch require --repo")
+		}
+		return nil
+	}
+
+	switch {
+	case cfg.Isolated:
+		return errors.New("--repo can't be combined with --isolated")
+	case cfg.Worktree != "":
+		return errors.New("--repo can't be combined with --worktree")
+	case cfg.ReadOnlyWorkspace:
+		return errors.New("--repo can't be combined with --read-only-workspace")
+	case cfg.PushBranch != "" && cfg.Name != "":
+		return errors.New("--push-branch pushes when the session ends, so it can't be used with start; push from the sandbox with 'cc-sandbox exec'")
+	case cfg.DiscardClone && cfg.Name != "":
+		return errors.New("--discard-clone can't be used with start; a named sandbox keeps its clone until 'cc-sandbox rm'")
+	}
+	for flag, branch := range map[string]string{"--branch": cfg.RepoBranch, "--push-branch": cfg.PushBranch} {
+		if strings.HasPrefix(branch, "-") || strings.ContainsAny(branch, " \t\n") {
+			return fmt.Errorf("invalid %s %q", flag, branch)
+		}
+	}
+	return validateRepoURL(cfg.Repo)
+}
+
+// validateRepoURL checks that a --repo URL carries no credentials. They would
+// be visible in the container's environment; the sandbox authenticates with
+// its gh credentials or SSH keys instead.
+func validateRepoURL(repo string) error {
+	if strings.HasPrefix(repo, "-") {
+		return fmt.Errorf("invalid repository URL %q", repo)
+	}
+	if !strings.Contains(repo, "://") {
+		return nil // scp-like SSH syntax, e.g. git@github.com:org/svc.git
+	}
+	u, err := url.Parse(repo)
+	if err != nil {
+		return fmt.Errorf("invalid repository URL %q: %w", repo, err)
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		return errors.New("the repository URL must not contain a password or token; authenticate with gh (GH_TOKEN) or --ssh instead")
+	}
+	return nil
+}
+
+// createRepoVolume creates the volume that a --repo sandbox clones into and
+// sets cfg.RepoVolume. The entrypoint clones on the first start.
+func createRepoVolume(cfg *Config, containerRuntime string) error {
+	cfg.RepoVolume = repoVolumePrefix + newSessionID(time.Now())
+	args := []string{"volume", "create",
+		"--label", labelRepo + "=" + cfg.Repo,
+		"--label", labelStarted + "=" + time.Now().UTC().Format(time.RFC3339),
+		cfg.RepoVolume,
+	}
+	if _, err := runContainerOutput(containerRuntime, args); err != nil {
+		return fmt.Errorf("failed to create volume %s: %w", cfg.RepoVolume, err)
+	}
+	return nil
+}
+
+// repoWorkspaceArgs mounts the clone volume at /workspace and tells the
+// entrypoint what to clone into it.
+func repoWorkspaceArgs(cfg *Config) []string {
+	args := []string{
+		"-v", cfg.RepoVolume + ":/workspace",
+		"-e", "CC_SANDBOX_REPO=" + cfg.Repo,
+	}
+	if cfg.RepoBranch != "" {
+		args = append(args, "-e", "CC_SANDBOX_REPO_BRANCH="+cfg.RepoBranch)
+	}
+	return args
+}
+
+// removeRepoVolume deletes the clone of a --repo sandbox.
+func removeRepoVolume(containerRuntime, volume string) {
+	if !strings.HasPrefix(volume, repoVolumePrefix) {
+		return
+	}
+	if _, err := runContainerOutputQuiet(containerRuntime, []string{"volume", "rm", "-f", volume}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove volume %s: %v\n", volume, err)
+	}
+}
+
+// finishRepoSession pushes the result of a --repo session that exited with
+// sessionErr, if requested and the session succeeded. The clone is removed
+// once the session and push succeeded; otherwise it is kept so no work is
+// lost, unless cfg.DiscardClone is set. Returns sessionErr, or the push error.
+// Output goes to w.
+func finishRepoSession(cfg *Config, containerRuntime, imageName string, sessionErr error, w io.Writer) error {
+	err := sessionErr
+	switch {
+	case cfg.PushBranch == "":
+	case sessionErr != nil:
+		fmt.Fprintf(w, "[cc-sandbox] Session failed, not pushing %s\n", cfg.PushBranch)
+	default:
+		err = pushRepoResult(cfg, containerRuntime, imageName, w)
+	}
+	if err != nil && !cfg.DiscardClone {
+		fmt.Fprintf(w, "[cc-sandbox] Kept the clone in volume %s; remove it with '%s volume rm %s'\n", cfg.RepoVolume, containerRuntime, cfg.RepoVolume)
+		return err
+	}
+	removeRepoVolume(containerRuntime, cfg.RepoVolume)
+	return err
+}
+
+// pushRepoResult pushes the HEAD of a finished --repo session to
+// cfg.PushBranch. It runs in a fresh container with the session's mounts and
+// credentials, since the session container is gone.
+func pushRepoResult(cfg *Config, containerRuntime, imageName string, w io.Writer) error {
+	pushCfg := *cfg
+	pushCfg.Interactive = false
+	pushCfg.CIDFile = ""
+
+	args := buildContainerArgs(&pushCfg, containerRuntime, imageName, []string{"bash", "-c", repoPushScript, "bash", cfg.PushBranch})
+	cmd := exec.Command(containerRuntime, args...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to push %s: %w", cfg.PushBranch, err)
+	}
+	fmt.Fprintf(w, "Pushed the result to branch %s of %s\n", cfg.PushBranch, cfg.Repo)
+	return nil
+}
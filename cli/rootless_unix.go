@@ -23,7 +23,7 @@ var (
 	dockerInfoOnce  sync.Once
 	dockerInfoCache dockerInfo
 
-	// Runtime availability (parallel detection)
+	// Runtime availability
 	runtimeDetectionOnce  sync.Once
 	podmanAvailableResult bool
 	dockerAvailableResult bool
@@ -50,25 +50,14 @@ func getDockerInfo() dockerInfo {
 	return dockerInfoCache
 }
 
-// detectRuntimeAvailability checks docker and podman availability in parallel.
+// detectRuntimeAvailability checks whether docker and podman are installed.
+// A PATH lookup is enough to pick a runtime and avoids starting either CLI.
 func detectRuntimeAvailability() {
 	runtimeDetectionOnce.Do(func() {
-		var wg sync.WaitGroup
-		wg.Add(2)
-
-		go func() {
-			defer wg.Done()
-			cmd := exec.Command("docker", "--version")
-			dockerAvailableResult = cmd.Run() == nil
-		}()
-
-		go func() {
-			defer wg.Done()
-			cmd := exec.Command("podman", "--version")
-			podmanAvailableResult = cmd.Run() == nil
-		}()
-
-		wg.Wait()
+		_, err := exec.LookPath("docker")
+		dockerAvailableResult = err == nil
+		_, err = exec.LookPath("podman")
+		podmanAvailableResult = err == nil
 	})
 }
 
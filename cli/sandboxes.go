@@ -0,0 +1,534 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// sandboxContainerPrefix starts the container name of every persistent
+// sandbox, so sandbox names can't clash with other containers.
+const sandboxContainerPrefix = "cc-sandbox-"
+
+// Labels set on sandbox containers. Every container gets the version,
+// workdir, image and start time; the others only when they apply.
+const (
+	labelVersion    = "cc-sandbox.version"
+	labelWorkdir    = "cc-sandbox.workdir"
+	labelImage      = "cc-sandbox.image"
+	labelProfile    = "cc-sandbox.profile"
+	labelStarted    = "cc-sandbox.started"
+	labelName       = "cc-sandbox.name"
+	labelSecretsDir = "cc-sandbox.secrets-dir"
+	labelReadOnly   = "cc-sandbox.read-only"
+)
+
+// sandboxInspectFormat prints what cc-sandbox needs to know about a container
+// as "running|name label|secrets dir label|repo volume label|container ID".
+const sandboxInspectFormat = `{{.State.Running}}|{{index .Config.Labels "` + labelName + `"}}|{{index .Config.Labels "` + labelSecretsDir + `"}}|{{index .Config.Labels "` + labelRepoVolume + `"}}|{{.Id}}`
+
+// containerIDPattern matches a full container ID.
+var containerIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// sandboxNamePattern restricts sandbox names to characters valid in container names.
+var sandboxNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,62}$`)
+
+// sandboxInfo is the state of a persistent sandbox container.
+type sandboxInfo struct {
+	Running    bool
+	SecretsDir string // Secrets directory kept for restarts, if any
+	RepoVolume string // Volume holding the clone of a --repo sandbox, if any
+	ID         string // Container ID, which names the sandbox's state file
+}
+
+// sandboxState is what the host keeps about a named sandbox: the configs its
+// proxies are restarted with. It is not stored in container labels, because
+// anything that can create containers, like the agent through the Docker
+// proxy, could set those and have attach start a proxy with its own policy.
+type sandboxState struct {
+	DockerProxy  *dockerProxyConfig  `json:"docker_proxy,omitempty"`
+	NetworkProxy *networkProxyConfig `json:"network_proxy,omitempty"`
+}
+
+// sandboxStatePath returns the state file of the sandbox container id.
+func sandboxStatePath(id string) string {
+	return filepath.Join(dataBaseDir(), "sandboxes", id+".json")
+}
+
+// writeSandboxState stores the state of the sandbox container id.
+func writeSandboxState(id string, state sandboxState) error {
+	if !containerIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid container ID %q", id)
+	}
+	path := sandboxStatePath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to save sandbox state: %w", err)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save sandbox state: %w", err)
+	}
+	return nil
+}
+
+// loadSandboxState reads the state of the sandbox container id. A sandbox
+// without a state file has no proxies.
+func loadSandboxState(id string) (sandboxState, error) {
+	var state sandboxState
+	if !containerIDPattern.MatchString(id) {
+		return state, nil
+	}
+	data, err := os.ReadFile(sandboxStatePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read sandbox state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("invalid sandbox state %s: %w", sandboxStatePath(id), err)
+	}
+	return state, nil
+}
+
+// removeSandboxState deletes the state file of the sandbox container id.
+func removeSandboxState(id string) {
+	if containerIDPattern.MatchString(id) {
+		_ = os.Remove(sandboxStatePath(id))
+	}
+}
+
+// sandboxStateFor returns the state to keep for a sandbox about to start.
+func sandboxStateFor(cfg *Config) sandboxState {
+	var state sandboxState
+	if cfg.DockerProxyDir != "" {
+		proxyConfig := dockerProxyConfigFor(cfg)
+		state.DockerProxy = &proxyConfig
+	}
+	if cfg.NetworkProxyDir != "" {
+		proxyConfig := networkProxyConfigFor(cfg)
+		state.NetworkProxy = &proxyConfig
+	}
+	return state
+}
+
+// validateSandboxName checks that a sandbox name can be used in a container name.
+func validateSandboxName(name string) error {
+	if name == "" {
+		return errors.New("sandbox name is required")
+	}
+	if !sandboxNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid sandbox name %q: use letters, digits, '-', '_' and '.'", name)
+	}
+	return nil
+}
+
+// sandboxContainerName returns the container name of a persistent sandbox.
+func sandboxContainerName(name string) string {
+	return sandboxContainerPrefix + name
+}
+
+// containerLabelArgs returns the --label flags that let `cc-sandbox ps` and the
+// sandbox commands identify a container started at the given time.
+func containerLabelArgs(cfg *Config, imageName string, started time.Time) []string {
+	labels := []string{
+		labelVersion + "=" + version,
+		labelImage + "=" + imageName,
+		labelStarted + "=" + started.UTC().Format(time.RFC3339),
+	}
+	// A --repo sandbox has no host workdir
+	if cfg.Repo != "" {
+		labels = append(labels, labelRepo+"="+cfg.Repo)
+	} else {
+		labels = append(labels, labelWorkdir+"="+cfg.Workdir)
+	}
+	if cfg.Profile != "" {
+		labels = append(labels, labelProfile+"="+cfg.Profile)
+	}
+	if cfg.ReadOnlyWorkspace || cfg.Isolated {
+		labels = append(labels, labelReadOnly+"=true")
+	}
+	if cfg.Session != "" {
+		labels = append(labels, labelSession+"="+cfg.Session)
+	}
+	if cfg.Name != "" {
+		labels = append(labels, labelName+"="+cfg.Name)
+		if cfg.SecretsDir != "" {
+			labels = append(labels, labelSecretsDir+"="+cfg.SecretsDir)
+		}
+		if cfg.RepoVolume != "" {
+			labels = append(labels, labelRepoVolume+"="+cfg.RepoVolume)
+		}
+	}
+
+	args := make([]string, 0, 2*len(labels))
+	for _, label := range labels {
+		args = append(args, "--label", label)
+	}
+	return args
+}
+
+// newStartCmd creates the start subcommand that launches a persistent sandbox.
+func newStartCmd() *cobra.Command {
+	cfg := &Config{}
+	var rootFlag string
+
+	cmd := &cobra.Command{
+		Use:   "start --name <name> [flags] [command] [args...]",
+		Short: "Start a named sandbox that keeps running in the background",
+		Long: `Start a detached sandbox that survives closing the terminal.
+It gets the same mounts, credentials and UID mapping as a regular run.
+Reconnect with 'cc-sandbox attach <name>'; detach again with Ctrl-P Ctrl-Q.
+
+Examples:
+  cc-sandbox start --name api-refactor claude
+  cc-sandbox start --name api-refactor -i docker -w ~/src/api claude -c
+  cc-sandbox attach api-refactor
+  cc-sandbox stop api-refactor
+  cc-sandbox rm api-refactor`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg.Root = parseRootFlag(rootFlag)
+			if err := validateSandboxName(cfg.Name); err != nil {
+				return err
+			}
+			return startSandbox(cfg, args, cmd.Flags().Changed)
+		},
+	}
+
+	addSandboxFlags(cmd, cfg, &rootFlag)
+	cmd.Flags().StringVar(&cfg.Name, "name", "", "Sandbox name (required)")
+	_ = cmd.MarkFlagRequired("name")
+	// Flags after the command belong to it (e.g. claude -p)
+	cmd.Flags().SetInterspersed(false)
+
+	return cmd
+}
+
+// newAttachCmd creates the attach subcommand.
+func newAttachCmd() *cobra.Command {
+	var runtimeFlag string
+
+	cmd := &cobra.Command{
+		Use:   "attach <name>",
+		Short: "Reconnect to a named sandbox",
+		Long: `Attach the terminal to a named sandbox started with 'cc-sandbox start'.
+A stopped sandbox is started again first. Detach with Ctrl-P Ctrl-Q.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runAttach(detectRuntime(&Config{Runtime: runtimeFlag}), args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&runtimeFlag, "runtime", "auto", "Container runtime: auto, docker, or podman")
+
+	return cmd
+}
+
+// newStopCmd creates the stop subcommand.
+func newStopCmd() *cobra.Command {
+	var runtimeFlag string
+
+	cmd := &cobra.Command{
+		Use:   "stop <name> [name...]",
+		Short: "Stop named sandboxes",
+		Long:  `Stop named sandboxes. They keep their state and can be resumed with 'cc-sandbox attach'.`,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			containerRuntime := detectRuntime(&Config{Runtime: runtimeFlag})
+			for _, name := range args {
+				if err := runStop(containerRuntime, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&runtimeFlag, "runtime", "auto", "Container runtime: auto, docker, or podman")
+
+	return cmd
+}
+
+// newRmCmd creates the rm subcommand.
+func newRmCmd() *cobra.Command {
+	var runtimeFlag string
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "rm <name> [name...]",
+		Short: "Remove named sandboxes",
+		Long: `Remove named sandboxes and the secrets kept for them.
+Running sandboxes must be stopped first, or removed with --force.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			containerRuntime := detectRuntime(&Config{Runtime: runtimeFlag})
+			for _, name := range args {
+				if err := runRm(containerRuntime, name, force); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&runtimeFlag, "runtime", "auto", "Container runtime: auto, docker, or podman")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Stop and remove running sandboxes")
+
+	return cmd
+}
+
+// startSandbox launches a detached, labeled sandbox named cfg.Name.
+func startSandbox(cfg *Config, args []string, flagChanged func(string) bool) error {
+	// A named sandbox outlives the command, so nothing would enforce a
+	// timeout; one from a config file is ignored
+	if flagChanged("timeout") {
+		return errors.New("--timeout can't be used with start; stop the sandbox with 'cc-sandbox stop'")
+	}
+
+	timer := newPhaseTimer(cfg.Timings)
+	defer timer.report(os.Stderr)
+
+	runtime, imageName, err := prepareLaunch(cfg, flagChanged, timer)
+	if err != nil {
+		return err
+	}
+
+	if _, err := inspectSandbox(runtime, cfg.Name); err == nil {
+		return fmt.Errorf("sandbox %s already exists (use 'cc-sandbox attach %s' or 'cc-sandbox rm %s')", cfg.Name, cfg.Name, cfg.Name)
+	}
+
+	// The lock file only covers the launch; once running, the container's
+	// workdir label holds the workspace
+	lock, err := lockWorkspace(cfg, runtime)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	timer.mark("lock")
+
+	// The entrypoint reads secrets again whenever the sandbox restarts, so the
+	// directory is kept until `cc-sandbox rm`
+	started := false
+	if secrets := collectSecretEnv(cfg); len(secrets) > 0 {
+		dir, cleanup, err := writeSecretsDir(secrets)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if !started {
+				cleanup()
+			}
+		}()
+		cfg.SecretsDir = dir
+	}
+	timer.mark("secrets")
+
+	// The proxy processes follow the container and exit when it stops
+	if err := startDetachedDockerProxy(cfg, runtime); err != nil {
+		return err
+	}
+	timer.mark("docker-proxy")
+	if err := startDetachedNetworkProxy(cfg, runtime); err != nil {
+		removeDockerProxyDir(cfg.DockerProxyDir)
+		return err
+	}
+	timer.mark("network-proxy")
+
+	containerArgs := buildContainerArgs(cfg, runtime, imageName, args)
+	timer.mark("args")
+
+	// `run -d` prints the container ID, which names the state file
+	containerCmd := exec.Command(runtime, containerArgs...)
+	containerCmd.Stderr = os.Stderr
+	output, err := containerCmd.Output()
+	if err != nil {
+		if cfg.RepoVolume != "" {
+			removeRepoVolume(runtime, cfg.RepoVolume)
+		}
+		removeDockerProxyDir(cfg.DockerProxyDir)
+		removeNetworkProxyDir(cfg.NetworkProxyDir)
+		return fmt.Errorf("failed to start sandbox %s: %w", cfg.Name, err)
+	}
+	started = true
+	timer.mark("start")
+
+	fields := strings.Fields(string(output))
+	if len(fields) > 0 {
+		err = writeSandboxState(fields[len(fields)-1], sandboxStateFor(cfg))
+	} else {
+		err = errors.New("no container ID")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; attach won't restart the sandbox's proxies\n", err)
+	}
+
+	fmt.Printf("Started sandbox %s (container %s).\n", cfg.Name, sandboxContainerName(cfg.Name))
+	fmt.Printf("Attach with: cc-sandbox attach %s\n", cfg.Name)
+	if cfg.Session != "" {
+		printIsolatedHint(os.Stdout, cfg.Session)
+	}
+	return nil
+}
+
+// inspectSandbox returns the state of the named sandbox.
+// Containers not started by cc-sandbox start are reported as not found.
+func inspectSandbox(containerRuntime, name string) (sandboxInfo, error) {
+	output, err := runContainerOutputQuiet(containerRuntime, []string{
+		"container", "inspect", "--format", sandboxInspectFormat, sandboxContainerName(name),
+	})
+	if err != nil {
+		return sandboxInfo{}, fmt.Errorf("no sandbox named %s", name)
+	}
+	info, ok := parseSandboxInspect(string(output), name)
+	if !ok {
+		return sandboxInfo{}, fmt.Errorf("no sandbox named %s", name)
+	}
+	return info, nil
+}
+
+// parseSandboxInspect parses sandboxInspectFormat output for the named sandbox.
+// Returns false if the container does not carry the sandbox's name label.
+func parseSandboxInspect(output, name string) (sandboxInfo, bool) {
+	parts := strings.SplitN(strings.TrimSpace(output), "|", 5)
+	if len(parts) < 3 || parts[1] != name {
+		return sandboxInfo{}, false
+	}
+	info := sandboxInfo{Running: parts[0] == "true", SecretsDir: parts[2]}
+	if len(parts) >= 4 {
+		info.RepoVolume = parts[3]
+	}
+	if len(parts) == 5 {
+		info.ID = parts[4]
+	}
+	return info, true
+}
+
+// runContainerOutputQuiet runs a container command and returns its stdout,
+// discarding stderr. This is a variable to allow mocking in tests.
+var runContainerOutputQuiet = func(containerRuntime string, args []string) ([]byte, error) {
+	return exec.Command(containerRuntime, args...).Output()
+}
+
+// runAttach connects the terminal to a sandbox, starting it if it is stopped.
+func runAttach(containerRuntime, name string) error {
+	info, err := inspectSandbox(containerRuntime, name)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"attach", sandboxContainerName(name)}
+	if !info.Running {
+		// A tmpfs secrets directory is gone after a reboot; the bind mount
+		// needs it to exist
+		if info.SecretsDir != "" && !dirExists(info.SecretsDir) {
+			fmt.Fprintf(os.Stderr, "Warning: secrets for sandbox %s are gone; starting without them\n", name)
+			if err := os.MkdirAll(info.SecretsDir, 0700); err != nil {
+				return fmt.Errorf("failed to recreate secrets directory: %w", err)
+			}
+		}
+		args = []string{"start", "-ai", sandboxContainerName(name)}
+	}
+	state, err := loadSandboxState(info.ID)
+	if err != nil {
+		return err
+	}
+	if state.DockerProxy != nil {
+		if err := ensureDockerProxy(containerRuntime, name, *state.DockerProxy); err != nil {
+			return err
+		}
+	}
+	if state.NetworkProxy != nil {
+		if err := ensureNetworkProxy(containerRuntime, name, *state.NetworkProxy); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command(containerRuntime, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return runForwardingSignals(cmd)
+}
+
+// runStop stops a sandbox, keeping its container.
+func runStop(containerRuntime, name string) error {
+	if _, err := inspectSandbox(containerRuntime, name); err != nil {
+		return err
+	}
+	cmd := exec.Command(containerRuntime, "stop", sandboxContainerName(name))
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to stop sandbox %s: %w", name, err)
+	}
+	fmt.Printf("Stopped sandbox %s\n", name)
+	return nil
+}
+
+// runRm removes a sandbox container and its secrets directory.
+func runRm(containerRuntime, name string, force bool) error {
+	info, err := inspectSandbox(containerRuntime, name)
+	if err != nil {
+		return err
+	}
+	if info.Running && !force {
+		return fmt.Errorf("sandbox %s is running (stop it first or use --force)", name)
+	}
+
+	// -v also removes anonymous volumes, like the home dir of --hardened
+	args := []string{"rm", "-v"}
+	if force {
+		args = append(args, "-f")
+	}
+	args = append(args, sandboxContainerName(name))
+	cmd := exec.Command(containerRuntime, args...)
+	cmd.Stdout = io.Discard
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to remove sandbox %s: %w", name, err)
+	}
+
+	if err := removeSandboxSecrets(info.SecretsDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if info.RepoVolume != "" {
+		removeRepoVolume(containerRuntime, info.RepoVolume)
+	}
+	if state, err := loadSandboxState(info.ID); err == nil {
+		if state.DockerProxy != nil {
+			removeDockerProxyDir(state.DockerProxy.Dir)
+		}
+		if state.NetworkProxy != nil {
+			removeNetworkProxyDir(state.NetworkProxy.Dir)
+		}
+	}
+	removeSandboxState(info.ID)
+	fmt.Printf("Removed sandbox %s\n", name)
+	return nil
+}
+
+// removeSandboxSecrets deletes a sandbox's secrets directory. The path comes
+// from a container label, so only directories created by writeSecretsDir are removed.
+func removeSandboxSecrets(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if !filepath.IsAbs(dir) || !strings.HasPrefix(filepath.Base(dir), "cc-sandbox-secrets-") {
+		return fmt.Errorf("not removing unexpected secrets directory %s", dir)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove secrets directory %s: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateSandboxName(t *testing.T) {
+	for _, name := range []string{"api-refactor", "a", "feature_1.2"} {
+		if err := validateSandboxName(name); err != nil {
+			t.Errorf("validateSandboxName(%q) = %v, want nil", name, err)
+		}
+	}
+	for _, name := range []string{"", "-leading", "has space", "a/b", "x:y"} {
+		if err := validateSandboxName(name); err == nil {
+			t.Errorf("validateSandboxName(%q) = nil, want error", name)
+		}
+	}
+}
+
+func TestParseSandboxInspect(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   sandboxInfo
+		wantOK bool
+	}{
+		{"running", "true|api|\n", sandboxInfo{Running: true}, true},
+		{"stopped with secrets", "false|api|/run/user/1000/cc-sandbox-secrets-1", sandboxInfo{SecretsDir: "/run/user/1000/cc-sandbox-secrets-1"}, true},
+		{"repo sandbox", "true|api||cc-sandbox-repo-1", sandboxInfo{Running: true, RepoVolume: "cc-sandbox-repo-1"}, true},
+		{"container id", "false|api|||abc123\n", sandboxInfo{ID: "abc123"}, true},
+		{"other sandbox", "true|web|", sandboxInfo{}, false},
+		{"unlabeled container", "true||", sandboxInfo{}, false},
+		{"malformed", "true", sandboxInfo{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseSandboxInspect(tt.output, "api")
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parseSandboxInspect(%q) = %+v, %v, want %+v, %v", tt.output, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSandboxState(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	id := strings.Repeat("ab", 32)
+
+	state, err := loadSandboxState(id)
+	if err != nil || state.DockerProxy != nil || state.NetworkProxy != nil {
+		t.Fatalf("loadSandboxState() without a file = %+v, %v, want empty state", state, err)
+	}
+
+	want := sandboxState{
+		DockerProxy:  &dockerProxyConfig{Dir: "/tmp/d", Upstream: "/var/run/docker.sock"},
+		NetworkProxy: &networkProxyConfig{Dir: "/tmp/n"},
+	}
+	if err := writeSandboxState(id, want); err != nil {
+		t.Fatalf("writeSandboxState() error = %v", err)
+	}
+	if info, err := os.Stat(sandboxStatePath(id)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("state file = %v, %v, want mode 0600", info, err)
+	}
+	got, err := loadSandboxState(id)
+	if err != nil {
+		t.Fatalf("loadSandboxState() error = %v", err)
+	}
+	if got.DockerProxy == nil || got.DockerProxy.Dir != "/tmp/d" || got.DockerProxy.Upstream != "/var/run/docker.sock" {
+		t.Errorf("DockerProxy = %+v, want %+v", got.DockerProxy, want.DockerProxy)
+	}
+	if got.NetworkProxy == nil || got.NetworkProxy.Dir != "/tmp/n" {
+		t.Errorf("NetworkProxy = %+v, want %+v", got.NetworkProxy, want.NetworkProxy)
+	}
+
+	removeSandboxState(id)
+	if _, err := os.Stat(sandboxStatePath(id)); !os.IsNotExist(err) {
+		t.Errorf("state file still exists after removeSandboxState(): %v", err)
+	}
+
+	if err := writeSandboxState("../escape", want); err == nil {
+		t.Error("writeSandboxState() accepted an invalid container ID")
+	}
+}
+
+func TestInspectSandbox(t *testing.T) {
+	original := runContainerOutputQuiet
+	defer func() { runContainerOutputQuiet = original }()
+
+	var gotArgs []string
+	runContainerOutputQuiet = func(_ string, args []string) ([]byte, error) {
+		gotArgs = args
+		return []byte("false|api|\n"), nil
+	}
+	info, err := inspectSandbox("docker", "api")
+	if err != nil || info.Running {
+		t.Fatalf("inspectSandbox() = %+v, %v, want stopped sandbox", info, err)
+	}
+	if gotArgs[len(gotArgs)-1] != "cc-sandbox-api" {
+		t.Errorf("inspectSandbox() inspected %v, want container cc-sandbox-api", gotArgs)
+	}
+
+	runContainerOutputQuiet = func(_ string, _ []string) ([]byte, error) {
+		return nil, errors.New("no such container")
+	}
+	if _, err := inspectSandbox("docker", "api"); err == nil {
+		t.Error("inspectSandbox() = nil error for a missing container")
+	}
+}
+
+func TestBuildContainerArgsPersistent(t *testing.T) {
+	cfg := &Config{
+		Workdir:    t.TempDir(),
+		Name:       "api-refactor",
+		SecretsDir: "/tmp/cc-sandbox-secrets-1",
+	}
+	args := buildContainerArgs(cfg, "docker", "test-image", []string{"claude"})
+	argsStr := joinArgs(args)
+
+	for _, want := range []string{
+		"run -d -it --name cc-sandbox-api-refactor",
+		"--label cc-sandbox.name=api-refactor",
+		"--label cc-sandbox.secrets-dir=/tmp/cc-sandbox-secrets-1",
+		cfg.Workdir + ":/workspace",
+	} {
+		if !contains(argsStr, want) {
+			t.Errorf("buildContainerArgs() missing %q: %s", want, argsStr)
+		}
+	}
+	if contains(argsStr, "--rm") {
+		t.Errorf("buildContainerArgs() uses --rm for a persistent sandbox: %s", argsStr)
+	}
+
+	cfg.Name = ""
+	argsStr = joinArgs(buildContainerArgs(cfg, "docker", "test-image", nil))
+	if !contains(argsStr, "run --rm") || contains(argsStr, labelName) || contains(argsStr, labelSecretsDir) {
+		t.Errorf("buildContainerArgs() without a name = %s, want an unnamed --rm run", argsStr)
+	}
+}
+
+func TestContainerLabelArgs(t *testing.T) {
+	started := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cfg := &Config{Workdir: "/home/me/src/api", Profile: "work"}
+	argsStr := joinArgs(containerLabelArgs(cfg, "cc-sandbox:docker", started))
+
+	for _, want := range []string{
+		"--label " + labelVersion + "=" + version,
+		"--label " + labelWorkdir + "=/home/me/src/api",
+		"--label " + labelImage + "=cc-sandbox:docker",
+		"--label " + labelProfile + "=work",
+		"--label " + labelStarted + "=2026-03-01T12:00:00Z",
+	} {
+		if !contains(argsStr, want) {
+			t.Errorf("containerLabelArgs() missing %q: %s", want, argsStr)
+		}
+	}
+
+	cfg.Profile = ""
+	if argsStr := joinArgs(containerLabelArgs(cfg, "cc-sandbox:docker", started)); contains(argsStr, labelProfile) {
+		t.Errorf("containerLabelArgs() labels an empty profile: %s", argsStr)
+	}
+}
+
+func TestRemoveSandboxSecrets(t *testing.T) {
+	base := t.TempDir()
+
+	dir := filepath.Join(base, "cc-sandbox-secrets-123")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeSandboxSecrets(dir); err != nil {
+		t.Fatalf("removeSandboxSecrets() error = %v", err)
+	}
+	if dirExists(dir) {
+		t.Error("removeSandboxSecrets() did not remove the directory")
+	}
+
+	if err := removeSandboxSecrets(base); err == nil || !dirExists(base) {
+		t.Error("removeSandboxSecrets() removed a directory it did not create")
+	}
+	if err := removeSandboxSecrets(""); err != nil {
+		t.Errorf("removeSandboxSecrets(\"\") = %v, want nil", err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// containerSecretsDir is where the secrets directory is mounted in the container.
+// The entrypoint exports each file in it as an environment variable.
+const containerSecretsDir = "/run/cc-sandbox/secrets"
+
+// secretKeyMarkers are substrings of env var names that usually hold credentials.
+var secretKeyMarkers = []string{
+	"TOKEN", "SECRET", "PASSWORD", "PASSWD", "API_KEY", "APIKEY",
+	"PRIVATE_KEY", "ACCESS_KEY", "CREDENTIAL",
+}
+
+// secretValuePrefixes are well-known credential formats.
+var secretValuePrefixes = []string{
+	"sk-", "ghp_", "gho_", "ghs_", "ghu_", "github_pat_", "glpat-", "xoxb-", "xoxp-", "AKIA",
+}
+
+// isSecretEnv reports whether an env var looks like it holds a secret,
+// judged by its name or by a well-known credential prefix in its value.
+func isSecretEnv(key, value string) bool {
+	upper := strings.ToUpper(key)
+	for _, marker := range secretKeyMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	for _, prefix := range secretValuePrefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitEnvVar splits a -e value into key and value.
+// A bare KEY passes the host's value through, like docker does.
+func splitEnvVar(env string) (key, value string) {
+	if k, v, ok := strings.Cut(env, "="); ok {
+		return k, v
+	}
+	return env, os.Getenv(env)
+}
+
+// isSecretEnvVar reports whether a -e value must be delivered as a secret file.
+func isSecretEnvVar(env string) bool {
+	key, value := splitEnvVar(env)
+	return isSecretEnv(key, value)
+}
+
+// collectSecretEnv returns the env vars for cfg that must not appear in process
+// arguments or container config, keyed by variable name.
+func collectSecretEnv(cfg *Config) map[string]string {
+	secrets := make(map[string]string)
+
+	if cfg.MountGH {
+		for _, key := range []string{"GH_TOKEN", "GITHUB_TOKEN"} {
+			if token := os.Getenv(key); token != "" {
+				secrets[key] = token
+			}
+		}
+	}
+
+	for _, env := range cfg.EnvVars {
+		if !isSecretEnvVar(env) {
+			continue
+		}
+		// Bare KEY with nothing on the host is skipped, matching docker's -e KEY
+		if key, value := splitEnvVar(env); value != "" || strings.Contains(env, "=") {
+			secrets[key] = value
+		}
+	}
+
+	return secrets
+}
+
+// writeSecretsDir writes each secret to its own 0600 file in a private directory.
+// It prefers $XDG_RUNTIME_DIR, which is a per-user tmpfs on most Linux systems.
+// The returned cleanup function removes the directory.
+func writeSecretsDir(secrets map[string]string) (string, func(), error) {
+	dir, err := os.MkdirTemp(secretsBaseDir(), "cc-sandbox-secrets-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+
+	for key, value := range secrets {
+		if !isValidEnvName(key) {
+			cleanup()
+			return "", nil, fmt.Errorf("invalid environment variable name %q", key)
+		}
+		if err := os.WriteFile(filepath.Join(dir, key), []byte(value), 0600); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to write secret %s: %w", key, err)
+		}
+	}
+
+	return dir, cleanup, nil
+}
+
+// isValidEnvName reports whether name is a portable shell variable name.
+// Names are used as file names, so this also rules out path separators.
+func isValidEnvName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, r := range name {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// secretsBaseDir returns the parent directory for per-run secrets directories.
+// Without XDG_RUNTIME_DIR, /tmp/cc-sandbox-<uid> is used only if it is a
+// directory of our own that nobody else can enter: another user could have
+// created it first. Otherwise the per-run directories go directly in the temp
+// dir, where os.MkdirTemp gives them unpredictable names and mode 0700.
+func secretsBaseDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && dirExists(dir) {
+		return dir
+	}
+	if uid := os.Getuid(); uid >= 0 {
+		base := filepath.Join(os.TempDir(), "cc-sandbox-"+strconv.Itoa(uid))
+		_ = os.Mkdir(base, 0700)
+		if isPrivateDir(base) {
+			return base
+		}
+		debugLog("Not using %s for secrets: not a private directory of this user", base)
+	}
+	return os.TempDir()
+}
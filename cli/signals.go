@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// interruptGracePeriod is how long a container gets to stop after an
+// interrupting signal is forwarded, before it is removed forcefully.
+var interruptGracePeriod = 10 * time.Second
+
+// exitCodeError carries the exit status of the runtime CLI (and so of the
+// container) to main, which exits with it without printing an error.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// exitCodeOf returns the exit code main should use for err.
+func exitCodeOf(err error) int {
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return 1
+}
+
+// commandExitError converts the error from waiting on a runtime CLI into an
+// *exitCodeError. A process killed by a signal reports 128+signal, like a shell.
+// Other errors are returned unchanged.
+func commandExitError(err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return &exitCodeError{code: 128 + int(status.Signal())}
+	}
+	return &exitCodeError{code: exitErr.ExitCode()}
+}
+
+// runForwardingSignals runs cmd with signals forwarded to it and returns its
+// exit status as an *exitCodeError.
+func runForwardingSignals(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	stop := forwardSignals(cmd.Process, nil)
+	defer stop()
+	return commandExitError(cmd.Wait())
+}
+
+// forwardSignals relays the signals in forwardedSignals to process until stop
+// is called. If process is still running interruptGracePeriod after an
+// interrupting signal, or a second one arrives, onStuck is called once.
+func forwardSignals(process *os.Process, onStuck func()) (stop func()) {
+	sigs := make(chan os.Signal, 8)
+	signal.Notify(sigs, forwardedSignals...)
+	done := make(chan struct{})
+
+	go func() {
+		var grace <-chan time.Time
+		interrupted, stuck := false, false
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-sigs:
+				debugLog("Forwarding signal %v to the container runtime", sig)
+				_ = process.Signal(sig)
+				if onStuck == nil || stuck || !isInterruptSignal(sig) {
+					continue
+				}
+				if !interrupted {
+					interrupted = true
+					grace = time.After(interruptGracePeriod)
+					continue
+				}
+				stuck = true
+				onStuck()
+			case <-grace:
+				grace = nil
+				if !stuck {
+					stuck = true
+					onStuck()
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// isInterruptSignal reports whether sig asks the session to end.
+func isInterruptSignal(sig os.Signal) bool {
+	for _, s := range interruptSignals {
+		if sig == s {
+			return true
+		}
+	}
+	return false
+}
+
+// removeContainerFromCIDFile force-removes the container whose ID the runtime
+// wrote to cidFile. It does nothing if the container was never created.
+func removeContainerFromCIDFile(containerRuntime, cidFile string) {
+	data, err := os.ReadFile(cidFile)
+	if err != nil {
+		return
+	}
+	id := strings.TrimSpace(string(data))
+	if id == "" {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[cc-sandbox] Container did not stop, removing %.12s\n", id)
+	if err := exec.Command(containerRuntime, "rm", "-f", id).Run(); err != nil {
+		debugLog("Failed to remove container %s: %v", id, err)
+	}
+}
+
+// cidFilePollInterval is how often waitForCIDFile looks for the container ID.
+var cidFilePollInterval = 100 * time.Millisecond
+
+// waitForCIDFile waits until the runtime has written the container's ID to
+// cidFile, which it does once the container is created. Returns false if done
+// is closed first, e.g. because the runtime exited without creating one.
+func waitForCIDFile(cidFile string, done <-chan struct{}) bool {
+	ticker := time.NewTicker(cidFilePollInterval)
+	defer ticker.Stop()
+	for {
+		if data, err := os.ReadFile(cidFile); err == nil && strings.TrimSpace(string(data)) != "" {
+			return true
+		}
+		select {
+		case <-done:
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// stopContainerFromCIDFile stops the container whose ID the runtime wrote to
+// cidFile, giving it grace to exit before the runtime kills it. It does
+// nothing if the container was never created.
+func stopContainerFromCIDFile(containerRuntime, cidFile string, grace time.Duration) {
+	data, err := os.ReadFile(cidFile)
+	if err != nil {
+		return
+	}
+	id := strings.TrimSpace(string(data))
+	if id == "" {
+		return
+	}
+	seconds := strconv.Itoa(int(grace.Round(time.Second) / time.Second))
+	if err := exec.Command(containerRuntime, "stop", "-t", seconds, id).Run(); err != nil {
+		debugLog("Failed to stop container %s: %v", id, err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCommandExitError(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	err := commandExitError(exec.Command("sh", "-c", "exit 3").Run())
+	if code := exitCodeOf(err); code != 3 {
+		t.Errorf("exit 3: exitCodeOf() = %d, want 3", code)
+	}
+
+	if runtime.GOOS != "windows" {
+		err = commandExitError(exec.Command("sh", "-c", "kill -TERM $$").Run())
+		if code := exitCodeOf(err); code != 128+int(syscall.SIGTERM) {
+			t.Errorf("killed by SIGTERM: exitCodeOf() = %d, want %d", code, 128+int(syscall.SIGTERM))
+		}
+	}
+
+	if err := commandExitError(nil); err != nil {
+		t.Errorf("commandExitError(nil) = %v, want nil", err)
+	}
+	other := errors.New("not started")
+	if err := commandExitError(other); err != other || exitCodeOf(err) != 1 {
+		t.Errorf("commandExitError(%v) = %v, want it unchanged with exit code 1", other, err)
+	}
+}
+
+func TestForwardSignals(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not forwarded on Windows")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A process that ignores SIGINT is handed to onStuck on the second one
+	cmd := exec.Command("sh", "-c", `trap "" INT; sleep 10 & wait`)
+	detachFromTerminalSignals(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	stuck := make(chan struct{})
+	stop := forwardSignals(cmd.Process, func() {
+		close(stuck)
+		_ = cmd.Process.Kill()
+	})
+
+	_ = self.Signal(syscall.SIGINT)
+	time.Sleep(100 * time.Millisecond)
+	_ = self.Signal(syscall.SIGINT)
+	select {
+	case <-stuck:
+	case <-time.After(5 * time.Second):
+		t.Fatal("onStuck was not called after a second SIGINT")
+	}
+	_ = cmd.Wait()
+	stop()
+
+	// SIGTERM is forwarded and ends a process that does not ignore it
+	cmd = exec.Command("sleep", "10")
+	detachFromTerminalSignals(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	stopTerm := forwardSignals(cmd.Process, nil)
+	defer stopTerm()
+	_ = self.Signal(syscall.SIGTERM)
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+	select {
+	case err := <-waitErr:
+		if code := exitCodeOf(commandExitError(err)); code != 128+int(syscall.SIGTERM) {
+			t.Errorf("forwarded SIGTERM: exit code %d, want %d", code, 128+int(syscall.SIGTERM))
+		}
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatal("SIGTERM was not forwarded")
+	}
+}
+
+func TestBuildContainerArgsCIDFile(t *testing.T) {
+	cfg := &Config{Workdir: t.TempDir(), CIDFile: "/tmp/cc-sandbox-cid-1/cid"}
+	if argsStr := joinArgs(buildContainerArgs(cfg, "docker", "test-image", nil)); !contains(argsStr, "--cidfile /tmp/cc-sandbox-cid-1/cid") {
+		t.Errorf("buildContainerArgs() missing --cidfile: %s", argsStr)
+	}
+}
+
+func TestWaitForCIDFile(t *testing.T) {
+	cidFile := filepath.Join(t.TempDir(), "cid")
+
+	// The runtime exits without creating the container
+	done := make(chan struct{})
+	close(done)
+	if waitForCIDFile(cidFile, done) {
+		t.Error("waitForCIDFile() without a container = true, want false")
+	}
+
+	// The runtime creates the file first and writes the ID later
+	if err := os.WriteFile(cidFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(cidFile, []byte("abc123"), 0644)
+	}()
+	if !waitForCIDFile(cidFile, make(chan struct{})) {
+		t.Error("waitForCIDFile() = false, want true once the ID is written")
+	}
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// forwardedSignals are relayed from cc-sandbox to the container runtime CLI.
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGWINCH}
+
+// interruptSignals end the session; the container is cleaned up if it
+// ignores them.
+var interruptSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+
+// detachFromTerminalSignals puts cmd in its own process group, so a Ctrl-C in
+// the terminal reaches it only once, through cc-sandbox. Only used for runs
+// without a TTY, where the runtime CLI never reads from the terminal.
+func detachFromTerminalSignals(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// forwardedSignals are relayed from cc-sandbox to the container runtime CLI.
+// Windows only delivers Ctrl-C, which the runtime CLI also receives directly.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// interruptSignals end the session; the container is cleaned up if it
+// ignores them.
+var interruptSignals = []os.Signal{os.Interrupt}
+
+// detachFromTerminalSignals does nothing on Windows, which has no process groups
+// in the Unix sense.
+func detachFromTerminalSignals(cmd *exec.Cmd) {}
@@ -17,3 +17,14 @@ func getFileGID(path string) int {
 	}
 	return 0
 }
+
+// isPrivateDir reports whether path is a directory, not a symlink, owned by
+// the current user with mode 0700.
+func isPrivateDir(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil || !info.IsDir() || info.Mode().Perm() != 0700 {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid()
+}
@@ -7,3 +7,9 @@ package main
 func getFileGID(path string) int {
 	return 0
 }
+
+// isPrivateDir returns false on Windows, which has no Unix file modes; the
+// per-user temp dir is private already.
+func isPrivateDir(path string) bool {
+	return false
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// taskRecipe is a named headless session defined under "tasks" in the user
+// or project config file, run with `cc-sandbox task run <name>`.
+type taskRecipe struct {
+	Description string            `yaml:"description" toml:"description"`
+	Image       string            `yaml:"image" toml:"image"`
+	Mounts      []string          `yaml:"mounts" toml:"mounts"`
+	Env         []string          `yaml:"env" toml:"env"`
+	Prompt      string            `yaml:"prompt" toml:"prompt"` // Template; {{name}} is replaced by parameter name
+	ClaudeFlags []string          `yaml:"claude_flags" toml:"claude_flags"`
+	Params      map[string]string `yaml:"params" toml:"params"` // Parameter defaults; parameters without one are required
+}
+
+// promptParamPattern matches a {{name}} placeholder in a prompt template.
+var promptParamPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// resolveRecipePaths anchors relative mount paths of recipes at baseDir,
+// like the mounts of the config file that defines them.
+func resolveRecipePaths(recipes map[string]*taskRecipe, baseDir string) {
+	for _, recipe := range recipes {
+		if recipe == nil {
+			continue
+		}
+		for i, mount := range recipe.Mounts {
+			recipe.Mounts[i] = resolveHostPath(mount, baseDir)
+		}
+	}
+}
+
+// dropUntrustedRecipeSettings removes the mounts and env of the recipes of
+// an untrusted project file and returns the settings it removed. Like the
+// file's own mounts and env (see dropUntrustedSettings), they could reach any
+// host path or redirect the session's credentials.
+func dropUntrustedRecipeSettings(recipes map[string]*taskRecipe) []string {
+	var dropped []string
+	for name, recipe := range recipes {
+		if recipe == nil {
+			continue
+		}
+		if len(recipe.Mounts) > 0 {
+			recipe.Mounts = nil
+			dropped = append(dropped, "tasks."+name+".mounts")
+		}
+		if len(recipe.Env) > 0 {
+			recipe.Env = nil
+			dropped = append(dropped, "tasks."+name+".env")
+		}
+	}
+	sort.Strings(dropped)
+	return dropped
+}
+
+// loadTaskRecipes returns the recipes defined in the user config file and in
+// the project config file for workdir. Project recipes replace user recipes
+// of the same name.
+func loadTaskRecipes(workdir string) (map[string]*taskRecipe, error) {
+	recipes := make(map[string]*taskRecipe)
+	add := func(defined map[string]*taskRecipe) {
+		for name, recipe := range defined {
+			if recipe == nil {
+				recipe = &taskRecipe{}
+			}
+			recipes[name] = recipe
+		}
+	}
+
+	userCfg, err := loadUserConfig(getUserConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	if userCfg != nil {
+		add(userCfg.Tasks)
+	}
+	if path := findProjectConfig(workdir); path != "" {
+		pc, err := loadProjectConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		if !pc.trusted {
+			if dropped := dropUntrustedRecipeSettings(pc.Tasks); len(dropped) > 0 {
+				warnUntrustedSettings(dropped, path)
+			}
+		}
+		add(pc.Tasks)
+	}
+	return recipes, nil
+}
+
+// params returns the names of the recipe's parameters, sorted: those used in
+// the prompt and those with a default.
+func (r *taskRecipe) params() []string {
+	seen := make(map[string]bool)
+	for _, m := range promptParamPattern.FindAllStringSubmatch(r.Prompt, -1) {
+		seen[m[1]] = true
+	}
+	for name := range r.Params {
+		seen[name] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderPrompt fills the prompt template with values, falling back to the
+// recipe's defaults. Unknown and missing parameters are errors.
+func (r *taskRecipe) renderPrompt(name string, values map[string]string) (string, error) {
+	if strings.TrimSpace(r.Prompt) == "" {
+		return "", fmt.Errorf("task %s has no prompt", name)
+	}
+	known := r.params()
+	merged := make(map[string]string)
+	for k, v := range r.Params {
+		merged[k] = v
+	}
+	for k, v := range values {
+		if !containsString(known, k) {
+			return "", fmt.Errorf("task %s has no parameter %q (parameters: %s)", name, k, describeParams(r))
+		}
+		merged[k] = v
+	}
+
+	var missing []string
+	for _, k := range known {
+		if _, ok := merged[k]; !ok {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("task %s needs --param %s=<value>", name, strings.Join(missing, "=<value> --param "))
+	}
+
+	return promptParamPattern.ReplaceAllStringFunc(r.Prompt, func(placeholder string) string {
+		return merged[promptParamPattern.FindStringSubmatch(placeholder)[1]]
+	}), nil
+}
+
+// describeParams lists the recipe's parameters for `task list`, with their defaults.
+func describeParams(r *taskRecipe) string {
+	names := r.params()
+	if len(names) == 0 {
+		return "-"
+	}
+	for i, name := range names {
+		if def, ok := r.Params[name]; ok {
+			names[i] = name + "=" + def
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTaskParams parses --param key=value flags.
+func parseTaskParams(params []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, p := range params {
+		key, value, ok := strings.Cut(p, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --param %q: use key=value", p)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// applyRecipe adds the recipe's image, mounts and env to cfg. Flags given on
+// the command line still win: an -i flag keeps its image, and --mount and
+// --env entries come after the recipe's. The returned flagChanged reports the
+// recipe's image as set by flag, so config files don't override it.
+func applyRecipe(cfg *Config, recipe *taskRecipe, flagChanged func(string) bool) func(string) bool {
+	cfg.Mounts = append(append([]string(nil), recipe.Mounts...), cfg.Mounts...)
+	cfg.EnvVars = append(append([]string(nil), recipe.Env...), cfg.EnvVars...)
+	if recipe.Image == "" || flagChanged("image") {
+		return flagChanged
+	}
+	cfg.Image = recipe.Image
+	return func(name string) bool { return name == "image" || flagChanged(name) }
+}
+
+// recipeCommand returns the container command for a recipe: claude with the
+// recipe's flags, the prompt and any extra arguments from the command line.
+func recipeCommand(recipe *taskRecipe, prompt string, extra []string) []string {
+	args := append([]string{"claude"}, recipe.ClaudeFlags...)
+	args = append(args, "-p", prompt)
+	return append(args, extra...)
+}
+
+// taskWorkdir returns the directory whose project config defines the tasks.
+func taskWorkdir(workdir string) (string, error) {
+	if workdir != "" {
+		return expandPath(workdir), nil
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	return dir, nil
+}
+
+// newTaskCmd creates the task subcommand.
+func newTaskCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "task",
+		Short: "Run task recipes defined in the config files",
+		Long: `Run recurring headless sessions defined as recipes under "tasks" in the user
+config file or the project's .cc-sandbox.yaml. A recipe sets an image, mounts,
+env, claude flags and a prompt template whose {{name}} placeholders are filled
+with --param values.
+
+Example recipe:
+  tasks:
+    update-deps:
+      description: Update a dependency and fix what breaks
+      image: bun
+      env: [CI=1]
+      prompt: Update {{pkg}} to {{version}}, then run the tests and fix failures.
+      params:
+        version: latest
+      claude_flags: [--max-turns, "40"]
+
+Examples:
+  cc-sandbox task list
+  cc-sandbox task run update-deps --param pkg=react
+  cc-sandbox task run update-deps --param pkg=react -- --verbose`,
+	}
+	cmd.AddCommand(newTaskRunCmd())
+	cmd.AddCommand(newTaskListCmd())
+	return cmd
+}
+
+func newTaskRunCmd() *cobra.Command {
+	cfg := &Config{}
+	var rootFlag string
+	var params []string
+
+	cmd := &cobra.Command{
+		Use:   "run <name> [-- claude args...]",
+		Short: "Run a task recipe in a sandbox",
+		Long: `Run a task recipe as a headless "claude -p" session. Sandbox flags work as for
+a plain run; -i replaces the recipe's image, and --mount and --env add to its
+mounts and env. Arguments after -- are passed to claude.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg.Root = parseRootFlag(rootFlag)
+			values, err := parseTaskParams(params)
+			if err != nil {
+				return err
+			}
+			workdir, err := taskWorkdir(cfg.Workdir)
+			if err != nil {
+				return err
+			}
+			recipes, err := loadTaskRecipes(workdir)
+			if err != nil {
+				return err
+			}
+			recipe, ok := recipes[args[0]]
+			if !ok {
+				return fmt.Errorf("no task named %q; see 'cc-sandbox task list'", args[0])
+			}
+			prompt, err := recipe.renderPrompt(args[0], values)
+			if err != nil {
+				return err
+			}
+
+			flagChanged := applyRecipe(cfg, recipe, cmd.Flags().Changed)
+			return runSandbox(cfg, recipeCommand(recipe, prompt, args[1:]), flagChanged)
+		},
+	}
+
+	addSandboxFlags(cmd, cfg, &rootFlag)
+	cmd.Flags().StringArrayVar(&params, "param", nil, "Value for a prompt parameter (name=value)")
+
+	return cmd
+}
+
+func newTaskListCmd() *cobra.Command {
+	var workdir string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the task recipes and their parameters",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			dir, err := taskWorkdir(workdir)
+			if err != nil {
+				return err
+			}
+			recipes, err := loadTaskRecipes(dir)
+			if err != nil {
+				return err
+			}
+			return printTaskRecipes(os.Stdout, recipes)
+		},
+	}
+
+	cmd.Flags().StringVarP(&workdir, "workdir", "w", "", "Directory whose project config to read (default: current directory)")
+
+	return cmd
+}
+
+func printTaskRecipes(w io.Writer, recipes map[string]*taskRecipe) error {
+	if len(recipes) == 0 {
+		_, err := fmt.Fprintln(w, "No tasks defined. Add recipes under \"tasks\" in .cc-sandbox.yaml or the user config file.")
+		return err
+	}
+
+	names := make([]string, 0, len(recipes))
+	for name := range recipes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TASK\tPARAMETERS\tDESCRIPTION")
+	for _, name := range names {
+		recipe := recipes[name]
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", name, describeParams(recipe), recipe.Description)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTaskRecipes(t *testing.T) {
+	dir := t.TempDir()
+	userConfig := filepath.Join(dir, "config.yaml")
+	t.Setenv("CC_SANDBOX_CONFIG_FILE", userConfig)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `default:
+  image: base
+tasks:
+  update-deps:
+    prompt: user version
+  triage:
+    description: Triage a flaky test
+    prompt: Find out why {{test}} is flaky
+    mounts: [./fixtures:/fixtures]
+`,
+		"project/.cc-sandbox.yaml": `image: docker
+tasks:
+  update-deps:
+    image: bun
+    prompt: Update {{pkg}} to {{version}}
+    mounts: [../../..:/host]
+    params:
+      version: latest
+`,
+		"toml/.cc-sandbox.toml": `image = "docker"
+
+[tasks.lint]
+prompt = "Fix the lint errors"
+claude_flags = ["--max-turns", "10"]
+`,
+	})
+
+	recipes, err := loadTaskRecipes(filepath.Join(dir, "project"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipes) != 2 {
+		t.Fatalf("loadTaskRecipes() = %v, want update-deps and triage", recipes)
+	}
+	if got := recipes["update-deps"]; got.Image != "bun" || got.Params["version"] != "latest" {
+		t.Errorf("update-deps = %+v, want the project's recipe", got)
+	}
+	if got := recipes["update-deps"].Mounts; len(got) > 0 {
+		t.Errorf("update-deps mounts = %v, want the project file's mounts ignored", got)
+	}
+	if got := recipes["triage"].Mounts[0]; got != filepath.Join(dir, "fixtures")+":/fixtures" {
+		t.Errorf("triage mount = %q, want it relative to the user config file", got)
+	}
+
+	// Trusting the project file applies its recipes' mounts too
+	trustProjectConfig(t, filepath.Join(dir, "project"))
+	recipes, err = loadTaskRecipes(filepath.Join(dir, "project"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := recipes["update-deps"].Mounts; len(got) != 1 {
+		t.Errorf("update-deps mounts of a trusted file = %v, want them applied", got)
+	}
+
+	recipes, err = loadTaskRecipes(filepath.Join(dir, "toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := recipes["lint"]; got == nil || len(got.ClaudeFlags) != 2 {
+		t.Errorf("lint = %+v, want the recipe from the TOML file", got)
+	}
+
+	// The project file's sandbox settings still load with recipes in it
+	fc, err := loadFileConfig(filepath.Join(dir, "project", ".cc-sandbox.yaml"))
+	if err != nil || fc.Image == nil || *fc.Image != "docker" {
+		t.Errorf("loadFileConfig() = %+v, %v, want image docker", fc, err)
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	recipe := &taskRecipe{
+		Prompt: "Update {{pkg}} to {{ version }} in {{pkg}}'s callers",
+		Params: map[string]string{"version": "latest"},
+	}
+
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"default used", map[string]string{"pkg": "react"}, "Update react to latest in react's callers", false},
+		{"default overridden", map[string]string{"pkg": "react", "version": "19"}, "Update react to 19 in react's callers", false},
+		{"missing parameter", nil, "", true},
+		{"unknown parameter", map[string]string{"pkg": "react", "pkgs": "vue"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := recipe.renderPrompt("update-deps", tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderPrompt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("renderPrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (&taskRecipe{}).renderPrompt("empty", nil); err == nil {
+		t.Error("renderPrompt() of a recipe without a prompt succeeded")
+	}
+}
+
+func TestDescribeParams(t *testing.T) {
+	recipe := &taskRecipe{Prompt: "{{pkg}} {{version}}", Params: map[string]string{"version": "latest", "extra": ""}}
+	if got := describeParams(recipe); got != "extra=, pkg, version=latest" {
+		t.Errorf("describeParams() = %q", got)
+	}
+	if got := describeParams(&taskRecipe{Prompt: "Fix the lint errors"}); got != "-" {
+		t.Errorf("describeParams() without parameters = %q, want -", got)
+	}
+}
+
+func TestParseTaskParams(t *testing.T) {
+	values, err := parseTaskParams([]string{"pkg=react", "query=a=b", "empty="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["pkg"] != "react" || values["query"] != "a=b" || values["empty"] != "" || len(values) != 3 {
+		t.Errorf("parseTaskParams() = %v", values)
+	}
+	for _, bad := range []string{"pkg", "=react"} {
+		if _, err := parseTaskParams([]string{bad}); err == nil {
+			t.Errorf("parseTaskParams(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestApplyRecipe(t *testing.T) {
+	recipe := &taskRecipe{Image: "bun", Mounts: []string{"/cache:/cache"}, Env: []string{"CI=1"}, ClaudeFlags: []string{"--max-turns", "5"}}
+	noFlags := func(string) bool { return false }
+
+	cfg := &Config{Mounts: []string{"/data:/data"}, EnvVars: []string{"CI=0"}}
+	flagChanged := applyRecipe(cfg, recipe, noFlags)
+	if cfg.Image != "bun" || !flagChanged("image") {
+		t.Errorf("Image = %q, want the recipe's, reported as set", cfg.Image)
+	}
+	if got := joinArgs(cfg.EnvVars); got != "CI=1 CI=0 " {
+		t.Errorf("EnvVars = %q, want the recipe's before the flags'", got)
+	}
+	if got := joinArgs(cfg.Mounts); got != "/cache:/cache /data:/data " {
+		t.Errorf("Mounts = %q, want the recipe's before the flags'", got)
+	}
+
+	cfg = &Config{Image: "docker"}
+	imageFlag := func(name string) bool { return name == "image" }
+	applyRecipe(cfg, recipe, imageFlag)
+	if cfg.Image != "docker" {
+		t.Errorf("Image = %q, want the -i flag to win", cfg.Image)
+	}
+
+	if got := joinArgs(recipeCommand(recipe, "do it", []string{"--verbose"})); got != "claude --max-turns 5 -p do it --verbose " {
+		t.Errorf("recipeCommand() = %q", got)
+	}
+}
+
+func TestPrintTaskRecipes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printTaskRecipes(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !contains(buf.String(), "No tasks defined") {
+		t.Errorf("empty list = %q", buf.String())
+	}
+
+	buf.Reset()
+	err := printTaskRecipes(&buf, map[string]*taskRecipe{
+		"triage":      {Description: "Triage a flaky test", Prompt: "{{test}}"},
+		"update-deps": {Prompt: "{{pkg}}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !contains(out, "Triage a flaky test") || !contains(out, "pkg") || bytes.Index(buf.Bytes(), []byte("triage")) > bytes.Index(buf.Bytes(), []byte("update-deps")) {
+		t.Errorf("task list =\n%s", out)
+	}
+}
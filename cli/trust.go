@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// trustedProjects maps the absolute paths of trusted project config files to
+// the SHA-256 of the content that was trusted. Editing a file, for example in
+// a pull or by an agent, makes it untrusted again.
+type trustedProjects map[string]string
+
+// trustedProjectsPath returns the host-side file recording trusted project
+// config files. It lives outside every repository, where no sandbox can
+// write it.
+func trustedProjectsPath() string {
+	return filepath.Join(dataBaseDir(), "trusted-projects.json")
+}
+
+// loadTrustedProjects reads the trusted project config files. A missing file
+// trusts nothing.
+func loadTrustedProjects() (trustedProjects, error) {
+	trusted := make(trustedProjects)
+	data, err := os.ReadFile(trustedProjectsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return trusted, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &trusted); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", trustedProjectsPath(), err)
+	}
+	return trusted, nil
+}
+
+// save writes the trusted project config files, readable only by the user.
+func (t trustedProjects) save() error {
+	path := trustedProjectsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// projectConfigDigest returns the digest recorded for a project config file's content.
+func projectConfigDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isProjectConfigTrusted reports whether the project config file at path was
+// trusted with exactly this content.
+func isProjectConfigTrusted(path string, data []byte) bool {
+	trusted, err := loadTrustedProjects()
+	if err != nil {
+		debugLog("Failed to read trusted projects: %v", err)
+		return false
+	}
+	digest, ok := trusted[path]
+	return ok && digest == projectConfigDigest(data)
+}
+
+func newConfigTrustCmd() *cobra.Command {
+	var workdir string
+
+	cmd := &cobra.Command{
+		Use:   "trust [flags]",
+		Short: "Apply every setting of the project config file, as it is now",
+		Long: `Trust the project config file of the working directory. Without trust,
+settings in it that weaken the sandbox or reach host files and credentials are
+ignored with a warning. Trust covers the file's current content: after any
+change, review it and trust it again.`,
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			path, err := projectConfigFor(workdir)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			trusted, err := loadTrustedProjects()
+			if err != nil {
+				return err
+			}
+			trusted[path] = projectConfigDigest(data)
+			if err := trusted.save(); err != nil {
+				return fmt.Errorf("failed to save trust: %w", err)
+			}
+			fmt.Printf("Trusted %s\n", path)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&workdir, "workdir", "w", "", "Directory whose project config to trust (default: current directory)")
+
+	return cmd
+}
+
+func newConfigUntrustCmd() *cobra.Command {
+	var workdir string
+
+	cmd := &cobra.Command{
+		Use:   "untrust [flags]",
+		Short: "Stop trusting the project config file",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			path, err := projectConfigFor(workdir)
+			if err != nil {
+				return err
+			}
+			trusted, err := loadTrustedProjects()
+			if err != nil {
+				return err
+			}
+			if _, ok := trusted[path]; !ok {
+				return fmt.Errorf("%s is not trusted", path)
+			}
+			delete(trusted, path)
+			if err := trusted.save(); err != nil {
+				return fmt.Errorf("failed to save trust: %w", err)
+			}
+			fmt.Printf("Untrusted %s\n", path)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&workdir, "workdir", "w", "", "Directory whose project config to untrust (default: current directory)")
+
+	return cmd
+}
+
+// projectConfigFor returns the project config file that applies to workdir.
+func projectConfigFor(workdir string) (string, error) {
+	dir := expandPath(workdir)
+	if dir == "" {
+		var err error
+		if dir, err = os.Getwd(); err != nil {
+			return "", fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+	path := findProjectConfig(dir)
+	if path == "" {
+		return "", fmt.Errorf("no project config file (%s) in %s or its parents", strings.Join(projectConfigNames, ", "), dir)
+	}
+	return path, nil
+}
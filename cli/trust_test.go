@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// trustProjectConfig trusts the project config file of workdir, as
+// `cc-sandbox config trust` does. Callers point XDG_DATA_HOME at a temporary
+// directory first.
+func trustProjectConfig(t *testing.T, workdir string) {
+	t.Helper()
+	path, err := projectConfigFor(workdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := loadTrustedProjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted[path] = projectConfigDigest(data)
+	if err := trusted.save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigTrust(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("CC_SANDBOX_CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+	workdir := t.TempDir()
+	path := filepath.Join(workdir, ".cc-sandbox.yaml")
+	if err := os.WriteFile(path, []byte("mounts:\n  - /data:/data\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mounts := func() []string {
+		t.Helper()
+		pc, err := loadProjectConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pc.trusted {
+			pc.dropUntrustedSettings(&Config{})
+		}
+		return pc.Mounts
+	}
+
+	if got := mounts(); len(got) != 0 {
+		t.Errorf("mounts of an untrusted file = %v, want none", got)
+	}
+	trustProjectConfig(t, filepath.Join(workdir, "sub"))
+	if got := mounts(); len(got) != 1 {
+		t.Errorf("mounts of a trusted file = %v, want them applied", got)
+	}
+	if info, err := os.Stat(trustedProjectsPath()); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("trust record = %v, %v, want mode 0600", info, err)
+	}
+
+	// Any change to the file needs a new review
+	if err := os.WriteFile(path, []byte("mounts:\n  - /:/host\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := mounts(); len(got) != 0 {
+		t.Errorf("mounts of a changed file = %v, want none", got)
+	}
+
+	cmd := newConfigTrustCmd()
+	cmd.SetArgs([]string{"-w", workdir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("config trust: %v", err)
+	}
+	if got := mounts(); len(got) != 1 {
+		t.Errorf("mounts after config trust = %v, want them applied", got)
+	}
+	cmd = newConfigUntrustCmd()
+	cmd.SetArgs([]string{"-w", workdir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("config untrust: %v", err)
+	}
+	if got := mounts(); len(got) != 0 {
+		t.Errorf("mounts of an untrusted file = %v, want none", got)
+	}
+	if err := cmd.Execute(); err == nil {
+		t.Error("config untrust of a file that isn't trusted succeeded")
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// gitWorktree is one entry of `git worktree list --porcelain`.
+type gitWorktree struct {
+	Path   string
+	Branch string // Short branch name; empty for a detached HEAD or bare repo
+}
+
+// managedWorktree is a worktree created by --worktree, as listed by `cc-sandbox worktrees`.
+type managedWorktree struct {
+	gitWorktree
+	Merged bool
+	InUse  bool
+}
+
+// runGit runs git in dir and returns its trimmed output. Git's error message
+// is included in the returned error. Replaced in tests.
+var runGit = func(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// dataBaseDir returns cc-sandbox's directory for data kept across runs.
+func dataBaseDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "cc-sandbox")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "share", "cc-sandbox")
+}
+
+// worktreesBaseDir returns the directory under which --worktree creates
+// worktrees, one subdirectory per repository.
+func worktreesBaseDir() string {
+	return filepath.Join(dataBaseDir(), "worktrees")
+}
+
+// repoWorktreesDir returns the managed worktree directory for the repository
+// with the given common git dir. The hash keeps same-named repos apart.
+func repoWorktreesDir(commonDir string) string {
+	name := filepath.Base(commonDir)
+	if name == ".git" {
+		name = filepath.Base(filepath.Dir(commonDir))
+	}
+	name = strings.TrimSuffix(name, ".git")
+	sum := sha256.Sum256([]byte(commonDir))
+	return filepath.Join(worktreesBaseDir(), name+"-"+hex.EncodeToString(sum[:4]))
+}
+
+// gitCommonDir returns the absolute git dir shared by every worktree of the
+// repository containing dir.
+func gitCommonDir(dir string) (string, error) {
+	commonDir, err := runGit(dir, "rev-parse", "--path-format=absolute", "--git-common-dir")
+	if err != nil {
+		return "", fmt.Errorf("%s is not in a git repository: %w", dir, err)
+	}
+	return commonDir, nil
+}
+
+// listGitWorktrees returns the worktrees of the repository containing dir.
+func listGitWorktrees(dir string) ([]gitWorktree, error) {
+	out, err := runGit(dir, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	return parseWorktreeList(out), nil
+}
+
+// parseWorktreeList parses `git worktree list --porcelain` output.
+func parseWorktreeList(output string) []gitWorktree {
+	var worktrees []gitWorktree
+	for _, block := range strings.Split(output, "\n\n") {
+		var wt gitWorktree
+		for _, line := range strings.Split(block, "\n") {
+			key, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+			switch key {
+			case "worktree":
+				wt.Path = value
+			case "branch":
+				wt.Branch = strings.TrimPrefix(value, "refs/heads/")
+			}
+		}
+		if wt.Path != "" {
+			worktrees = append(worktrees, wt)
+		}
+	}
+	return worktrees
+}
+
+// isPathWithin reports whether path is dir or inside it.
+func isPathWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ensureWorktree returns the managed worktree of branch for the repository
+// containing workdir, creating it (and the branch, from HEAD) if needed.
+func ensureWorktree(workdir, branch string) (string, error) {
+	if _, err := runGit(workdir, "check-ref-format", "--branch", branch); err != nil {
+		return "", fmt.Errorf("invalid branch name %q", branch)
+	}
+	commonDir, err := gitCommonDir(workdir)
+	if err != nil {
+		return "", err
+	}
+	managedDir := repoWorktreesDir(commonDir)
+
+	// Forget worktrees whose directories were deleted by hand
+	if _, err := runGit(workdir, "worktree", "prune"); err != nil {
+		return "", err
+	}
+	worktrees, err := listGitWorktrees(workdir)
+	if err != nil {
+		return "", err
+	}
+	for _, wt := range worktrees {
+		if wt.Branch != branch {
+			continue
+		}
+		if isPathWithin(wt.Path, managedDir) {
+			debugLog("Reusing worktree for %s at %s", branch, wt.Path)
+			return wt.Path, nil
+		}
+		return "", fmt.Errorf("branch %s is already checked out at %s; run cc-sandbox there or pick another branch", branch, wt.Path)
+	}
+
+	path := filepath.Join(managedDir, filepath.FromSlash(branch))
+	args := []string{"worktree", "add", path, branch}
+	if _, err := runGit(workdir, "show-ref", "--verify", "--quiet", "refs/heads/"+branch); err != nil {
+		args = []string{"worktree", "add", "-b", branch, path}
+	}
+	if _, err := runGit(workdir, args...); err != nil {
+		return "", fmt.Errorf("failed to create worktree for %s: %w", branch, err)
+	}
+	fmt.Fprintf(os.Stderr, "Created worktree for %s at %s\n", branch, path)
+	return path, nil
+}
+
+// listManagedWorktrees returns the worktrees created by --worktree for the
+// repository containing dir, marking those merged into base and those in use
+// by a sandbox. An empty base means the branch checked out in the main repository.
+func listManagedWorktrees(dir, base string) ([]managedWorktree, string, error) {
+	commonDir, err := gitCommonDir(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if base == "" {
+		if base, err = runGit(commonDir, "symbolic-ref", "--short", "HEAD"); err != nil {
+			return nil, "", fmt.Errorf("cannot determine the base branch, use --base: %w", err)
+		}
+	}
+	mergedOut, err := runGit(dir, "branch", "--merged", base, "--format=%(refname:short)")
+	if err != nil {
+		return nil, "", err
+	}
+	merged := make(map[string]bool)
+	for _, b := range strings.Fields(mergedOut) {
+		merged[b] = true
+	}
+
+	worktrees, err := listGitWorktrees(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	managedDir := repoWorktreesDir(commonDir)
+	running := runningWorkdirs()
+
+	var managed []managedWorktree
+	for _, wt := range worktrees {
+		if !isPathWithin(wt.Path, managedDir) {
+			continue
+		}
+		managed = append(managed, managedWorktree{
+			gitWorktree: wt,
+			Merged:      wt.Branch != "" && wt.Branch != base && merged[wt.Branch],
+			InUse:       running[resolveWorkspacePath(wt.Path)] || isWorkspaceLocked(wt.Path),
+		})
+	}
+	return managed, base, nil
+}
+
+// runningWorkdirs returns the resolved workdirs of running sandboxes.
+// Runtimes that can't be queried are ignored.
+func runningWorkdirs() map[string]bool {
+	workdirs := make(map[string]bool)
+	entries, _ := listSandboxes(psRuntimes("auto"), false)
+	for _, e := range entries {
+		workdirs[resolveWorkspacePath(e.Workdir)] = true
+	}
+	return workdirs
+}
+
+// isWorkspaceLocked reports whether a cc-sandbox session holds the lock on path.
+func isWorkspaceLocked(path string) bool {
+	lock, err := lockWorkspaceFile(resolveWorkspacePath(path))
+	if err != nil {
+		return true
+	}
+	lock.release()
+	return false
+}
+
+// cleanupWorktrees removes the merged worktrees that no sandbox is using and
+// deletes their branches. Worktrees with uncommitted changes are kept.
+func cleanupWorktrees(w io.Writer, dir string, worktrees []managedWorktree) error {
+	var failed []string
+	for _, wt := range worktrees {
+		if !wt.Merged || wt.InUse {
+			continue
+		}
+		lock, err := lockWorkspaceFile(resolveWorkspacePath(wt.Path))
+		if err != nil {
+			continue
+		}
+		_, err = runGit(dir, "worktree", "remove", wt.Path)
+		lock.release()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: kept worktree %s: %v\n", wt.Branch, err)
+			failed = append(failed, wt.Branch)
+			continue
+		}
+		removeEmptyParents(filepath.Dir(wt.Path), worktreesBaseDir())
+		if _, err := runGit(dir, "branch", "-d", wt.Branch); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: kept branch %s: %v\n", wt.Branch, err)
+		}
+		_, _ = fmt.Fprintf(w, "Removed worktree %s (%s)\n", wt.Branch, wt.Path)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d merged worktree(s) could not be removed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// removeEmptyParents removes dir and its parents while they are empty,
+// stopping at root. Left behind by worktrees of branches like feature/x.
+func removeEmptyParents(dir, root string) {
+	for dir != root && isPathWithin(dir, root) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// newWorktreesCmd creates the worktrees subcommand.
+func newWorktreesCmd() *cobra.Command {
+	var workdir, base string
+	var cleanup bool
+
+	cmd := &cobra.Command{
+		Use:   "worktrees",
+		Short: "List or clean up the git worktrees created by --worktree",
+		Long: `List the git worktrees that --worktree created for the repository in the
+current directory, with whether each branch is merged and whether a sandbox
+is using it. --cleanup removes merged worktrees that are not in use, together
+with their branches.
+
+Examples:
+  cc-sandbox worktrees
+  cc-sandbox worktrees --cleanup
+  cc-sandbox worktrees --cleanup --base develop`,
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			dir := workdir
+			if dir == "" {
+				var err error
+				if dir, err = os.Getwd(); err != nil {
+					return fmt.Errorf("failed to get current directory: %w", err)
+				}
+			}
+			worktrees, base, err := listManagedWorktrees(expandPath(dir), base)
+			if err != nil {
+				return err
+			}
+			if cleanup {
+				return cleanupWorktrees(os.Stdout, expandPath(dir), worktrees)
+			}
+			return printWorktreesTable(os.Stdout, worktrees, base)
+		},
+	}
+
+	cmd.Flags().StringVarP(&workdir, "workdir", "w", "", "Directory in the repository (default: current directory)")
+	cmd.Flags().StringVar(&base, "base", "", "Branch that worktrees count as merged into (default: the main checkout's branch)")
+	cmd.Flags().BoolVar(&cleanup, "cleanup", false, "Remove merged worktrees that no sandbox is using")
+
+	return cmd
+}
+
+func printWorktreesTable(w io.Writer, worktrees []managedWorktree, base string) error {
+	if len(worktrees) == 0 {
+		_, err := fmt.Fprintln(w, "No worktrees found.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "BRANCH\tMERGED INTO %s\tIN USE\tPATH\n", base)
+	for _, wt := range worktrees {
+		branch := wt.Branch
+		if branch == "" {
+			branch = "(detached)"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", branch, yesNo(wt.Merged), yesNo(wt.InUse), wt.Path)
+	}
+	return tw.Flush()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRepo creates a git repository with one commit on main and points
+// the managed worktree directory at a temporary directory.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repo, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitOrFail(t, repo, "init", "-q", "-b", "main")
+	gitOrFail(t, repo, "commit", "-q", "--allow-empty", "-m", "initial")
+	return repo
+}
+
+func gitOrFail(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := runGit(dir, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestParseWorktreeList(t *testing.T) {
+	output := `worktree /src/api
+HEAD 1111111111111111111111111111111111111111
+branch refs/heads/main
+
+worktree /data/worktrees/api-1234abcd/feature/x
+HEAD 2222222222222222222222222222222222222222
+branch refs/heads/feature/x
+
+worktree /data/worktrees/api-1234abcd/gone
+HEAD 3333333333333333333333333333333333333333
+detached
+prunable gitdir file points to non-existent location
+`
+	got := parseWorktreeList(output)
+	want := []gitWorktree{
+		{Path: "/src/api", Branch: "main"},
+		{Path: "/data/worktrees/api-1234abcd/feature/x", Branch: "feature/x"},
+		{Path: "/data/worktrees/api-1234abcd/gone"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseWorktreeList() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseWorktreeList()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRepoWorktreesDir(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/data")
+	a := repoWorktreesDir("/src/api/.git")
+	b := repoWorktreesDir("/other/api/.git")
+	if filepath.Dir(a) != filepath.Join("/data", "cc-sandbox", "worktrees") {
+		t.Errorf("repoWorktreesDir() = %q, want it under the data directory", a)
+	}
+	if a == b {
+		t.Errorf("repos with the same name share worktree directory %q", a)
+	}
+	if base := filepath.Base(repoWorktreesDir("/src/api.git")); base[:4] != "api-" {
+		t.Errorf("bare repo worktree directory = %q, want an api- prefix", base)
+	}
+}
+
+func TestEnsureWorktree(t *testing.T) {
+	repo := newTestRepo(t)
+
+	path, err := ensureWorktree(repo, "feature/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isPathWithin(path, worktreesBaseDir()) {
+		t.Errorf("worktree %s is not in the managed directory %s", path, worktreesBaseDir())
+	}
+	if got := gitOrFail(t, path, "rev-parse", "--abbrev-ref", "HEAD"); got != "feature/x" {
+		t.Errorf("worktree is on %q, want feature/x", got)
+	}
+	if got := resolveGitWorktreePaths(path); got != filepath.Join(repo, ".git") {
+		t.Errorf("resolveGitWorktreePaths(%s) = %q, want the repo's git dir", path, got)
+	}
+
+	// A second session on the branch reuses the worktree, from any checkout
+	again, err := ensureWorktree(path, "feature/x")
+	if err != nil || again != path {
+		t.Errorf("ensureWorktree() again = %q, %v, want %q", again, err, path)
+	}
+
+	// The main checkout's branch can't get a second worktree
+	if _, err := ensureWorktree(repo, "main"); err == nil {
+		t.Error("ensureWorktree() for the checked-out branch succeeded")
+	}
+	if _, err := ensureWorktree(repo, "bad..name"); err == nil {
+		t.Error("ensureWorktree() accepted an invalid branch name")
+	}
+	if _, err := ensureWorktree(t.TempDir(), "feature/x"); err == nil {
+		t.Error("ensureWorktree() outside a repository succeeded")
+	}
+}
+
+func TestCleanupWorktrees(t *testing.T) {
+	repo := newTestRepo(t)
+	merged, err := ensureWorktree(repo, "merged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unmerged, err := ensureWorktree(repo, "unmerged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitOrFail(t, unmerged, "commit", "-q", "--allow-empty", "-m", "work")
+	inUse, err := ensureWorktree(repo, "in-use")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := lockWorkspaceFile(resolveWorkspacePath(inUse))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.release()
+
+	worktrees, base, err := listManagedWorktrees(repo, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base != "main" || len(worktrees) != 3 {
+		t.Fatalf("listManagedWorktrees() = %+v, base %q, want 3 worktrees and base main", worktrees, base)
+	}
+	state := make(map[string]managedWorktree)
+	for _, wt := range worktrees {
+		state[wt.Branch] = wt
+	}
+	if !state["merged"].Merged || state["unmerged"].Merged {
+		t.Errorf("merged flags = %+v", worktrees)
+	}
+	if !state["in-use"].InUse || state["merged"].InUse {
+		t.Errorf("in-use flags = %+v", worktrees)
+	}
+
+	var out bytes.Buffer
+	if err := cleanupWorktrees(&out, repo, worktrees); err != nil {
+		t.Fatal(err)
+	}
+	if dirExists(merged) {
+		t.Errorf("merged worktree %s was not removed", merged)
+	}
+	if !dirExists(unmerged) || !dirExists(inUse) {
+		t.Error("cleanup removed an unmerged or in-use worktree")
+	}
+	if _, err := runGit(repo, "show-ref", "--verify", "--quiet", "refs/heads/merged"); err == nil {
+		t.Error("branch of the removed worktree was kept")
+	}
+	if !contains(out.String(), "Removed worktree merged") {
+		t.Errorf("cleanup output = %q", out.String())
+	}
+}
@@ -23,6 +23,38 @@ fi
 # Determine if we're running as root or non-root
 CURRENT_UID=$(id -u)
 
+# --hardened with host IDs other than claude's: no-new-privileges disables the
+# setuid fixuid, so the CLI starts the container as root with the few
+# capabilities this step needs. Remap claude to CC_SANDBOX_USER the way fixuid
+# would, then run this script again as claude; gosu drops the capabilities
+if [ "$CURRENT_UID" = "0" ] && [ -n "$CC_SANDBOX_USER" ]; then
+    REMAP_UID="${CC_SANDBOX_USER%%:*}"
+    REMAP_GID="${CC_SANDBOX_USER#*:}"
+    OLD_UID=$(id -u claude)
+    OLD_GID=$(id -g claude)
+    if [ "$OLD_UID" != "$REMAP_UID" ] || [ "$OLD_GID" != "$REMAP_GID" ]; then
+        groupmod -o -g "$REMAP_GID" claude
+        usermod -o -u "$REMAP_UID" -g "$REMAP_GID" claude
+        # The paths in /etc/fixuid/config.yml
+        for path in /home/claude /workspace /mnt/claude-data; do
+            find "$path" -uid "$OLD_UID" -exec chown -h "$REMAP_UID" {} + 2>/dev/null || true
+            find "$path" -gid "$OLD_GID" -exec chgrp -h "$REMAP_GID" {} + 2>/dev/null || true
+        done
+        # gosu gives claude its groups from /etc/group; keep the container's
+        # extra groups (--group-add, e.g. the Docker socket's)
+        for group_id in $(sed -n 's/^Groups:\s*//p' /proc/self/status); do
+            group_name=$(getent group "$group_id" | cut -d: -f1)
+            if [ -z "$group_name" ]; then
+                group_name="host-$group_id"
+                groupadd -o -g "$group_id" "$group_name"
+            fi
+            usermod -aG "$group_name" claude
+        done
+        debug_log "[cc-sandbox] Remapped claude to $CC_SANDBOX_USER"
+    fi
+    exec gosu claude "$0" "$@"
+fi
+
 if [ "$CURRENT_UID" = "0" ]; then
     # Running as root (rootless Docker mode)
     export HOME="/root"
@@ -33,7 +65,12 @@ else
 
     # Run fixuid to remap claude user to current UID/GID and fix file ownership
     # fixuid reads from /etc/fixuid/config.yml
-    eval "$(fixuid -q)"
+    # It only runs once per container; `cc-sandbox exec` re-enters this script.
+    # With --hardened it can't run (see above) and isn't needed: the CLI runs
+    # the container as claude, already remapped if the host IDs differ
+    if [ "$CC_SANDBOX_HARDENED" != "1" ] && [ ! -f /var/run/fixuid.ran ]; then
+        eval "$(fixuid -q)"
+    fi
 
     debug_log "[cc-sandbox] Running as user $CURRENT_UID:$(id -g)"
 fi
@@ -55,6 +92,70 @@ if [ -d "/mnt/claude-data" ]; then
     debug_log "[cc-sandbox] Using persistent credentials from /mnt/claude-data"
 fi
 
+# Export KEY=VALUE lines from a provider settings file, skipping invalid names
+load_env_file() {
+    while IFS= read -r line || [ -n "$line" ]; do
+        key="${line%%=*}"
+        case "$key" in
+            ""|[0-9]*|*[!A-Za-z0-9_]*) continue ;;
+        esac
+        export "$key=${line#*=}"
+    done < "$1"
+}
+
+# Select the auth provider: the per-run --provider override, otherwise the
+# one recorded by `cc-sandbox auth`
+PROVIDER_DIR="/mnt/claude-data/.cc-sandbox"
+if [ -z "$CC_SANDBOX_PROVIDER" ] && [ -s "$PROVIDER_DIR/provider" ]; then
+    CC_SANDBOX_PROVIDER="$(cat "$PROVIDER_DIR/provider")"
+fi
+
+# Export the credentials stored by `cc-sandbox auth`
+# (read from the volume so they never appear on the docker command line)
+case "${CC_SANDBOX_PROVIDER:-oauth}" in
+    api-key)
+        if [ -z "$ANTHROPIC_API_KEY" ] && [ -s "$PROVIDER_DIR/api-key" ]; then
+            ANTHROPIC_API_KEY="$(cat "$PROVIDER_DIR/api-key")"
+            export ANTHROPIC_API_KEY
+        fi
+        debug_log "[cc-sandbox] Using Anthropic API key"
+        ;;
+    bedrock)
+        export CLAUDE_CODE_USE_BEDROCK=1
+        [ -f "$PROVIDER_DIR/aws/credentials" ] && export AWS_SHARED_CREDENTIALS_FILE="$PROVIDER_DIR/aws/credentials"
+        [ -f "$PROVIDER_DIR/aws/config" ] && export AWS_CONFIG_FILE="$PROVIDER_DIR/aws/config"
+        [ -f "$PROVIDER_DIR/bedrock.env" ] && load_env_file "$PROVIDER_DIR/bedrock.env"
+        debug_log "[cc-sandbox] Using Amazon Bedrock"
+        ;;
+    vertex)
+        export CLAUDE_CODE_USE_VERTEX=1
+        [ -f "$PROVIDER_DIR/gcloud/adc.json" ] && export GOOGLE_APPLICATION_CREDENTIALS="$PROVIDER_DIR/gcloud/adc.json"
+        [ -f "$PROVIDER_DIR/vertex.env" ] && load_env_file "$PROVIDER_DIR/vertex.env"
+        debug_log "[cc-sandbox] Using Google Vertex AI"
+        ;;
+    *)
+        if [ -z "$CLAUDE_CODE_OAUTH_TOKEN" ] && [ -s "/mnt/claude-data/.oauth-token" ]; then
+            CLAUDE_CODE_OAUTH_TOKEN="$(cat /mnt/claude-data/.oauth-token)"
+            export CLAUDE_CODE_OAUTH_TOKEN
+            debug_log "[cc-sandbox] Using stored OAuth token"
+        fi
+        ;;
+esac
+
+# Export secrets the CLI delivered as read-only files (one file per variable)
+SECRETS_DIR="/run/cc-sandbox/secrets"
+if [ -d "$SECRETS_DIR" ]; then
+    for secret_file in "$SECRETS_DIR"/*; do
+        [ -f "$secret_file" ] || continue
+        secret_name=$(basename "$secret_file")
+        case "$secret_name" in
+            [0-9]*|*[!A-Za-z0-9_]*) continue ;;
+        esac
+        export "$secret_name=$(cat "$secret_file")"
+    done
+    debug_log "[cc-sandbox] Loaded secrets from $SECRETS_DIR"
+fi
+
 # Handle .claude.json file persistence
 if [ -d "/mnt/claude-data" ]; then
     # If .claude.json exists in home and is not a symlink, move it to volume
@@ -250,11 +351,54 @@ if [ -d "/mnt/host-config/.ssh" ]; then
     debug_log "[cc-sandbox] SSH keys available"
 fi
 
+# The Docker socket proxy's directory is mounted instead of the socket; link
+# the usual path to it for tools that don't read DOCKER_HOST
+if [ -S "/run/cc-sandbox-docker/docker.sock" ] && [ ! -e "/var/run/docker.sock" ]; then
+    ln -s /run/cc-sandbox-docker/docker.sock /var/run/docker.sock 2>/dev/null || true
+fi
+
 # Docker socket handling (group-add is handled by CLI via --group-add flag)
 if [ -S "/var/run/docker.sock" ]; then
     debug_log "[cc-sandbox] Docker socket available"
 fi
 
+# Network allowlist: the sandbox has no network, and HTTP(S)_PROXY points at
+# 127.0.0.1:3128. Forward that port to the proxy socket served by the CLI.
+# `cc-sandbox exec` re-enters this script, so only start the forwarder once
+NET_PROXY_SOCKET="/run/cc-sandbox-net/proxy.sock"
+if [ -S "$NET_PROXY_SOCKET" ] && ! (echo > /dev/tcp/127.0.0.1/3128) 2>/dev/null; then
+    if command -v node &> /dev/null; then
+        node -e '
+            const net = require("net");
+            net.createServer((client) => {
+                const proxy = net.connect(process.argv[1]);
+                client.pipe(proxy).on("error", () => proxy.destroy());
+                proxy.pipe(client).on("error", () => client.destroy());
+                client.on("error", () => proxy.destroy());
+                proxy.on("error", () => client.destroy());
+            }).listen(3128, "127.0.0.1");
+        ' "$NET_PROXY_SOCKET" > /dev/null 2>&1 &
+        for _ in $(seq 50); do
+            (echo > /dev/tcp/127.0.0.1/3128) 2>/dev/null && break
+            sleep 0.1
+        done
+        debug_log "[cc-sandbox] Network allowlist proxy on 127.0.0.1:3128"
+    else
+        echo "[cc-sandbox] Warning: node not found; the network allowlist proxy is unreachable" >&2
+    fi
+fi
+
+# Clone the repository for --repo into the empty workspace volume.
+# Runs after the git and gh setup, so the sandbox's credentials are used
+if [ -n "$CC_SANDBOX_REPO" ] && [ ! -e /workspace/.git ]; then
+    echo "[cc-sandbox] Cloning $CC_SANDBOX_REPO" >&2
+    if [ -n "$CC_SANDBOX_REPO_BRANCH" ]; then
+        git clone --branch "$CC_SANDBOX_REPO_BRANCH" -- "$CC_SANDBOX_REPO" /workspace
+    else
+        git clone -- "$CC_SANDBOX_REPO" /workspace
+    fi
+fi
+
 # Display startup info
 debug_log "[cc-sandbox] Starting in /workspace | User: $(whoami) ($(id -u):$(id -g)) | Permission mode: $PERMISSION_MODE"
 